@@ -14,6 +14,8 @@ import (
 	"github.com/fairyhunter13/product-update-service-simulator/internal/obs"
 	"github.com/fairyhunter13/product-update-service-simulator/internal/queue"
 	"github.com/fairyhunter13/product-update-service-simulator/internal/store"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/tracing"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/wal"
 )
 
 func main() {
@@ -21,14 +23,47 @@ func main() {
 	obs.InitLogger()
 	obs.Logger.Info("service_starting")
 
-	st := store.New()
-	q := queue.New(128)
+	order, err := store.ParseOrdering(cfg.OrderingMode)
+	if err != nil {
+		obs.Logger.Error("ordering_mode_invalid", "error", err)
+		os.Exit(1)
+	}
+	var st store.ProductStore = store.NewOrdered(order)
+	var durable *store.Durable
+	if cfg.StoreDataDir != "" {
+		d, err := openDurableStore(cfg, order)
+		if err != nil {
+			obs.Logger.Error("store_open_failed", "dir", cfg.StoreDataDir, "error", err)
+			os.Exit(1)
+		}
+		durable = d
+		st = d
+	}
+	q, err := newQueue(cfg)
+	if err != nil {
+		obs.Logger.Error("queue_open_failed", "dir", cfg.QueueDataDir, "error", err)
+		os.Exit(1)
+	}
 	mgr := queue.NewManager(cfg, q, st)
+	tracer := newTracer(cfg)
+	mgr.SetTracer(tracer)
+	mgr.SeedSequence(q.RecoveredMaxSequence())
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	if durable != nil {
+		mgr.SeedSequence(durable.MaxSequence())
+		go durable.Run(ctx)
+	}
 	mgr.Start(ctx)
 
 	app := httpapi.NewApp(cfg, st, mgr)
+	if durable != nil {
+		app.AddReadinessCheck("store", durable.Health)
+	}
+	if cfg.QueueDataDir != "" {
+		app.AddReadinessCheck("queue_journal", q.Health)
+	}
+	app.Webhooks.Start(ctx)
 	mux := httpapi.NewRouter(app)
 
 	srv := &http.Server{
@@ -40,6 +75,8 @@ func main() {
 		IdleTimeout:       60 * time.Second,
 	}
 
+	srv.RegisterOnShutdown(app.CloseStreams)
+
 	go func() {
 		obs.Logger.Info("http_listen", "addr", cfg.HTTPAddr)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -54,7 +91,8 @@ func main() {
 	obs.Logger.Info("shutdown_signal", "signal", s.String())
 
 	app.StartShutdown()
-	obs.Logger.Info("shutdown_drain_begin", "backlog_size", mgr.BacklogSize(), "worker_count", mgr.WorkerCount())
+	held, _, _ := mgr.ScheduledStats()
+	obs.Logger.Info("shutdown_drain_begin", "backlog_size", mgr.BacklogSize(), "scheduled", held, "worker_count", mgr.WorkerCount())
 
 	ctxDrain, cancelDrain := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer cancelDrain()
@@ -70,5 +108,71 @@ func main() {
 		obs.Logger.Error("http_shutdown_error", "error", err)
 	}
 	mgr.Stop()
+	if err := tracer.Shutdown(ctxSrv); err != nil {
+		obs.Logger.Error("trace_export_flush_error", "error", err)
+	}
+	if err := q.Close(); err != nil {
+		obs.Logger.Error("queue_close_error", "error", err)
+	}
+	if durable != nil {
+		if err := durable.Close(); err != nil {
+			obs.Logger.Error("store_close_error", "error", err)
+		}
+	}
 	obs.Logger.Info("service_stopped")
 }
+
+// newQueue returns the in-memory queue, or the segment-file-backed queue
+// when QUEUE_DATA_DIR is set.
+func newQueue(cfg config.Config) (*queue.Queue, error) {
+	if cfg.QueueDataDir == "" {
+		return queue.New(128), nil
+	}
+	policy, err := wal.ParseSyncPolicy(cfg.QueueFsync)
+	if err != nil {
+		return nil, err
+	}
+	return queue.NewDurable(128, queue.JournalOptions{
+		Dir:           cfg.QueueDataDir,
+		Sync:          policy,
+		SegmentEvents: cfg.QueueSegmentEvents,
+	})
+}
+
+// newTracer returns a tracer exporting per TRACE_EXPORTER: "otlp" sends
+// spans to the OTLP/HTTP collector at OTEL_EXPORTER_OTLP_ENDPOINT,
+// "stdout" prints them as JSON lines, and "none" only propagates trace
+// context into logs.
+func newTracer(cfg config.Config) *tracing.Tracer {
+	switch cfg.TraceExporter {
+	case "otlp":
+		return tracing.NewTracer(tracing.NewOTLPExporter(tracing.OTLPOptions{
+			Endpoint:    cfg.OTLPEndpoint,
+			ServiceName: cfg.ServiceName,
+		}, func(err error) {
+			obs.Logger.Warn("trace_export_failed", "endpoint", cfg.OTLPEndpoint, "error", err)
+		}))
+	case "stdout":
+		return tracing.NewTracer(tracing.NewWriterExporter(os.Stdout))
+	case "none", "":
+		return tracing.NewTracer(nil)
+	default:
+		obs.Logger.Warn("trace_exporter_unknown", "exporter", cfg.TraceExporter, "fallback", "none")
+		return tracing.NewTracer(nil)
+	}
+}
+
+// openDurableStore opens the WAL/snapshot-backed store configured by cfg.
+func openDurableStore(cfg config.Config, order store.Ordering) (*store.Durable, error) {
+	policy, err := wal.ParseSyncPolicy(cfg.StoreFsync)
+	if err != nil {
+		return nil, err
+	}
+	return store.OpenDurable(store.DurableOptions{
+		Dir:              cfg.StoreDataDir,
+		Sync:             policy,
+		SyncInterval:     cfg.StoreFsyncInterval,
+		SnapshotInterval: cfg.StoreSnapshotInterval,
+		Ordering:         order,
+	})
+}
@@ -0,0 +1,129 @@
+// Package changes keeps a bounded in-memory log of applied product changes.
+// Readers hold a position in the log and pull new entries when notified, so
+// a slow reader never blocks the workers appending to it.
+package changes
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/model"
+)
+
+// Change describes one event that mutated a product.
+type Change struct {
+	Sequence  uint64         `json:"sequence"`
+	ProductID string         `json:"product_id"`
+	Product   model.Product  `json:"product"`
+	Previous  *model.Product `json:"previous"`
+	ChangedAt time.Time      `json:"changed_at"`
+}
+
+// Log is a fixed-size ring of changes addressed by a monotonically
+// increasing position. Once full, each append evicts the oldest change.
+type Log struct {
+	mu    sync.Mutex
+	buf   []Change
+	head  uint64            // position of the next append
+	bySeq map[uint64]uint64 // sequence -> position, for resume
+	wake  chan struct{}
+}
+
+// NewLog returns a log retaining up to size changes, or nil when size <= 0
+// (change tracking disabled). A nil log is safe to use.
+func NewLog(size int) *Log {
+	if size <= 0 {
+		return nil
+	}
+	return &Log{
+		buf:   make([]Change, 0, size),
+		bySeq: make(map[uint64]uint64, size),
+		wake:  make(chan struct{}),
+	}
+}
+
+// Append adds c to the log and wakes every waiting reader.
+func (l *Log) Append(c Change) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	size := uint64(cap(l.buf))
+	if l.head < size {
+		l.buf = append(l.buf, c)
+	} else {
+		i := l.head % size
+		delete(l.bySeq, l.buf[i].Sequence)
+		l.buf[i] = c
+	}
+	l.bySeq[c.Sequence] = l.head
+	l.head++
+	close(l.wake)
+	l.wake = make(chan struct{})
+}
+
+// Wait returns a channel closed on the next Append. Readers must call Wait
+// before Since so an append in between is not missed.
+func (l *Log) Wait() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.wake
+}
+
+// Head returns the position the next change will be written at; reading
+// from Head yields only changes appended from now on.
+func (l *Log) Head() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.head
+}
+
+// Len returns the number of retained changes.
+func (l *Log) Len() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buf)
+}
+
+// Resume returns the position just after the change with sequence seq, for
+// clients reconnecting with the last sequence they saw. When that change is
+// no longer retained it falls back to the oldest retained change with a
+// newer sequence, so a reader may see some changes twice but none skipped
+// that the log still holds.
+func (l *Log) Resume(seq uint64) uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if pos, ok := l.bySeq[seq]; ok {
+		return pos + 1
+	}
+	for pos := l.oldestLocked(); pos < l.head; pos++ {
+		if l.buf[pos%uint64(cap(l.buf))].Sequence > seq {
+			return pos
+		}
+	}
+	return l.head
+}
+
+// Since returns the changes from position pos onwards and the position to
+// read from next. missed counts changes evicted before pos could read them.
+func (l *Log) Since(pos uint64) (out []Change, next, missed uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if oldest := l.oldestLocked(); pos < oldest {
+		missed = oldest - pos
+		pos = oldest
+	}
+	size := uint64(cap(l.buf))
+	for ; pos < l.head; pos++ {
+		out = append(out, l.buf[pos%size])
+	}
+	return out, l.head, missed
+}
+
+func (l *Log) oldestLocked() uint64 {
+	return l.head - uint64(len(l.buf))
+}
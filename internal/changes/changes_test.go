@@ -0,0 +1,80 @@
+package changes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/model"
+)
+
+func change(seq uint64) Change {
+	return Change{Sequence: seq, ProductID: "p", Product: model.Product{ProductID: "p"}}
+}
+
+func sequences(cs []Change) []uint64 {
+	out := make([]uint64, 0, len(cs))
+	for _, c := range cs {
+		out = append(out, c.Sequence)
+	}
+	return out
+}
+
+func TestLog_SinceAndEviction(t *testing.T) {
+	l := NewLog(3)
+	start := l.Head()
+	for seq := uint64(1); seq <= 5; seq++ {
+		l.Append(change(seq))
+	}
+	got, next, missed := l.Since(start)
+	if missed != 2 || next != 5 {
+		t.Fatalf("expected 2 missed and next 5, got missed=%d next=%d", missed, next)
+	}
+	if s := sequences(got); len(s) != 3 || s[0] != 3 || s[2] != 5 {
+		t.Fatalf("expected sequences 3..5, got %v", s)
+	}
+	if got, _, _ := l.Since(next); len(got) != 0 {
+		t.Fatalf("expected nothing new, got %v", sequences(got))
+	}
+}
+
+func TestLog_Resume(t *testing.T) {
+	l := NewLog(3)
+	// Application order is not sequence order across products.
+	for _, seq := range []uint64{10, 12, 11, 14} {
+		l.Append(change(seq))
+	}
+	got, _, _ := l.Since(l.Resume(12))
+	if s := sequences(got); len(s) != 2 || s[0] != 11 || s[1] != 14 {
+		t.Fatalf("resume after 12: expected [11 14], got %v", s)
+	}
+	// 10 was evicted: fall back to the first retained newer sequence.
+	got, _, _ = l.Since(l.Resume(10))
+	if s := sequences(got); len(s) != 3 || s[0] != 12 {
+		t.Fatalf("resume after evicted 10: expected [12 11 14], got %v", s)
+	}
+	if pos := l.Resume(99); pos != l.Head() {
+		t.Fatalf("resume past the end should start at head")
+	}
+}
+
+func TestLog_WaitWakesOnAppend(t *testing.T) {
+	l := NewLog(4)
+	ch := l.Wait()
+	go l.Append(change(1))
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatalf("expected wake on append")
+	}
+}
+
+func TestLog_NilDisabled(t *testing.T) {
+	var l *Log
+	l.Append(change(1))
+	if l.Len() != 0 {
+		t.Fatalf("nil log should be empty")
+	}
+	if NewLog(0) != nil {
+		t.Fatalf("expected nil log for size 0")
+	}
+}
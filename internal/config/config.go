@@ -17,7 +17,51 @@ type Config struct {
 	ScaleInterval           time.Duration
 	ScaleUpBacklogPerWorker int
 	ScaleDownIdleTicks      int
+	ScalePolicy             string
+	ScaleLatencyTarget      time.Duration
+	ScaleEWMAAlpha          float64
+	ScaleWorkerRate         float64
+	ScaleMaxStep            int
+	ScaleDownCooldown       time.Duration
 	QueueHighWatermark      int
+	QueueCapacity           int
+	QueueOverloadPolicy     string
+	QueueRetryAfter         time.Duration
+	QueueCoalesce           bool
+	QueuePriorityWeights    string
+	DispatchMode            string
+	BatchMaxEvents          int
+	BatchMaxBytes           int
+	EventStatusRetention    int
+	ApplyMaxRetries         int
+	ApplyRetryBackoff       time.Duration
+	ApplyRetryMaxBackoff    time.Duration
+	DLQSize                 int
+	ReadWaitDefault         time.Duration
+	ReadWaitMax             time.Duration
+	ChangeLogSize           int
+	SSEHeartbeat            time.Duration
+	WebhookMaxAttempts      int
+	WebhookBackoff          time.Duration
+	WebhookMaxBackoff       time.Duration
+	WebhookQueueSize        int
+	WebhookTimeout          time.Duration
+	WebhookDeadLetterSize   int
+	StoreDataDir            string
+	StoreFsync              string
+	StoreFsyncInterval      time.Duration
+	StoreSnapshotInterval   time.Duration
+	QueueDataDir            string
+	QueueFsync              string
+	QueueSegmentEvents      int
+	SLOLatencyTarget        time.Duration
+	ReadyMaxBacklog         int
+	IdempotencyTTL          time.Duration
+	IdempotencyMaxKeys      int
+	OrderingMode            string
+	TraceExporter           string
+	OTLPEndpoint            string
+	ServiceName             string
 }
 
 func getenv(key, def string) string {
@@ -39,6 +83,30 @@ func atoienv(key string, def int) int {
 	return n
 }
 
+func boolenv(key string, def bool) bool {
+	v := getenv(key, "")
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return def
+	}
+	return b
+}
+
+func floatenv(key string, def float64) float64 {
+	v := getenv(key, "")
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return def
+	}
+	return f
+}
+
 func durenvms(key string, defMs int) time.Duration {
 	ms := atoienv(key, defMs)
 	return time.Duration(ms) * time.Millisecond
@@ -63,6 +131,50 @@ func Load() Config {
 		ScaleInterval:           durenvms("SCALE_INTERVAL_MS", 500),
 		ScaleUpBacklogPerWorker: atoienv("SCALE_UP_BACKLOG_PER_WORKER", 100),
 		ScaleDownIdleTicks:      atoienv("SCALE_DOWN_IDLE_TICKS", 6),
+		ScalePolicy:             getenv("SCALE_POLICY", "threshold"),
+		ScaleLatencyTarget:      durenvms("SCALE_LATENCY_TARGET_MS", 1000),
+		ScaleEWMAAlpha:          floatenv("SCALE_EWMA_ALPHA", 0.3),
+		ScaleWorkerRate:         floatenv("SCALE_WORKER_RATE", 200),
+		ScaleMaxStep:            atoienv("SCALE_MAX_STEP", 10),
+		ScaleDownCooldown:       durenvms("SCALE_DOWN_COOLDOWN_MS", 5000),
 		QueueHighWatermark:      atoienv("QUEUE_HIGH_WATERMARK", 5000),
+		QueueCapacity:           atoienv("QUEUE_CAPACITY", 0),
+		QueueOverloadPolicy:     getenv("QUEUE_OVERLOAD_POLICY", "reject"),
+		QueueRetryAfter:         durenvs("QUEUE_RETRY_AFTER_S", 1),
+		QueueCoalesce:           boolenv("QUEUE_COALESCE", false),
+		QueuePriorityWeights:    getenv("QUEUE_PRIORITY_WEIGHTS", "8,4,1"),
+		DispatchMode:            getenv("DISPATCH_MODE", "shared"),
+		BatchMaxEvents:          atoienv("BATCH_MAX_EVENTS", 1000),
+		BatchMaxBytes:           atoienv("BATCH_MAX_BYTES", 4<<20),
+		EventStatusRetention:    atoienv("EVENT_STATUS_RETENTION", 100000),
+		ApplyMaxRetries:         atoienv("APPLY_MAX_RETRIES", 3),
+		ApplyRetryBackoff:       durenvms("APPLY_RETRY_BACKOFF_MS", 50),
+		ApplyRetryMaxBackoff:    durenvms("APPLY_RETRY_MAX_BACKOFF_MS", 2000),
+		DLQSize:                 atoienv("DLQ_SIZE", 10000),
+		ReadWaitDefault:         durenvms("READ_WAIT_DEFAULT_MS", 1000),
+		ReadWaitMax:             durenvms("READ_WAIT_MAX_MS", 10000),
+		ChangeLogSize:           atoienv("CHANGE_LOG_SIZE", 10000),
+		SSEHeartbeat:            durenvms("SSE_HEARTBEAT_MS", 15000),
+		WebhookMaxAttempts:      atoienv("WEBHOOK_MAX_ATTEMPTS", 5),
+		WebhookBackoff:          durenvms("WEBHOOK_BACKOFF_MS", 500),
+		WebhookMaxBackoff:       durenvms("WEBHOOK_MAX_BACKOFF_MS", 30000),
+		WebhookQueueSize:        atoienv("WEBHOOK_QUEUE_SIZE", 1000),
+		WebhookTimeout:          durenvms("WEBHOOK_TIMEOUT_MS", 5000),
+		WebhookDeadLetterSize:   atoienv("WEBHOOK_DEAD_LETTER_SIZE", 1000),
+		StoreDataDir:            getenv("STORE_DATA_DIR", ""),
+		StoreFsync:              getenv("STORE_FSYNC", "interval"),
+		StoreFsyncInterval:      durenvms("STORE_FSYNC_INTERVAL_MS", 1000),
+		StoreSnapshotInterval:   durenvms("STORE_SNAPSHOT_INTERVAL_MS", 60000),
+		QueueDataDir:            getenv("QUEUE_DATA_DIR", ""),
+		QueueFsync:              getenv("QUEUE_FSYNC", "always"),
+		QueueSegmentEvents:      atoienv("QUEUE_SEGMENT_EVENTS", 10000),
+		SLOLatencyTarget:        durenvms("SLO_LATENCY_TARGET_MS", 1000),
+		ReadyMaxBacklog:         atoienv("READY_MAX_BACKLOG", 20000),
+		IdempotencyTTL:          durenvs("IDEMPOTENCY_TTL_S", 3600),
+		IdempotencyMaxKeys:      atoienv("IDEMPOTENCY_MAX_KEYS", 100000),
+		OrderingMode:            getenv("ORDERING_MODE", "sequence"),
+		TraceExporter:           getenv("TRACE_EXPORTER", "none"),
+		OTLPEndpoint:            getenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4318"),
+		ServiceName:             getenv("OTEL_SERVICE_NAME", "product-update-service-simulator"),
 	}
 }
@@ -16,6 +16,13 @@ func TestLoadDefaults(t *testing.T) {
 	t.Setenv("SCALE_UP_BACKLOG_PER_WORKER", "")
 	t.Setenv("SCALE_DOWN_IDLE_TICKS", "")
 	t.Setenv("QUEUE_HIGH_WATERMARK", "")
+	t.Setenv("STORE_DATA_DIR", "")
+	t.Setenv("STORE_FSYNC", "")
+	t.Setenv("STORE_FSYNC_INTERVAL_MS", "")
+	t.Setenv("STORE_SNAPSHOT_INTERVAL_MS", "")
+	t.Setenv("QUEUE_DATA_DIR", "")
+	t.Setenv("QUEUE_FSYNC", "")
+	t.Setenv("QUEUE_SEGMENT_EVENTS", "")
 	c := Load()
 	if c.HTTPAddr != ":8080" {
 		t.Fatalf("HTTPAddr default")
@@ -35,6 +42,15 @@ func TestLoadDefaults(t *testing.T) {
 	if c.QueueHighWatermark != 5000 {
 		t.Fatalf("high watermark default")
 	}
+	if c.StoreDataDir != "" || c.StoreFsync != "interval" {
+		t.Fatalf("store persistence default")
+	}
+	if c.StoreFsyncInterval != time.Second || c.StoreSnapshotInterval != time.Minute {
+		t.Fatalf("store intervals default")
+	}
+	if c.QueueDataDir != "" || c.QueueFsync != "always" || c.QueueSegmentEvents != 10000 {
+		t.Fatalf("queue journal default")
+	}
 }
 
 func TestLoadEnvOverrides(t *testing.T) {
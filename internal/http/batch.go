@@ -0,0 +1,258 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/model"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/obs"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/queue"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/tracing"
+)
+
+// Batch modes accepted in the "mode" query parameter.
+const (
+	batchModePartial      = "partial"
+	batchModeAllOrNothing = "all_or_nothing"
+)
+
+// Per-item and per-batch statuses.
+const (
+	statusAccepted = "accepted"
+	statusRejected = "rejected"
+	statusPartial  = "partial"
+	// statusDropped marks an event shed by the drop_newest overload policy.
+	statusDropped = "dropped"
+	// statusScheduled marks an event held until its effective_at.
+	statusScheduled = "scheduled"
+)
+
+// batchMetrics counts batch ingestion activity for /debug/metrics.
+type batchMetrics struct {
+	received       atomic.Uint64
+	rejected       atomic.Uint64
+	eventsAccepted atomic.Uint64
+	eventsRejected atomic.Uint64
+}
+
+// batchItem is the per-event outcome in a batch response.
+type batchItem struct {
+	Index     int    `json:"index"`
+	Status    string `json:"status"`
+	Sequence  uint64 `json:"sequence,omitempty"`
+	ProductID string `json:"product_id,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Details   string `json:"details,omitempty"`
+}
+
+type batchAck struct {
+	Status            string         `json:"status"`
+	Mode              string         `json:"mode"`
+	RequestID         string         `json:"request_id"`
+	Accepted          int            `json:"accepted"`
+	Rejected          int            `json:"rejected"`
+	Dropped           int            `json:"dropped,omitempty"`
+	ReceivedAt        string         `json:"received_at"`
+	QueueDepth        int            `json:"queue_depth"`
+	BacklogSize       int            `json:"backlog_size"`
+	WorkerCount       int            `json:"worker_count"`
+	BacklogByPriority map[string]int `json:"backlog_by_priority"`
+	Results           []batchItem    `json:"results"`
+}
+
+// decodeEvent strictly decodes a single event object.
+func decodeEvent(data []byte) (model.Event, error) {
+	var ev model.Event
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&ev); err != nil {
+		return ev, err
+	}
+	if dec.More() {
+		return ev, errors.New("unexpected data after event object")
+	}
+	return ev, nil
+}
+
+func (a *App) postEventsBatchHandler(w http.ResponseWriter, r *http.Request) {
+	received := time.Now()
+	if r.Method != http.MethodPost {
+		WriteJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "")
+		return
+	}
+	if a.closing || a.Manager.IsShuttingDown() {
+		WriteJSONError(w, http.StatusServiceUnavailable, "shutting_down", "")
+		return
+	}
+	if !isJSON(r) {
+		WriteJSONError(w, http.StatusUnsupportedMediaType, "unsupported_media_type", "expected application/json")
+		return
+	}
+	a.batch.received.Add(1)
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = batchModePartial
+	}
+	if mode != batchModePartial && mode != batchModeAllOrNothing {
+		a.batch.rejected.Add(1)
+		WriteJSONError(w, http.StatusBadRequest, "validation_error", "mode must be partial or all_or_nothing")
+		return
+	}
+	prio, ok := requestPriority(r)
+	if !ok {
+		a.batch.rejected.Add(1)
+		WriteJSONError(w, http.StatusBadRequest, "validation_error", "X-Priority must be high, normal or low")
+		return
+	}
+	if a.Cfg.BatchMaxBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, int64(a.Cfg.BatchMaxBytes))
+	}
+	var raws []json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raws); err != nil {
+		a.batch.rejected.Add(1)
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			WriteJSONError(w, http.StatusRequestEntityTooLarge, "batch_too_large", fmt.Sprintf("body exceeds %d bytes", mbe.Limit))
+			return
+		}
+		WriteJSONError(w, http.StatusBadRequest, "invalid_json", err.Error())
+		return
+	}
+	if len(raws) == 0 {
+		a.batch.rejected.Add(1)
+		WriteJSONError(w, http.StatusBadRequest, "validation_error", "batch must contain at least one event")
+		return
+	}
+	if a.Cfg.BatchMaxEvents > 0 && len(raws) > a.Cfg.BatchMaxEvents {
+		a.batch.rejected.Add(1)
+		WriteJSONError(w, http.StatusRequestEntityTooLarge, "batch_too_large", fmt.Sprintf("batch exceeds %d events", a.Cfg.BatchMaxEvents))
+		return
+	}
+
+	_, decodeSpan := a.Manager.Tracer().Start(r.Context(), "event.decode", tracing.Int("events", int64(len(raws))))
+	results := make([]batchItem, len(raws))
+	valid := make([]model.Event, 0, len(raws))
+	validIdx := make([]int, 0, len(raws))
+	for i, raw := range raws {
+		results[i] = batchItem{Index: i}
+		ev, err := decodeEvent(raw)
+		if err != nil {
+			results[i].Status, results[i].Error, results[i].Details = statusRejected, "invalid_json", err.Error()
+			continue
+		}
+		results[i].ProductID = ev.ProductID
+		ev = withPriority(ev, prio)
+		if msg := a.validateEvent(ev); msg != "" {
+			results[i].Status, results[i].Error, results[i].Details = statusRejected, "validation_error", msg
+			continue
+		}
+		ev.ReceivedAt = received
+		valid = append(valid, a.schedule(ev))
+		validIdx = append(validIdx, i)
+	}
+
+	rejected := len(raws) - len(valid)
+	decodeSpan.SetAttrs(tracing.Int("rejected", int64(rejected)))
+	decodeSpan.End()
+	if mode == batchModeAllOrNothing && rejected > 0 {
+		for _, i := range validIdx {
+			results[i].Status, results[i].Error = statusRejected, "batch_aborted"
+		}
+		valid = valid[:0]
+		validIdx = validIdx[:0]
+	}
+	accepted, dropped, full := 0, 0, 0
+	notDurable := false
+	if len(valid) > 0 {
+		first := a.Manager.NextSequences(len(valid))
+		enqSpan := a.startEnqueue(r.Context(), len(valid))
+		for k := range valid {
+			valid[k].Sequence = first + uint64(k)
+			valid[k] = traced(r.Context(), enqSpan, valid[k])
+		}
+		refused, err := a.Manager.OfferBatch(valid)
+		enqSpan.RecordError(err)
+		enqSpan.End()
+		notDurable = errors.Is(err, queue.ErrNotDurable)
+		if err != nil && !notDurable {
+			WriteJSONError(w, http.StatusServiceUnavailable, "shutting_down", "")
+			return
+		}
+		for k, i := range validIdx {
+			results[i].Sequence = valid[k].Sequence
+			switch refused[k] {
+			case nil:
+				results[i].Status = statusAccepted
+				if valid[k].EffectiveAt != nil {
+					results[i].Status = statusScheduled
+				}
+				if notDurable {
+					results[i].Error, results[i].Details = "not_durable", notDurableDetails(valid[k].Sequence)
+				}
+				accepted++
+			case queue.ErrEventDropped:
+				results[i].Status = statusDropped
+				dropped++
+			default:
+				results[i].Status, results[i].Error, results[i].Sequence = statusRejected, "queue_full", 0
+				full++
+			}
+		}
+	}
+
+	ac := batchAck{
+		Mode:              mode,
+		RequestID:         RequestIDFromContext(r.Context()),
+		Accepted:          accepted,
+		Rejected:          len(raws) - accepted - dropped,
+		Dropped:           dropped,
+		ReceivedAt:        time.Now().UTC().Format(time.RFC3339),
+		QueueDepth:        a.Manager.QueueDepth(),
+		BacklogSize:       a.Manager.BacklogSize(),
+		WorkerCount:       a.Manager.WorkerCount(),
+		BacklogByPriority: a.Manager.LaneBacklog(),
+		Results:           results,
+	}
+	a.batch.eventsAccepted.Add(uint64(ac.Accepted))
+	a.batch.eventsRejected.Add(uint64(ac.Rejected))
+	status := http.StatusAccepted
+	switch {
+	case ac.Accepted == 0 && ac.Dropped == 0:
+		ac.Status = statusRejected
+		status = http.StatusBadRequest
+		if full > 0 {
+			status = http.StatusTooManyRequests
+			w.Header().Set("Retry-After", a.retryAfter())
+		}
+		a.batch.rejected.Add(1)
+	case ac.Rejected > 0 || ac.Dropped > 0:
+		ac.Status = statusPartial
+	default:
+		ac.Status = statusAccepted
+	}
+	if notDurable {
+		// The accepted events will be applied; the results carry their
+		// sequences so the client does not resend them.
+		status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(ac)
+	obs.Logger.Info("batch_received",
+		"request_id", ac.RequestID,
+		"trace_id", traceID(r.Context()),
+		"mode", ac.Mode,
+		"size", len(raws),
+		"accepted", ac.Accepted,
+		"rejected", ac.Rejected,
+		"dropped", ac.Dropped,
+		"queue_depth", ac.QueueDepth,
+		"backlog_size", ac.BacklogSize,
+		"worker_count", ac.WorkerCount,
+	)
+}
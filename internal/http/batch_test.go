@@ -0,0 +1,103 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/model"
+)
+
+func postBatch(t *testing.T, h http.Handler, query, body string) (*httptest.ResponseRecorder, batchAck) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/events:batch"+query, bytes.NewBufferString(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	var ac batchAck
+	if strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		_ = json.Unmarshal(w.Body.Bytes(), &ac)
+	}
+	return w, ac
+}
+
+func TestBatch_PartialAccept(t *testing.T) {
+	_, mgr, cleanup, mux := setupApp(t)
+	defer cleanup()
+	body := `[{"product_id":"b-1","price":1},{"product_id":"","price":2},{"product_id":"b-1","stock":3},{"product_id":"b-2","foo":1}]`
+	w, ac := postBatch(t, mux, "", body)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	if ac.Status != statusPartial || ac.Accepted != 2 || ac.Rejected != 2 || len(ac.Results) != 4 {
+		t.Fatalf("unexpected ack: %+v", ac)
+	}
+	if ac.Results[1].Error != "validation_error" || ac.Results[3].Error != "invalid_json" {
+		t.Fatalf("unexpected item errors: %+v", ac.Results)
+	}
+	if ac.Results[2].Sequence != ac.Results[0].Sequence+1 {
+		t.Fatalf("expected consecutive sequences, got %d and %d", ac.Results[0].Sequence, ac.Results[2].Sequence)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if !mgr.DrainUntil(ctx) {
+		t.Fatalf("drain timeout")
+	}
+	gr := httptest.NewRequest(http.MethodGet, "/products/b-1", nil)
+	gw := httptest.NewRecorder()
+	mux.ServeHTTP(gw, gr)
+	var p model.Product
+	_ = json.Unmarshal(gw.Body.Bytes(), &p)
+	if p.Price != 1 || p.Stock != 3 {
+		t.Fatalf("unexpected product: %+v", p)
+	}
+}
+
+func TestBatch_AllOrNothing(t *testing.T) {
+	app, _, cleanup, mux := setupApp(t)
+	defer cleanup()
+	body := `[{"product_id":"b-3","price":1},{"product_id":"b-3","price":-1}]`
+	w, ac := postBatch(t, mux, "?mode=all_or_nothing", body)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+	if ac.Accepted != 0 || ac.Results[0].Error != "batch_aborted" {
+		t.Fatalf("unexpected ack: %+v", ac)
+	}
+	if enq, _, _, _ := app.Manager.QueueMetrics(); enq != 0 {
+		t.Fatalf("expected nothing enqueued, got %d", enq)
+	}
+	w, ac = postBatch(t, mux, "?mode=all_or_nothing", `[{"product_id":"b-3","price":1},{"product_id":"b-4","stock":1}]`)
+	if w.Code != http.StatusAccepted || ac.Status != statusAccepted || ac.Accepted != 2 {
+		t.Fatalf("expected full accept, got %d %+v", w.Code, ac)
+	}
+}
+
+func TestBatch_Limits(t *testing.T) {
+	app, _, cleanup, mux := setupApp(t)
+	defer cleanup()
+	app.Cfg.BatchMaxEvents = 2
+	w, _ := postBatch(t, mux, "", `[{"product_id":"a"},{"product_id":"b"},{"product_id":"c"}]`)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d", w.Code)
+	}
+	if w, _ := postBatch(t, mux, "", `[]`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for empty batch, got %d", w.Code)
+	}
+	if w, _ := postBatch(t, mux, "?mode=bogus", `[{"product_id":"a"}]`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown mode, got %d", w.Code)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/debug/metrics", nil)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	var m map[string]any
+	_ = json.Unmarshal(rr.Body.Bytes(), &m)
+	if m["batches_received"].(float64) != 3 || m["batches_rejected"].(float64) != 3 {
+		t.Fatalf("unexpected batch metrics: %v", m)
+	}
+}
@@ -0,0 +1,66 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/obs"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/queue"
+)
+
+// dlqReplayRequest selects dead events to replay; empty means all.
+type dlqReplayRequest struct {
+	Sequences []uint64 `json:"sequences"`
+}
+
+// dlqHandler lists (GET) or replays (POST) dead-lettered events. GET also
+// lists the poison bucket: events whose processing panicked.
+func (a *App) dlqHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		dead := a.Manager.DeadLetters()
+		writeJSON(w, http.StatusOK, map[string]any{"count": len(dead), "events": dead, "poison": a.Manager.PoisonEvents()})
+	case http.MethodPost:
+		var req dlqReplayRequest
+		if r.ContentLength != 0 {
+			if !isJSON(r) {
+				WriteJSONError(w, http.StatusUnsupportedMediaType, "unsupported_media_type", "expected application/json")
+				return
+			}
+			dec := json.NewDecoder(r.Body)
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+				WriteJSONError(w, http.StatusBadRequest, "invalid_json", err.Error())
+				return
+			}
+		}
+		replayed, err := a.Manager.ReplayDeadLetters(req.Sequences)
+		switch {
+		case errors.Is(err, queue.ErrQueueFull), errors.Is(err, queue.ErrEventDropped):
+			// Report what was replayed before the refusal; the rest stays
+			// in the DLQ for a retry.
+			w.Header().Set("Retry-After", a.retryAfter())
+			writeJSON(w, http.StatusTooManyRequests, map[string]any{
+				"error":     "queue_full",
+				"details":   fmt.Sprintf("queue is at capacity (%d events)", a.Cfg.QueueCapacity),
+				"replayed":  len(replayed),
+				"sequences": replayed,
+			})
+			return
+		case err != nil:
+			WriteJSONError(w, http.StatusServiceUnavailable, "shutting_down", "")
+			return
+		}
+		obs.Logger.Info("dlq_replay_requested",
+			"request_id", RequestIDFromContext(r.Context()),
+			"requested", len(req.Sequences),
+			"replayed", len(replayed),
+		)
+		writeJSON(w, http.StatusAccepted, map[string]any{"replayed": len(replayed), "sequences": replayed})
+	default:
+		WriteJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "")
+	}
+}
@@ -0,0 +1,147 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/config"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/model"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/obs"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/queue"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/store"
+)
+
+// brokenStore fails every Upsert while broken is set.
+type brokenStore struct {
+	*store.Store
+	broken atomic.Bool
+}
+
+func (s *brokenStore) Upsert(ev model.Event) (store.Result, error) {
+	if s.broken.Load() {
+		return store.Result{}, errors.New("store offline")
+	}
+	return s.Store.Upsert(ev)
+}
+
+func TestAdminDLQ_ListAndReplay(t *testing.T) {
+	obs.InitLogger()
+	cfg := config.Load()
+	cfg.InitialWorkerCount = 1
+	cfg.ApplyMaxRetries = 1
+	cfg.ApplyRetryBackoff = time.Millisecond
+	st := &brokenStore{Store: store.New()}
+	st.broken.Store(true)
+	mgr := queue.NewManager(cfg, queue.New(16), st)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mgr.Start(ctx)
+	defer mgr.Stop()
+	mux := NewRouter(NewApp(cfg, st, mgr))
+
+	ac := postEvent(t, mux, `{"product_id":"dlq-1","stock":9}`)
+	drain := func() {
+		t.Helper()
+		ctxDrain, cancelDrain := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancelDrain()
+		if !mgr.DrainUntil(ctxDrain) {
+			t.Fatalf("drain timeout")
+		}
+	}
+	drain()
+
+	gw := httptest.NewRecorder()
+	mux.ServeHTTP(gw, httptest.NewRequest(http.MethodGet, "/admin/dlq", nil))
+	var list struct {
+		Count  int               `json:"count"`
+		Events []queue.DeadEvent `json:"events"`
+	}
+	if err := json.Unmarshal(gw.Body.Bytes(), &list); err != nil {
+		t.Fatalf("decode dlq: %v", err)
+	}
+	if list.Count != 1 || list.Events[0].Sequence != ac.Sequence || list.Events[0].Attempts != 2 {
+		t.Fatalf("unexpected dlq: %+v", list)
+	}
+
+	st.broken.Store(false)
+	r := httptest.NewRequest(http.MethodPost, "/admin/dlq", bytes.NewBufferString(fmt.Sprintf(`{"sequences":[%d]}`, ac.Sequence)))
+	r.Header.Set("Content-Type", "application/json")
+	pw := httptest.NewRecorder()
+	mux.ServeHTTP(pw, r)
+	if pw.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", pw.Code, pw.Body.String())
+	}
+	drain()
+	if p, ok := st.Get("dlq-1"); !ok || p.Stock != 9 {
+		t.Fatalf("replayed event not applied: %+v", p)
+	}
+}
+
+func TestAdminDLQ_PartialReplayReportsReplayed(t *testing.T) {
+	obs.InitLogger()
+	cfg := config.Load()
+	cfg.InitialWorkerCount, cfg.WorkerMin, cfg.WorkerMax = 1, 1, 1
+	cfg.ApplyMaxRetries = 0
+	cfg.QueueCapacity, cfg.QueueOverloadPolicy = 1, queue.OverloadReject
+	st := &brokenStore{Store: store.New()}
+	st.broken.Store(true)
+	mgr := queue.NewManager(cfg, queue.New(1), st)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mgr.Start(ctx)
+	defer mgr.Stop()
+	mux := NewRouter(NewApp(cfg, st, mgr))
+
+	first := postEvent(t, mux, `{"product_id":"dlq-a","stock":1}`)
+	ctxDrain, cancelDrain := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancelDrain()
+	if !mgr.DrainUntil(ctxDrain) {
+		t.Fatalf("drain timeout")
+	}
+	second := postEvent(t, mux, `{"product_id":"dlq-b","stock":2}`)
+	if !mgr.DrainUntil(ctxDrain) {
+		t.Fatalf("drain timeout")
+	}
+	if n := len(mgr.DeadLetters()); n != 2 {
+		t.Fatalf("expected 2 dead letters, got %d", n)
+	}
+
+	st.broken.Store(false)
+	mgr.Pause()
+	r := httptest.NewRequest(http.MethodPost, "/admin/dlq", nil)
+	pw := httptest.NewRecorder()
+	mux.ServeHTTP(pw, r)
+	var body struct {
+		Error     string   `json:"error"`
+		Replayed  int      `json:"replayed"`
+		Sequences []uint64 `json:"sequences"`
+	}
+	if err := json.Unmarshal(pw.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if pw.Code != http.StatusTooManyRequests || pw.Header().Get("Retry-After") == "" || body.Error != "queue_full" ||
+		body.Replayed != 1 || len(body.Sequences) != 1 || body.Sequences[0] != first.Sequence {
+		t.Fatalf("unexpected partial replay: %d %s", pw.Code, pw.Body.String())
+	}
+	if dead := mgr.DeadLetters(); len(dead) != 1 || dead[0].Sequence != second.Sequence {
+		t.Fatalf("expected the refused event left in the DLQ: %+v", dead)
+	}
+	if s, _, _ := mgr.EventStatus(second.Sequence); s.Status != queue.StatusDropped {
+		t.Fatalf("refused event status %q, want dropped", s.Status)
+	}
+	mgr.Resume()
+	if !mgr.DrainUntil(ctxDrain) {
+		t.Fatalf("drain timeout")
+	}
+	if s, _, _ := mgr.EventStatus(first.Sequence); s.Status != queue.StatusApplied {
+		t.Fatalf("replayed event status %q, want applied", s.Status)
+	}
+}
@@ -3,7 +3,10 @@ package httpapi
 
 import (
 	"encoding/json"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 )
 
 // jsonError represents a JSON error payload.
@@ -18,3 +21,28 @@ func WriteJSONError(w http.ResponseWriter, status int, message, details string)
 	w.WriteHeader(status)
 	_ = json.NewEncoder(w).Encode(jsonError{Error: message, Details: details})
 }
+
+// writeJSON writes v as a JSON payload with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeQueueFull answers 429 with a Retry-After hint when the bounded queue
+// refuses an event.
+func (a *App) writeQueueFull(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", a.retryAfter())
+	WriteJSONError(w, http.StatusTooManyRequests, "queue_full", fmt.Sprintf("queue is at capacity (%d events)", a.Cfg.QueueCapacity))
+}
+
+// retryAfter is the Retry-After value, in whole seconds, sent with 429.
+func (a *App) retryAfter() string {
+	return strconv.Itoa(int(math.Max(1, math.Ceil(a.Cfg.QueueRetryAfter.Seconds()))))
+}
+
+// notDurableDetails explains a not_durable answer for the event queued as
+// seq: it will be applied, so the client should not resend it.
+func notDurableDetails(seq uint64) string {
+	return fmt.Sprintf("queued as sequence %d but the queue journal failed to sync it to disk; do not resend, check GET /events/%d", seq, seq)
+}
@@ -1,9 +1,15 @@
 package httpapi
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fairyhunter13/product-update-service-simulator/internal/config"
@@ -12,15 +18,28 @@ import (
 	"github.com/fairyhunter13/product-update-service-simulator/internal/obs"
 	"github.com/fairyhunter13/product-update-service-simulator/internal/queue"
 	"github.com/fairyhunter13/product-update-service-simulator/internal/store"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/webhook"
 )
 
 // App wires configuration, store, and queue manager for HTTP handlers.
 type App struct {
-	Cfg     config.Config
-	Store   *store.Store
-	Manager *queue.Manager
-	closing bool
-	started time.Time
+	Cfg      config.Config
+	Store    store.ProductStore
+	Manager  *queue.Manager
+	Webhooks *webhook.Dispatcher
+	closing  bool
+	started  time.Time
+	batch    batchMetrics
+	sse      sseMetrics
+	requests requestMetrics
+	// readiness holds the /readyz checks; ready is the last reported
+	// outcome, for logging transitions.
+	readiness []readinessCheck
+	ready     atomic.Bool
+	idem      *idempotencyCache
+
+	streamsOnce sync.Once
+	streamsDone chan struct{}
 }
 
 type ack struct {
@@ -36,11 +55,35 @@ type ack struct {
 	BacklogSize int `json:"backlog_size"`
 	// WorkerCount is the number of workers.
 	WorkerCount int `json:"worker_count"`
+	// Priority is the lane the event was queued in.
+	Priority string `json:"priority"`
+	// BacklogByPriority is the current backlog per priority lane.
+	BacklogByPriority map[string]int `json:"backlog_by_priority"`
+	// EffectiveAt is set when the event is held until that time.
+	EffectiveAt *time.Time `json:"effective_at,omitempty"`
 }
 
 // NewApp constructs an App.
-func NewApp(cfg config.Config, st *store.Store, m *queue.Manager) *App {
-	return &App{Cfg: cfg, Store: st, Manager: m, started: time.Now()}
+func NewApp(cfg config.Config, st store.ProductStore, m *queue.Manager) *App {
+	hooks := webhook.New(m.Changes(), webhook.Options{
+		MaxAttempts:    cfg.WebhookMaxAttempts,
+		Backoff:        cfg.WebhookBackoff,
+		MaxBackoff:     cfg.WebhookMaxBackoff,
+		QueueSize:      cfg.WebhookQueueSize,
+		Timeout:        cfg.WebhookTimeout,
+		DeadLetterSize: cfg.WebhookDeadLetterSize,
+	})
+	a := &App{Cfg: cfg, Store: st, Manager: m, Webhooks: hooks, started: time.Now(), requests: newRequestMetrics(), streamsDone: make(chan struct{})}
+	a.idem = newIdempotencyCache(cfg.IdempotencyTTL, cfg.IdempotencyMaxKeys)
+	a.ready.Store(true)
+	a.addDefaultReadinessChecks()
+	return a
+}
+
+// CloseStreams ends open change streams so server shutdown does not wait
+// on long-lived connections. Register it with http.Server.RegisterOnShutdown.
+func (a *App) CloseStreams() {
+	a.streamsOnce.Do(func() { close(a.streamsDone) })
 }
 
 // StartShutdown initiates graceful shutdown.
@@ -49,7 +92,23 @@ func (a *App) StartShutdown() {
 	a.Manager.CloseIntake()
 }
 
+// maxEventBodyBytes bounds the body of a single-event POST /events, the
+// same limit as one NDJSON line.
+const maxEventBodyBytes = maxStreamLineBytes
+
+// writeBodyError answers a failed read or decode of a single-event body:
+// 413 when it exceeded maxEventBodyBytes, 400 otherwise.
+func writeBodyError(w http.ResponseWriter, err error) {
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		WriteJSONError(w, http.StatusRequestEntityTooLarge, "event_too_large", fmt.Sprintf("body exceeds %d bytes", mbe.Limit))
+		return
+	}
+	WriteJSONError(w, http.StatusBadRequest, "invalid_json", err.Error())
+}
+
 func (a *App) postEventsHandler(w http.ResponseWriter, r *http.Request) {
+	received := time.Now()
 	if r.Method != http.MethodPost {
 		WriteJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "")
 		return
@@ -58,61 +117,194 @@ func (a *App) postEventsHandler(w http.ResponseWriter, r *http.Request) {
 		WriteJSONError(w, http.StatusServiceUnavailable, "shutting_down", "")
 		return
 	}
-	ct := r.Header.Get("Content-Type")
-	if !strings.HasPrefix(strings.ToLower(ct), "application/json") {
-		WriteJSONError(w, http.StatusUnsupportedMediaType, "unsupported_media_type", "expected application/json")
+	prio, ok := requestPriority(r)
+	if !ok {
+		WriteJSONError(w, http.StatusBadRequest, "validation_error", "X-Priority must be high, normal or low")
 		return
 	}
-	var ev model.Event
-	dec := json.NewDecoder(r.Body)
-	dec.DisallowUnknownFields()
-	if err := dec.Decode(&ev); err != nil {
-		WriteJSONError(w, http.StatusBadRequest, "invalid_json", err.Error())
+	if isNDJSON(r) {
+		if r.Header.Get(idempotencyHeader) != "" {
+			WriteJSONError(w, http.StatusBadRequest, "validation_error", "Idempotency-Key is not supported on NDJSON streams")
+			return
+		}
+		a.postEventsStreamHandler(w, r, prio)
 		return
 	}
-	if ev.ProductID == "" {
-		WriteJSONError(w, http.StatusBadRequest, "validation_error", "product_id is required")
+	if !isJSON(r) {
+		WriteJSONError(w, http.StatusUnsupportedMediaType, "unsupported_media_type", "expected application/json or application/x-ndjson")
 		return
 	}
-	if ev.Price != nil && *ev.Price < 0 {
-		WriteJSONError(w, http.StatusBadRequest, "validation_error", "price must be >= 0")
+	// Bound the body before anything buffers it, Idempotency-Key hashing
+	// included.
+	r.Body = http.MaxBytesReader(w, r.Body, maxEventBodyBytes)
+	claim, ok := a.claimIdempotency(w, r, prio)
+	if !ok {
 		return
 	}
-	if ev.Stock != nil && *ev.Stock < 0 {
-		WriteJSONError(w, http.StatusBadRequest, "validation_error", "stock must be >= 0")
+	if claim != nil {
+		// Forget the key unless the ack below completes it, so a retry of a
+		// rejected request is processed afresh.
+		defer a.idem.release(claim)
+	}
+	_, decodeSpan := a.Manager.Tracer().Start(r.Context(), "event.decode")
+	var ev model.Event
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&ev); err != nil {
+		decodeSpan.RecordError(err)
+		decodeSpan.End()
+		writeBodyError(w, err)
+		return
+	}
+	ev = withPriority(ev, prio)
+	if msg := a.validateEvent(ev); msg != "" {
+		decodeSpan.RecordError(errors.New(msg))
+		decodeSpan.End()
+		WriteJSONError(w, http.StatusBadRequest, "validation_error", msg)
 		return
 	}
+	decodeSpan.End()
+	ev.ReceivedAt = received
+	ev = a.schedule(ev)
 	seq := a.Manager.NextSequence()
 	ev.Sequence = seq
-	ok := a.Manager.Enqueue(ev)
-	if !ok {
+	status := statusAccepted
+	if ev.EffectiveAt != nil {
+		status = statusScheduled
+	}
+	enqSpan := a.startEnqueue(r.Context(), 1)
+	err := a.Manager.Offer(traced(r.Context(), enqSpan, ev))
+	enqSpan.RecordError(err)
+	enqSpan.End()
+	switch {
+	case errors.Is(err, queue.ErrQueueFull):
+		a.writeQueueFull(w)
+		return
+	case errors.Is(err, queue.ErrEventDropped):
+		status = statusDropped
+	case errors.Is(err, queue.ErrNotDurable):
+		// The event is queued and will be applied: keep the key so a
+		// keyed retry replays this answer instead of queueing it again.
+		body, _ := json.Marshal(jsonError{Error: "not_durable", Details: notDurableDetails(seq)})
+		body = append(body, '\n')
+		if claim != nil {
+			a.idem.complete(claim, http.StatusInternalServerError, body)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write(body)
+		return
+	case err != nil:
 		WriteJSONError(w, http.StatusServiceUnavailable, "shutting_down", "")
 		return
 	}
 	enqTime := time.Now().UTC().Format(time.RFC3339)
 	ac := ack{
-		Status:      "accepted",
-		RequestID:   RequestIDFromContext(r.Context()),
-		Sequence:    seq,
-		ProductID:   ev.ProductID,
-		ReceivedAt:  enqTime,
-		QueueDepth:  a.Manager.QueueDepth(),
-		BacklogSize: a.Manager.BacklogSize(),
-		WorkerCount: a.Manager.WorkerCount(),
+		Status:            status,
+		RequestID:         RequestIDFromContext(r.Context()),
+		Sequence:          seq,
+		ProductID:         ev.ProductID,
+		ReceivedAt:        enqTime,
+		QueueDepth:        a.Manager.QueueDepth(),
+		BacklogSize:       a.Manager.BacklogSize(),
+		WorkerCount:       a.Manager.WorkerCount(),
+		Priority:          eventPriority(ev),
+		BacklogByPriority: a.Manager.LaneBacklog(),
+		EffectiveAt:       ev.EffectiveAt,
+	}
+	body, _ := json.Marshal(ac)
+	body = append(body, '\n')
+	if claim != nil {
+		a.idem.complete(claim, http.StatusAccepted, body)
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted)
-	_ = json.NewEncoder(w).Encode(ac)
+	_, _ = w.Write(body)
 	obs.Logger.Info("event_accepted",
 		"request_id", ac.RequestID,
+		"trace_id", traceID(r.Context()),
+		"status", ac.Status,
 		"sequence", ac.Sequence,
 		"product_id", ac.ProductID,
+		"priority", ac.Priority,
 		"queue_depth", ac.QueueDepth,
 		"backlog_size", ac.BacklogSize,
 		"worker_count", ac.WorkerCount,
 	)
 }
 
+// validateEvent returns a validation message, or "" when ev is valid.
+func (a *App) validateEvent(ev model.Event) string {
+	if ev.ProductID == "" {
+		return "product_id is required"
+	}
+	if ev.Price != nil && *ev.Price < 0 {
+		return "price must be >= 0"
+	}
+	if ev.Stock != nil && *ev.Stock < 0 {
+		return "stock must be >= 0"
+	}
+	if !queue.ValidPriority(ev.Priority) {
+		return "priority must be high, normal or low"
+	}
+	return a.validateVersion(ev)
+}
+
+// validateVersion checks the client ordering fields. Under version
+// ordering an event without one could never supersede anything, so it is
+// required there.
+func (a *App) validateVersion(ev model.Event) string {
+	order, _ := store.ParseOrdering(a.Cfg.OrderingMode)
+	switch {
+	case ev.Version != nil && ev.SourceTimestamp != nil:
+		return "set version or source_timestamp, not both"
+	case ev.Version != nil && *ev.Version == 0:
+		return "version must be >= 1"
+	case ev.SourceTimestamp != nil && ev.SourceTimestamp.UnixNano() <= 0:
+		return "source_timestamp must be after 1970-01-01T00:00:00Z"
+	case ev.Version == nil && ev.SourceTimestamp == nil && order == store.OrderVersion:
+		return "version or source_timestamp is required in version ordering mode"
+	}
+	return ""
+}
+
+// schedule clears an effective_at that is not in the future, so only
+// events that must wait are held.
+func (a *App) schedule(ev model.Event) model.Event {
+	if ev.EffectiveAt != nil && !ev.EffectiveAt.After(a.Manager.Now()) {
+		ev.EffectiveAt = nil
+	}
+	return ev
+}
+
+// requestPriority returns the X-Priority header, the priority of events in
+// the request that do not set one, and whether it is valid.
+func requestPriority(r *http.Request) (string, bool) {
+	p := strings.ToLower(strings.TrimSpace(r.Header.Get("X-Priority")))
+	return p, queue.ValidPriority(p)
+}
+
+// withPriority applies the request priority to an event without one.
+func withPriority(ev model.Event, prio string) model.Event {
+	if ev.Priority == "" {
+		ev.Priority = prio
+	}
+	return ev
+}
+
+// eventPriority returns the lane name of ev.
+func eventPriority(ev model.Event) string {
+	if ev.Priority == "" {
+		return queue.PriorityNormal
+	}
+	return ev.Priority
+}
+
+// isJSON reports whether the request declares a JSON body.
+func isJSON(r *http.Request) bool {
+	return strings.HasPrefix(strings.ToLower(r.Header.Get("Content-Type")), "application/json")
+}
+
 func (a *App) getProductHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		WriteJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "")
@@ -128,15 +320,91 @@ func (a *App) getProductHandler(w http.ResponseWriter, r *http.Request) {
 		WriteJSONError(w, http.StatusNotFound, "not_found", "")
 		return
 	}
+	if !a.waitForSequence(w, r, id) {
+		return
+	}
 	p, ok := a.Store.Get(id)
 	if !ok {
 		WriteJSONError(w, http.StatusNotFound, "not_found", "")
 		return
 	}
+	if seq, ok := a.Store.LastSequence(id); ok {
+		w.Header().Set("X-Last-Sequence", strconv.FormatUint(seq, 10))
+	}
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(p)
 }
 
+// waitForSequence implements read-your-writes for product reads. When the
+// request carries min_sequence (query) or X-Min-Sequence (header), it blocks
+// until the product has applied that sequence or the wait times out. It
+// writes the error response itself and reports whether to continue.
+func (a *App) waitForSequence(w http.ResponseWriter, r *http.Request, id string) bool {
+	raw := r.URL.Query().Get("min_sequence")
+	if raw == "" {
+		raw = r.Header.Get("X-Min-Sequence")
+	}
+	if raw == "" {
+		return true
+	}
+	minSeq, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		WriteJSONError(w, http.StatusBadRequest, "invalid_min_sequence", "min_sequence must be a non-negative integer")
+		return false
+	}
+	timeout := a.Cfg.ReadWaitDefault
+	rawTimeout := r.URL.Query().Get("timeout_ms")
+	if rawTimeout == "" {
+		rawTimeout = r.Header.Get("X-Wait-Timeout-Ms")
+	}
+	if rawTimeout != "" {
+		ms, err := strconv.Atoi(rawTimeout)
+		if err != nil || ms < 0 {
+			WriteJSONError(w, http.StatusBadRequest, "invalid_timeout", "timeout_ms must be a non-negative integer")
+			return false
+		}
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+	if timeout > a.Cfg.ReadWaitMax {
+		timeout = a.Cfg.ReadWaitMax
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	if err := store.WaitForSequence(ctx, a.Store, id, minSeq); err != nil {
+		last, _ := a.Store.LastSequence(id)
+		w.Header().Set("X-Last-Sequence", strconv.FormatUint(last, 10))
+		WriteJSONError(w, http.StatusGatewayTimeout, "sequence_wait_timeout",
+			fmt.Sprintf("product %q reached sequence %d, waited %s for %d", id, last, timeout, minSeq))
+		return false
+	}
+	return true
+}
+
+// getEventStatusHandler reports the processing status of a sequence.
+func (a *App) getEventStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "")
+		return
+	}
+	raw := strings.TrimPrefix(r.URL.Path, "/events/")
+	seq, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil || seq == 0 {
+		WriteJSONError(w, http.StatusBadRequest, "validation_error", "sequence must be a positive integer")
+		return
+	}
+	st, ok, expired := a.Manager.EventStatus(seq)
+	if !ok {
+		details := ""
+		if expired {
+			details = "sequence is outside the status retention window"
+		}
+		WriteJSONError(w, http.StatusNotFound, "not_found", details)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(st)
+}
+
 // healthHandler returns a simple health check response.
 func (a *App) healthHandler(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -147,6 +415,8 @@ func (a *App) healthHandler(w http.ResponseWriter, _ *http.Request) {
 // metricsHandler returns queue metrics.
 func (a *App) metricsHandler(w http.ResponseWriter, _ *http.Request) {
 	enq, proc, backlog, depth := a.Manager.QueueMetrics()
+	retries, deadLettered, dlqSize, dlqEvicted := a.Manager.ApplyMetrics()
+	crashes, restarts, poisoned := a.Manager.CrashMetrics()
 	m := map[string]any{
 		"events_enqueued":  enq,
 		"events_processed": proc,
@@ -154,7 +424,57 @@ func (a *App) metricsHandler(w http.ResponseWriter, _ *http.Request) {
 		"queue_depth":      depth,
 		"worker_count":     a.Manager.WorkerCount(),
 		"uptime_sec":       time.Since(a.started).Seconds(),
+
+		"apply_retries":        retries,
+		"events_dead_lettered": deadLettered,
+		"dlq_size":             dlqSize,
+		"dlq_evicted":          dlqEvicted,
+		"worker_crashes":       crashes,
+		"worker_restarts":      restarts,
+		"poison_events":        poisoned,
+
+		"batches_received":      a.batch.received.Load(),
+		"batches_rejected":      a.batch.rejected.Load(),
+		"batch_events_accepted": a.batch.eventsAccepted.Load(),
+		"batch_events_rejected": a.batch.eventsRejected.Load(),
+
+		"change_log_size":       a.Manager.Changes().Len(),
+		"change_stream_clients": a.sse.subscribers.Load(),
+		"change_stream_sent":    a.sse.sent.Load(),
+		"change_stream_lagged":  a.sse.lagged.Load(),
+	}
+	ov := a.Manager.OverloadStats()
+	m["queue_capacity"] = ov.Capacity
+	m["queue_overload_policy"] = ov.Policy
+	m["queue_rejected"] = ov.Rejected
+	m["queue_dropped_oldest"] = ov.DroppedOldest
+	m["queue_dropped_newest"] = ov.DroppedNewest
+	m["queue_coalesced"] = ov.Coalesced
+	m["queue_merged"], m["queue_merge_ratio"] = a.Manager.CoalesceStats()
+	m["backlog_by_priority"] = a.Manager.LaneBacklog()
+	order, _ := store.ParseOrdering(a.Cfg.OrderingMode)
+	m["ordering_mode"] = order
+	m["events_skipped"] = a.Manager.SkipStats()
+	m["scheduled_events"], m["scheduled_released"], m["scheduled_cancelled"] = a.Manager.ScheduledStats()
+	queueWait, apply, endToEnd := a.Manager.Latencies()
+	target, breaches := a.Manager.SLOStats()
+	m["latency"] = map[string]obs.LatencySnapshot{
+		"queue_wait": queueWait.Snapshot(),
+		"apply":      apply.Snapshot(),
+		"end_to_end": endToEnd.Snapshot(),
 	}
+	m["slo_latency_target_ms"] = target.Milliseconds()
+	m["slo_breaches"] = breaches
+	m["idempotency_keys"] = a.idem.size()
+	m["idempotency_replays"] = a.idem.replays.Load()
+	m["idempotency_conflicts"] = a.idem.conflicts.Load()
+	m["idempotency_evicted"] = a.idem.evicted.Load()
+	wm := a.Webhooks.Metrics()
+	m["webhook_subscriptions"] = wm.Subscriptions
+	m["webhook_delivered"] = wm.Delivered
+	m["webhook_failed_attempts"] = wm.FailedAttempts
+	m["webhook_dead_lettered"] = wm.DeadLettered
+	m["webhook_missed"] = wm.Missed
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(m)
 }
@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -16,6 +19,8 @@ import (
 	"github.com/fairyhunter13/product-update-service-simulator/internal/obs"
 	"github.com/fairyhunter13/product-update-service-simulator/internal/queue"
 	"github.com/fairyhunter13/product-update-service-simulator/internal/store"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/tracing"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/webhook"
 )
 
 type ackResp struct {
@@ -116,12 +121,14 @@ func setupApp(t *testing.T) (*App, *queue.Manager, context.CancelFunc, http.Hand
 	_ = os.Setenv("WORKER_COUNT", "1")
 	cfg := config.Load()
 	obs.InitLogger()
-	st := store.New()
+	order, _ := store.ParseOrdering(cfg.OrderingMode)
+	st := store.NewOrdered(order)
 	q := queue.New(128)
 	mgr := queue.NewManager(cfg, q, st)
 	ctx, cancel := context.WithCancel(context.Background())
 	mgr.Start(ctx)
 	app := NewApp(cfg, st, mgr)
+	app.Webhooks.Start(ctx)
 	mux := NewRouter(app)
 	return app, mgr, func() { cancel(); mgr.Stop() }, mux
 }
@@ -252,3 +259,544 @@ func TestShutdownBehavior(t *testing.T) {
 		t.Fatalf("expected 503, got %d", w.Code)
 	}
 }
+
+func TestGetEventStatus(t *testing.T) {
+	_, mgr, cleanup, mux := setupApp(t)
+	defer cleanup()
+	r := httptest.NewRequest(http.MethodPost, "/events", bytes.NewBufferString(`{"product_id":"st-1","price":2}`))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	var ac ackResp
+	if err := json.Unmarshal(w.Body.Bytes(), &ac); err != nil {
+		t.Fatalf("decode ack: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if ok := mgr.DrainUntil(ctx); !ok {
+		t.Fatalf("drain timeout")
+	}
+	gr := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/events/%d", ac.Sequence), nil)
+	gw := httptest.NewRecorder()
+	mux.ServeHTTP(gw, gr)
+	if gw.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", gw.Code)
+	}
+	var st queue.EventStatus
+	if err := json.Unmarshal(gw.Body.Bytes(), &st); err != nil {
+		t.Fatalf("decode status: %v", err)
+	}
+	if st.Status != queue.StatusApplied || st.ProductID != "st-1" || st.Sequence != ac.Sequence {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+	for path, code := range map[string]int{"/events/999999": http.StatusNotFound, "/events/abc": http.StatusBadRequest} {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != code {
+			t.Fatalf("%s: expected %d, got %d", path, code, rr.Code)
+		}
+	}
+}
+
+func TestGetProduct_MinSequence(t *testing.T) {
+	_, _, cleanup, mux := setupApp(t)
+	defer cleanup()
+	r := httptest.NewRequest(http.MethodPost, "/events", bytes.NewBufferString(`{"product_id":"ryw-1","price":3}`))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	var ac ackResp
+	if err := json.Unmarshal(w.Body.Bytes(), &ac); err != nil {
+		t.Fatalf("decode ack: %v", err)
+	}
+	// No drain: the read itself waits for the worker to apply the event.
+	gr := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/products/ryw-1?min_sequence=%d&timeout_ms=2000", ac.Sequence), nil)
+	gw := httptest.NewRecorder()
+	mux.ServeHTTP(gw, gr)
+	if gw.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", gw.Code, gw.Body.String())
+	}
+	var p model.Product
+	if err := json.Unmarshal(gw.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decode product: %v", err)
+	}
+	if p.Price != 3 {
+		t.Fatalf("unexpected product: %+v", p)
+	}
+	if got := gw.Header().Get("X-Last-Sequence"); got != fmt.Sprint(ac.Sequence) {
+		t.Fatalf("expected X-Last-Sequence %d, got %q", ac.Sequence, got)
+	}
+
+	hr := httptest.NewRequest(http.MethodGet, "/products/ryw-1", nil)
+	hr.Header.Set("X-Min-Sequence", fmt.Sprint(ac.Sequence+100))
+	hr.Header.Set("X-Wait-Timeout-Ms", "20")
+	hw := httptest.NewRecorder()
+	mux.ServeHTTP(hw, hr)
+	if hw.Code != http.StatusGatewayTimeout {
+		t.Fatalf("expected 504, got %d", hw.Code)
+	}
+
+	br := httptest.NewRequest(http.MethodGet, "/products/ryw-1?min_sequence=x", nil)
+	bw := httptest.NewRecorder()
+	mux.ServeHTTP(bw, br)
+	if bw.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", bw.Code)
+	}
+}
+
+func TestAdminWebhooks(t *testing.T) {
+	_, _, cleanup, mux := setupApp(t)
+	defer cleanup()
+	received := make(chan string, 4)
+	recv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get(webhook.HeaderSequence)
+	}))
+	defer recv.Close()
+
+	body := fmt.Sprintf(`{"url":%q,"product_ids":["wh-1"],"secret":"k"}`, recv.URL)
+	r := httptest.NewRequest(http.MethodPost, "/admin/webhooks", bytes.NewBufferString(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var sub webhook.Subscription
+	if err := json.Unmarshal(w.Body.Bytes(), &sub); err != nil || sub.ID == "" {
+		t.Fatalf("decode subscription: %v %+v", err, sub)
+	}
+	if strings.Contains(w.Body.String(), `"k"`) {
+		t.Fatalf("secret must not be echoed: %s", w.Body.String())
+	}
+
+	ac := postEvent(t, mux, `{"product_id":"wh-1","price":4}`)
+	select {
+	case seq := <-received:
+		if seq != fmt.Sprint(ac.Sequence) {
+			t.Fatalf("expected delivery of %d, got %s", ac.Sequence, seq)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("webhook not delivered")
+	}
+
+	del := httptest.NewRecorder()
+	mux.ServeHTTP(del, httptest.NewRequest(http.MethodDelete, "/admin/webhooks/"+sub.ID, nil))
+	if del.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", del.Code)
+	}
+	get := httptest.NewRecorder()
+	mux.ServeHTTP(get, httptest.NewRequest(http.MethodGet, "/admin/webhooks/"+sub.ID, nil))
+	if get.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 after delete, got %d", get.Code)
+	}
+
+	bad := httptest.NewRequest(http.MethodPost, "/admin/webhooks", bytes.NewBufferString(`{"url":"nope","secret":"k"}`))
+	bad.Header.Set("Content-Type", "application/json")
+	bw := httptest.NewRecorder()
+	mux.ServeHTTP(bw, bad)
+	if bw.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", bw.Code)
+	}
+	dl := httptest.NewRecorder()
+	mux.ServeHTTP(dl, httptest.NewRequest(http.MethodGet, "/admin/webhooks/dead-letters", nil))
+	if dl.Code != http.StatusOK || !strings.Contains(dl.Body.String(), "dead_letters") {
+		t.Fatalf("unexpected dead letters response: %d %s", dl.Code, dl.Body.String())
+	}
+}
+
+func TestAdminWorkers(t *testing.T) {
+	_, mgr, cleanup, mux := setupApp(t)
+	defer cleanup()
+
+	patch := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPatch, "/admin/workers", bytes.NewBufferString(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+	if w := patch(`{"min":5,"max":2}`); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "validation_error") {
+		t.Fatalf("expected 400 validation_error, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := patch(`{"workers":3}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown field, got %d", w.Code)
+	}
+	w := patch(`{"min":1,"max":4,"current":3,"pin":true,"scaler":{"policy":"proportional","max_step":2}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var p queue.PoolSettings
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if p.Current != 3 || !p.Pinned || p.Scaler.Policy != "proportional" || p.Scaler.MaxStep != 2 {
+		t.Fatalf("unexpected pool settings: %+v", p)
+	}
+
+	pause := httptest.NewRecorder()
+	mux.ServeHTTP(pause, httptest.NewRequest(http.MethodPost, "/admin/workers/pause", nil))
+	if pause.Code != http.StatusOK || !mgr.Pool().Paused {
+		t.Fatalf("pause failed: %d %s", pause.Code, pause.Body.String())
+	}
+	ac := postEvent(t, mux, `{"product_id":"paused-1","price":2}`)
+	time.Sleep(50 * time.Millisecond)
+	if st, _, _ := mgr.EventStatus(ac.Sequence); st.Status == queue.StatusApplied {
+		t.Fatalf("event applied while paused")
+	}
+	resume := httptest.NewRecorder()
+	mux.ServeHTTP(resume, httptest.NewRequest(http.MethodPost, "/admin/workers/resume", nil))
+	if resume.Code != http.StatusOK || mgr.Pool().Paused {
+		t.Fatalf("resume failed: %d %s", resume.Code, resume.Body.String())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if !mgr.DrainUntil(ctx) {
+		t.Fatalf("drain timeout after resume")
+	}
+	get := httptest.NewRecorder()
+	mux.ServeHTTP(get, httptest.NewRequest(http.MethodGet, "/admin/workers", nil))
+	if get.Code != http.StatusOK || !strings.Contains(get.Body.String(), `"paused":false`) {
+		t.Fatalf("unexpected GET: %d %s", get.Code, get.Body.String())
+	}
+}
+
+func TestPostEvents_QueueFull(t *testing.T) {
+	t.Setenv("QUEUE_CAPACITY", "1")
+	t.Setenv("QUEUE_RETRY_AFTER_S", "3")
+	_, mgr, cleanup, mux := setupApp(t)
+	defer cleanup()
+	mgr.Pause()
+	defer mgr.Resume()
+
+	postEvent(t, mux, `{"product_id":"full-1","price":1}`)
+	r := httptest.NewRequest(http.MethodPost, "/events", bytes.NewBufferString(`{"product_id":"full-2","price":1}`))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "3" || !strings.Contains(w.Body.String(), "queue_full") {
+		t.Fatalf("expected 429 queue_full with Retry-After 3, got %d %q %s", w.Code, w.Header().Get("Retry-After"), w.Body.String())
+	}
+
+	br := httptest.NewRequest(http.MethodPost, "/events:batch", bytes.NewBufferString(`[{"product_id":"full-3","price":1}]`))
+	br.Header.Set("Content-Type", "application/json")
+	bw := httptest.NewRecorder()
+	mux.ServeHTTP(bw, br)
+	if bw.Code != http.StatusTooManyRequests || bw.Header().Get("Retry-After") != "3" {
+		t.Fatalf("expected batch 429, got %d: %s", bw.Code, bw.Body.String())
+	}
+
+	mw := httptest.NewRecorder()
+	mux.ServeHTTP(mw, httptest.NewRequest(http.MethodGet, "/debug/metrics", nil))
+	var m map[string]any
+	if err := json.Unmarshal(mw.Body.Bytes(), &m); err != nil {
+		t.Fatalf("decode metrics: %v", err)
+	}
+	if m["queue_rejected"] != float64(2) || m["queue_overload_policy"] != "reject" {
+		t.Fatalf("unexpected overload metrics: %v %v", m["queue_rejected"], m["queue_overload_policy"])
+	}
+}
+
+func TestPostEvents_Priority(t *testing.T) {
+	_, mgr, cleanup, mux := setupApp(t)
+	defer cleanup()
+	mgr.Pause()
+	defer mgr.Resume()
+
+	r := httptest.NewRequest(http.MethodPost, "/events", bytes.NewBufferString(`{"product_id":"prio-1","stock":0}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Priority", "high")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var ac struct {
+		Priority          string         `json:"priority"`
+		BacklogByPriority map[string]int `json:"backlog_by_priority"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &ac); err != nil {
+		t.Fatalf("decode ack: %v", err)
+	}
+	if ac.Priority != "high" || ac.BacklogByPriority["high"] != 1 {
+		t.Fatalf("expected high lane ack, got %+v", ac)
+	}
+
+	// The body field wins over the header.
+	r = httptest.NewRequest(http.MethodPost, "/events", bytes.NewBufferString(`{"product_id":"prio-2","price":1,"priority":"low"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Priority", "high")
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if err := json.Unmarshal(w.Body.Bytes(), &ac); err != nil || ac.Priority != "low" || ac.BacklogByPriority["low"] != 1 {
+		t.Fatalf("expected low lane ack, got %d %s", w.Code, w.Body.String())
+	}
+
+	for _, c := range []struct{ header, body string }{
+		{"urgent", `{"product_id":"prio-3","price":1}`},
+		{"", `{"product_id":"prio-3","price":1,"priority":"urgent"}`},
+	} {
+		r = httptest.NewRequest(http.MethodPost, "/events", bytes.NewBufferString(c.body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("X-Priority", c.header)
+		w = httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "validation_error") {
+			t.Fatalf("expected 400 for priority %q/%s, got %d", c.header, c.body, w.Code)
+		}
+	}
+
+	mw := httptest.NewRecorder()
+	mux.ServeHTTP(mw, httptest.NewRequest(http.MethodGet, "/debug/metrics", nil))
+	var m struct {
+		BacklogByPriority map[string]int `json:"backlog_by_priority"`
+	}
+	if err := json.Unmarshal(mw.Body.Bytes(), &m); err != nil {
+		t.Fatalf("decode metrics: %v", err)
+	}
+	if m.BacklogByPriority["high"] != 1 || m.BacklogByPriority["normal"] != 0 || m.BacklogByPriority["low"] != 1 {
+		t.Fatalf("unexpected lane backlog: %v", m.BacklogByPriority)
+	}
+}
+
+func TestScheduledEvents(t *testing.T) {
+	_, _, cleanup, mux := setupApp(t)
+	defer cleanup()
+
+	at := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	ac := postEvent(t, mux, `{"product_id":"sale-1","price":9.99,"effective_at":"`+at+`"}`)
+	if ac.Status != "scheduled" {
+		t.Fatalf("expected scheduled ack, got %+v", ac)
+	}
+	// An effective_at in the past is applied right away.
+	if past := postEvent(t, mux, `{"product_id":"sale-2","price":1,"effective_at":"2020-01-01T00:00:00Z"}`); past.Status != "accepted" {
+		t.Fatalf("expected past effective_at accepted, got %+v", past)
+	}
+
+	lw := httptest.NewRecorder()
+	mux.ServeHTTP(lw, httptest.NewRequest(http.MethodGet, "/events/scheduled", nil))
+	var list struct {
+		Count  int `json:"count"`
+		Events []struct {
+			Sequence  uint64 `json:"sequence"`
+			ProductID string `json:"product_id"`
+		} `json:"events"`
+	}
+	if err := json.Unmarshal(lw.Body.Bytes(), &list); err != nil || list.Count != 1 || list.Events[0].Sequence != ac.Sequence {
+		t.Fatalf("unexpected scheduled list: %s", lw.Body.String())
+	}
+
+	path := "/events/scheduled/" + strconv.FormatUint(ac.Sequence, 10)
+	dw := httptest.NewRecorder()
+	mux.ServeHTTP(dw, httptest.NewRequest(http.MethodDelete, path, nil))
+	if dw.Code != http.StatusOK || !strings.Contains(dw.Body.String(), `"cancelled"`) {
+		t.Fatalf("expected cancel 200, got %d: %s", dw.Code, dw.Body.String())
+	}
+	dw = httptest.NewRecorder()
+	mux.ServeHTTP(dw, httptest.NewRequest(http.MethodDelete, path, nil))
+	if dw.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 on second cancel, got %d", dw.Code)
+	}
+	sw := httptest.NewRecorder()
+	mux.ServeHTTP(sw, httptest.NewRequest(http.MethodGet, "/events/"+strconv.FormatUint(ac.Sequence, 10), nil))
+	if !strings.Contains(sw.Body.String(), `"status":"cancelled"`) {
+		t.Fatalf("expected cancelled status, got %s", sw.Body.String())
+	}
+}
+
+func TestPrometheusMetrics(t *testing.T) {
+	_, mgr, cleanup, mux := setupApp(t)
+	defer cleanup()
+	postEvent(t, mux, `{"product_id":"prom-1","price":3}`)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if !mgr.DrainUntil(ctx) {
+		t.Fatalf("drain timeout")
+	}
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/products/prom-1", nil))
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		"# TYPE product_update_events_enqueued_total counter\nproduct_update_events_enqueued_total 1\n",
+		"product_update_events_processed_total 1\n",
+		"product_update_worker_count 1\n",
+		"product_update_events_stale_skipped_total 0\n",
+		`product_update_scale_decisions_total{direction="up"} `,
+		`product_update_http_requests_total{route="/events",status="202"} 1`,
+		`product_update_http_requests_total{route="/products/",status="200"} 1`,
+		`product_update_http_request_duration_seconds_bucket{route="/events",status="202",le="+Inf"} 1`,
+		`product_update_http_request_duration_seconds_count{route="/products/",status="200"} 1`,
+		"# TYPE product_update_end_to_end_latency_seconds summary\n",
+		`product_update_end_to_end_latency_seconds{quantile="0.999"} `,
+		"product_update_queue_wait_seconds_count 1\n",
+		"product_update_slo_breaches_total ",
+		`product_update_events_skipped_total{reason="stale_version"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("metrics missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestTracing_PropagatesTraceparent(t *testing.T) {
+	_, mgr, cleanup, mux := setupApp(t)
+	defer cleanup()
+	exp := &tracing.MemoryExporter{}
+	mgr.SetTracer(tracing.NewTracer(exp))
+
+	const traceID, parentID = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	req := httptest.NewRequest(http.MethodPost, "/events", bytes.NewBufferString(`{"product_id":"tr-1","price":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("traceparent", "00-"+traceID+"-"+parentID+"-01")
+	req.Header.Set("X-Request-Id", "trace-req-1")
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+
+	// store.apply ends after the event is acknowledged, so poll for it.
+	byName := map[string]tracing.SpanData{}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(byName) < 5 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		for _, s := range exp.Spans() {
+			byName[s.Name] = s
+		}
+	}
+	for _, name := range []string{"POST /events", "event.decode", "event.enqueue", "queue.wait", "store.apply"} {
+		s, ok := byName[name]
+		if !ok {
+			t.Fatalf("missing span %q, have %v", name, byName)
+		}
+		if s.Context.TraceID.String() != traceID {
+			t.Fatalf("span %q trace = %s, want %s", name, s.Context.TraceID, traceID)
+		}
+	}
+	server := byName["POST /events"]
+	if server.ParentID.String() != parentID || server.Kind != tracing.KindServer {
+		t.Fatalf("server span parent = %s kind = %d", server.ParentID, server.Kind)
+	}
+	enq := byName["event.enqueue"]
+	if byName["event.decode"].ParentID != server.Context.SpanID || enq.ParentID != server.Context.SpanID {
+		t.Fatalf("decode/enqueue spans are not children of the server span")
+	}
+	apply := byName["store.apply"]
+	if apply.ParentID != enq.Context.SpanID || byName["queue.wait"].ParentID != enq.Context.SpanID {
+		t.Fatalf("worker spans are not children of the enqueue span")
+	}
+	var reqID string
+	for _, a := range apply.Attrs {
+		if a.Key == "request_id" {
+			reqID, _ = a.Value.(string)
+		}
+	}
+	if reqID != "trace-req-1" {
+		t.Fatalf("store.apply request_id = %q", reqID)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	app, mgr, cleanup, mux := setupApp(t)
+	defer cleanup()
+	type readyResp struct {
+		Status string `json:"status"`
+		Checks []struct {
+			Name, Status, Error string
+		} `json:"checks"`
+	}
+	probe := func(path string) (int, readyResp) {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var r readyResp
+		_ = json.Unmarshal(w.Body.Bytes(), &r)
+		return w.Code, r
+	}
+	failed := func(r readyResp) []string {
+		var names []string
+		for _, c := range r.Checks {
+			if c.Status != "ok" {
+				names = append(names, c.Name)
+			}
+		}
+		return names
+	}
+
+	if code, r := probe("/readyz"); code != http.StatusOK || r.Status != "ready" || len(r.Checks) != 2 {
+		t.Fatalf("expected ready with shutdown and backlog checks, got %d %+v", code, r)
+	}
+
+	var storeErr error
+	app.AddReadinessCheck("store", func() error { return storeErr })
+	storeErr = errors.New("wal append: disk full")
+	code, r := probe("/readyz")
+	if code != http.StatusServiceUnavailable || r.Status != "not_ready" || fmt.Sprint(failed(r)) != "[store]" || r.Checks[2].Error != storeErr.Error() {
+		t.Fatalf("expected store failure, got %d %+v", code, r)
+	}
+	storeErr = nil
+
+	app.Cfg.ReadyMaxBacklog = 1
+	mgr.Pause()
+	postEvent(t, mux, `{"product_id":"rdy-1","price":1}`)
+	postEvent(t, mux, `{"product_id":"rdy-2","price":1}`)
+	if _, r := probe("/readyz"); fmt.Sprint(failed(r)) != "[backlog]" {
+		t.Fatalf("expected backlog failure, got %+v", r)
+	}
+	mgr.Resume()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if !mgr.DrainUntil(ctx) {
+		t.Fatalf("drain timeout")
+	}
+
+	app.StartShutdown()
+	if code, r := probe("/readyz"); code != http.StatusServiceUnavailable || fmt.Sprint(failed(r)) != "[shutdown]" {
+		t.Fatalf("expected shutdown failure, got %d %+v", code, r)
+	}
+	if code, _ := probe("/healthz"); code != http.StatusOK {
+		t.Fatalf("liveness should stay 200 while draining, got %d", code)
+	}
+}
+
+func TestClientVersionOrdering(t *testing.T) {
+	t.Setenv("ORDERING_MODE", "version")
+	_, mgr, cleanup, mux := setupApp(t)
+	defer cleanup()
+	for body, want := range map[string]string{
+		`{"product_id":"v-1","price":1}`:                                             "version or source_timestamp is required in version ordering mode",
+		`{"product_id":"v-1","version":2,"source_timestamp":"2025-01-01T00:00:00Z"}`: "set version or source_timestamp, not both",
+		`{"product_id":"v-1","version":0}`:                                           "version must be",
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/events", bytes.NewBufferString(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), want) {
+			t.Fatalf("%s: expected 400 %q, got %d %s", body, want, w.Code, w.Body)
+		}
+	}
+
+	mgr.Pause()
+	postEvent(t, mux, `{"product_id":"v-1","price":2,"source_timestamp":"2025-01-01T00:00:02Z"}`)
+	late := postEvent(t, mux, `{"product_id":"v-1","price":1,"source_timestamp":"2025-01-01T00:00:01Z"}`)
+	mgr.Resume()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if !mgr.DrainUntil(ctx) {
+		t.Fatalf("drain timeout")
+	}
+	pw := httptest.NewRecorder()
+	mux.ServeHTTP(pw, httptest.NewRequest(http.MethodGet, "/products/v-1", nil))
+	var p model.Product
+	_ = json.Unmarshal(pw.Body.Bytes(), &p)
+	if p.Price != 2 {
+		t.Fatalf("expected the later source_timestamp to win, got %+v", p)
+	}
+	sw := httptest.NewRecorder()
+	mux.ServeHTTP(sw, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/events/%d", late.Sequence), nil))
+	var st queue.EventStatus
+	_ = json.Unmarshal(sw.Body.Bytes(), &st)
+	if st.Status != queue.StatusSuperseded || st.Reason != store.ReasonStaleVersion {
+		t.Fatalf("expected superseded with stale_version, got %+v", st)
+	}
+}
@@ -0,0 +1,203 @@
+package httpapi
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// idempotencyHeader names the request header that makes POST /events
+// safe to retry.
+const idempotencyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLen bounds a key so the cache's memory stays bounded.
+const maxIdempotencyKeyLen = 255
+
+// idemEntry is one remembered key. While the first request with the key is
+// in flight, done is open and body is nil.
+type idemEntry struct {
+	key         string
+	fingerprint [sha256.Size]byte
+	done        chan struct{}
+	completed   bool
+	status      int
+	body        []byte
+	expires     time.Time
+}
+
+// idempotencyCache maps Idempotency-Key values to the response of the
+// first request that used them. It holds at most max keys, evicting the
+// oldest, and forgets completed keys after ttl.
+type idempotencyCache struct {
+	ttl time.Duration
+	max int
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// order lists entries oldest first; with a single TTL that is also
+	// expiry order.
+	order *list.List
+
+	replays   atomic.Uint64
+	conflicts atomic.Uint64
+	evicted   atomic.Uint64
+}
+
+func newIdempotencyCache(ttl time.Duration, maxKeys int) *idempotencyCache {
+	return &idempotencyCache{ttl: ttl, max: maxKeys, now: time.Now, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+// idemOutcome is the result of idempotencyCache.begin.
+type idemOutcome int
+
+const (
+	// idemFirst: the caller owns the key and must complete or release it.
+	idemFirst idemOutcome = iota
+	// idemReplay: the key completed with the same payload.
+	idemReplay
+	// idemConflict: the key was used with a different payload.
+	idemConflict
+)
+
+// begin claims key for a request whose payload hashes to fp. A request
+// that finds the key in flight with the same payload waits for it to finish
+// (or ctx to end) and then replays or, if it was released, claims it.
+func (c *idempotencyCache) begin(ctx context.Context, key string, fp [sha256.Size]byte) (idemOutcome, *idemEntry, error) {
+	for {
+		c.mu.Lock()
+		c.expireLocked()
+		if el, ok := c.entries[key]; ok {
+			e := el.Value.(*idemEntry)
+			c.mu.Unlock()
+			if e.fingerprint != fp {
+				c.conflicts.Add(1)
+				return idemConflict, e, nil
+			}
+			select {
+			case <-e.done:
+			case <-ctx.Done():
+				return 0, nil, ctx.Err()
+			}
+			c.mu.Lock()
+			completed := e.completed
+			c.mu.Unlock()
+			if completed {
+				c.replays.Add(1)
+				return idemReplay, e, nil
+			}
+			continue
+		}
+		for c.max > 0 && c.order.Len() >= c.max {
+			c.removeLocked(c.order.Front())
+			c.evicted.Add(1)
+		}
+		e := &idemEntry{key: key, fingerprint: fp, done: make(chan struct{})}
+		c.entries[key] = c.order.PushBack(e)
+		c.mu.Unlock()
+		return idemFirst, e, nil
+	}
+}
+
+// complete stores the response for e's key and wakes waiting duplicates.
+func (c *idempotencyCache) complete(e *idemEntry, status int, body []byte) {
+	c.mu.Lock()
+	e.completed, e.status, e.body = true, status, body
+	e.expires = c.now().Add(c.ttl)
+	if el, ok := c.entries[e.key]; ok && el.Value == e {
+		// Re-queue at the back so order stays by expiry.
+		c.order.MoveToBack(el)
+	}
+	c.mu.Unlock()
+	close(e.done)
+}
+
+// release forgets an in-flight key whose request failed, so a retry can
+// claim it, and wakes waiting duplicates. It is a no-op once completed.
+func (c *idempotencyCache) release(e *idemEntry) {
+	c.mu.Lock()
+	if e.completed {
+		c.mu.Unlock()
+		return
+	}
+	if el, ok := c.entries[e.key]; ok && el.Value == e {
+		c.removeLocked(el)
+	}
+	c.mu.Unlock()
+	close(e.done)
+}
+
+// expireLocked drops completed entries past their TTL from the front.
+func (c *idempotencyCache) expireLocked() {
+	now := c.now()
+	for el := c.order.Front(); el != nil; el = c.order.Front() {
+		e := el.Value.(*idemEntry)
+		if !e.completed || now.Before(e.expires) {
+			return
+		}
+		c.removeLocked(el)
+	}
+}
+
+func (c *idempotencyCache) removeLocked(el *list.Element) {
+	delete(c.entries, el.Value.(*idemEntry).key)
+	c.order.Remove(el)
+}
+
+// size returns the number of remembered keys.
+func (c *idempotencyCache) size() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// claimIdempotency handles the Idempotency-Key of a single-event POST. It
+// returns the claimed entry (nil when the request has no key) and whether
+// the handler should go on; when it returns false the response has been
+// written: a replay of the original ack, a 409, or a 400. The fingerprint
+// covers the body and the X-Priority default, which both shape the event.
+func (a *App) claimIdempotency(w http.ResponseWriter, r *http.Request, prio string) (*idemEntry, bool) {
+	key := r.Header.Get(idempotencyHeader)
+	if key == "" {
+		return nil, true
+	}
+	if len(key) > maxIdempotencyKeyLen {
+		WriteJSONError(w, http.StatusBadRequest, "validation_error", "Idempotency-Key must be at most 255 characters")
+		return nil, false
+	}
+	// r.Body is bounded by maxEventBodyBytes (see postEventsHandler).
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeBodyError(w, err)
+		return nil, false
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	h := sha256.New()
+	_, _ = h.Write([]byte(prio + "\n"))
+	_, _ = h.Write(body)
+	var fp [sha256.Size]byte
+	h.Sum(fp[:0])
+
+	outcome, e, err := a.idem.begin(r.Context(), key, fp)
+	switch {
+	case err != nil:
+		WriteJSONError(w, http.StatusConflict, "idempotency_key_in_use", "a request with this Idempotency-Key is still in progress")
+		return nil, false
+	case outcome == idemConflict:
+		WriteJSONError(w, http.StatusConflict, "idempotency_key_conflict", "Idempotency-Key was already used with a different payload")
+		return nil, false
+	case outcome == idemReplay:
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(e.status)
+		_, _ = w.Write(e.body)
+		return nil, false
+	}
+	return e, true
+}
@@ -0,0 +1,132 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func postWithKey(t *testing.T, mux http.Handler, key, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/events", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(idempotencyHeader, key)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestPostEvents_IdempotencyKey(t *testing.T) {
+	_, mgr, cleanup, mux := setupApp(t)
+	defer cleanup()
+
+	first := postWithKey(t, mux, "k-1", `{"product_id":"idem-1","price":5}`)
+	if first.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d %s", first.Code, first.Body)
+	}
+	var ack ackResp
+	_ = json.Unmarshal(first.Body.Bytes(), &ack)
+
+	replay := postWithKey(t, mux, "k-1", `{"product_id":"idem-1","price":5}`)
+	if replay.Code != http.StatusAccepted || replay.Header().Get("Idempotent-Replayed") != "true" || replay.Body.String() != first.Body.String() {
+		t.Fatalf("replay: %d %q %s", replay.Code, replay.Header().Get("Idempotent-Replayed"), replay.Body)
+	}
+
+	conflict := postWithKey(t, mux, "k-1", `{"product_id":"idem-1","price":6}`)
+	if conflict.Code != http.StatusConflict || !bytes.Contains(conflict.Body.Bytes(), []byte("idempotency_key_conflict")) {
+		t.Fatalf("expected 409 conflict, got %d %s", conflict.Code, conflict.Body)
+	}
+
+	// A rejected request does not consume its key.
+	if rr := postWithKey(t, mux, "k-2", `{"product_id":""}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rr.Code)
+	}
+	other := postWithKey(t, mux, "k-2", `{"product_id":"idem-1","price":7}`)
+	var otherAck ackResp
+	_ = json.Unmarshal(other.Body.Bytes(), &otherAck)
+	if other.Code != http.StatusAccepted || otherAck.Sequence <= ack.Sequence || other.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("expected a fresh ack after sequence %d, got %d %+v", ack.Sequence, other.Code, otherAck)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if !mgr.DrainUntil(ctx) {
+		t.Fatalf("drain timeout")
+	}
+	if enq, _, _, _ := mgr.QueueMetrics(); enq != 2 {
+		t.Fatalf("expected 2 events enqueued, got %d", enq)
+	}
+}
+
+func TestPostEvents_IdempotencyConcurrentDuplicates(t *testing.T) {
+	_, _, cleanup, mux := setupApp(t)
+	defer cleanup()
+	const n = 8
+	seqs := make([]uint64, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rr := postWithKey(t, mux, "dup", `{"product_id":"idem-dup","stock":1}`)
+			var ack ackResp
+			_ = json.Unmarshal(rr.Body.Bytes(), &ack)
+			seqs[i] = ack.Sequence
+		}()
+	}
+	wg.Wait()
+	for i := range seqs {
+		if seqs[i] == 0 || seqs[i] != seqs[0] {
+			t.Fatalf("duplicates got different sequences: %v", seqs)
+		}
+	}
+}
+
+func TestPostEvents_IdempotencyKeyBodyLimit(t *testing.T) {
+	_, _, cleanup, mux := setupApp(t)
+	defer cleanup()
+
+	big := `{"product_id":"idem-big","pad":"` + strings.Repeat("x", maxEventBodyBytes) + `"}`
+	if rr := postWithKey(t, mux, "k-big", big); rr.Code != http.StatusRequestEntityTooLarge || !bytes.Contains(rr.Body.Bytes(), []byte("event_too_large")) {
+		t.Fatalf("expected 413, got %d %s", rr.Code, rr.Body)
+	}
+	if rr := postWithKey(t, mux, "k-big", `{"product_id":"idem-big","price":1}`); rr.Code != http.StatusAccepted {
+		t.Fatalf("expected the refused key to stay free, got %d %s", rr.Code, rr.Body)
+	}
+}
+
+func TestIdempotencyCacheBoundedAndExpiring(t *testing.T) {
+	now := time.Unix(0, 0)
+	c := newIdempotencyCache(time.Minute, 3)
+	c.now = func() time.Time { return now }
+	fp := sha256.Sum256(nil)
+	for i := range 5 {
+		outcome, e, _ := c.begin(context.Background(), strconv.Itoa(i), fp)
+		if outcome != idemFirst {
+			t.Fatalf("key %d: outcome %d", i, outcome)
+		}
+		c.complete(e, http.StatusAccepted, []byte("ack"))
+	}
+	if c.size() != 3 || c.evicted.Load() != 2 {
+		t.Fatalf("size %d evicted %d, want 3 and 2", c.size(), c.evicted.Load())
+	}
+	if outcome, _, _ := c.begin(context.Background(), "0", fp); outcome != idemFirst {
+		t.Fatalf("evicted key was replayed")
+	}
+	now = now.Add(2 * time.Minute)
+	if outcome, _, _ := c.begin(context.Background(), "4", fp); outcome != idemFirst {
+		t.Fatalf("expired key was replayed")
+	}
+	// "0" is still in flight, so it and everything after it survive.
+	if c.size() != 2 {
+		t.Fatalf("size %d after expiry, want 2", c.size())
+	}
+}
@@ -39,6 +39,9 @@ func (w *statusRecorder) Write(b []byte) (int, error) {
 	return n, err
 }
 
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (w *statusRecorder) Unwrap() http.ResponseWriter { return w.h }
+
 // WithRequestID injects or propagates an X-Request-Id for each request.
 func WithRequestID(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
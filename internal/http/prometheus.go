@@ -0,0 +1,99 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/obs"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/queue"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/store"
+)
+
+// promPrefix namespaces every metric exposed on /metrics.
+const promPrefix = "product_update_"
+
+// requestMetrics counts HTTP requests and their latency by route and status
+// for /metrics.
+type requestMetrics struct {
+	total   *obs.CounterVec
+	latency *obs.HistogramVec
+}
+
+func newRequestMetrics() requestMetrics {
+	return requestMetrics{
+		total:   obs.NewCounterVec(promPrefix+"http_requests_total", "HTTP requests by route and status.", "route", "status"),
+		latency: obs.NewHistogramVec(promPrefix+"http_request_duration_seconds", "HTTP request latency by route and status.", obs.DefaultLatencyBuckets, "route", "status"),
+	}
+}
+
+// instrument records request counts and latency. The route label is the
+// matched ServeMux pattern, so product IDs and sequences in paths do not
+// create new series.
+func (a *App) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sr := &statusRecorder{h: w, st: 200}
+		next.ServeHTTP(sr, r)
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(sr.st)
+		a.requests.total.Inc(route, status)
+		a.requests.latency.Observe(time.Since(start).Seconds(), route, status)
+	})
+}
+
+// prometheusHandler exposes service metrics in the Prometheus text format.
+func (a *App) prometheusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "")
+		return
+	}
+	enq, proc, backlog, depth := a.Manager.QueueMetrics()
+	retries, deadLettered, dlqSize, _ := a.Manager.ApplyMetrics()
+	up, down, hold := a.Manager.ScaleDecisions()
+
+	w.Header().Set("Content-Type", obs.PromContentType)
+	p := obs.NewPromWriter(w)
+	p.Counter(promPrefix+"events_enqueued_total", "Events admitted to the queue.", float64(enq))
+	p.Counter(promPrefix+"events_processed_total", "Events finished by workers.", float64(proc))
+	p.Counter(promPrefix+"events_stale_skipped_total", "Events skipped by Store.Upsert because the product already had a newer sequence.", float64(a.Manager.StaleSkipped()))
+	skips := a.Manager.SkipStats()
+	p.Family(promPrefix+"events_skipped_total", "counter", "Events skipped by Store.Upsert, by reason.",
+		obs.PromSample{Labels: []obs.Label{{Name: "reason", Value: store.ReasonStaleSequence}}, Value: float64(skips[store.ReasonStaleSequence])},
+		obs.PromSample{Labels: []obs.Label{{Name: "reason", Value: store.ReasonStaleVersion}}, Value: float64(skips[store.ReasonStaleVersion])},
+		obs.PromSample{Labels: []obs.Label{{Name: "reason", Value: store.ReasonDuplicateVersion}}, Value: float64(skips[store.ReasonDuplicateVersion])},
+	)
+	p.Counter(promPrefix+"apply_retries_total", "Retried store applies.", float64(retries))
+	p.Counter(promPrefix+"events_dead_lettered_total", "Events moved to the dead-letter queue.", float64(deadLettered))
+	p.Gauge(promPrefix+"backlog_size", "Events waiting in the backlog.", float64(backlog))
+	p.Gauge(promPrefix+"queue_depth", "Backlog plus events buffered for workers.", float64(depth))
+	p.Gauge(promPrefix+"worker_count", "Running workers.", float64(a.Manager.WorkerCount()))
+	p.Gauge(promPrefix+"dlq_size", "Events in the dead-letter queue.", float64(dlqSize))
+	lanes := a.Manager.LaneBacklog()
+	backlogByLane := make([]obs.PromSample, 0, len(lanes))
+	for _, prio := range queue.Priorities {
+		backlogByLane = append(backlogByLane, obs.PromSample{Labels: []obs.Label{{Name: "priority", Value: prio}}, Value: float64(lanes[prio])})
+	}
+	p.Family(promPrefix+"backlog_by_priority", "gauge", "Events waiting in each priority lane.", backlogByLane...)
+	p.Family(promPrefix+"scale_decisions_total", "counter", "Scaler decisions by direction.",
+		obs.PromSample{Labels: []obs.Label{{Name: "direction", Value: "up"}}, Value: float64(up)},
+		obs.PromSample{Labels: []obs.Label{{Name: "direction", Value: "down"}}, Value: float64(down)},
+		obs.PromSample{Labels: []obs.Label{{Name: "direction", Value: "hold"}}, Value: float64(hold)},
+	)
+	queueWait, apply, endToEnd := a.Manager.Latencies()
+	queueWait.Write(p, promPrefix+"queue_wait_seconds", "Time from enqueue to worker pickup.")
+	apply.Write(p, promPrefix+"apply_duration_seconds", "Time to apply an event to the store, including retries.")
+	endToEnd.Write(p, promPrefix+"end_to_end_latency_seconds", "Time from intake to the update being visible in the store.")
+	target, breaches := a.Manager.SLOStats()
+	p.Gauge(promPrefix+"slo_latency_target_seconds", "End-to-end latency SLO target; 0 when disabled.", target.Seconds())
+	p.Counter(promPrefix+"slo_breaches_total", "Applied events whose end-to-end latency exceeded the SLO target.", float64(breaches))
+	p.Gauge(promPrefix+"idempotency_keys", "Idempotency keys remembered.", float64(a.idem.size()))
+	p.Counter(promPrefix+"idempotency_replays_total", "Requests answered with the ack of an earlier request with the same Idempotency-Key.", float64(a.idem.replays.Load()))
+	p.Counter(promPrefix+"idempotency_conflicts_total", "Requests rejected for reusing an Idempotency-Key with a different payload.", float64(a.idem.conflicts.Load()))
+	a.requests.total.Write(p)
+	a.requests.latency.Write(p)
+	_ = p.Flush()
+}
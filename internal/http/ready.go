@@ -0,0 +1,86 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/obs"
+)
+
+// errShuttingDown is the shutdown readiness failure.
+var errShuttingDown = errors.New("draining for shutdown")
+
+// readinessCheck is one named readiness condition.
+type readinessCheck struct {
+	name  string
+	check func() error
+}
+
+// checkResult is one check's outcome in the /readyz response.
+type checkResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type readyResponse struct {
+	Status string        `json:"status"`
+	Checks []checkResult `json:"checks"`
+}
+
+// AddReadinessCheck registers a check for /readyz: the service is not
+// ready while check returns an error. Checks run in registration order on
+// every probe, so they must be cheap. Register them before serving.
+func (a *App) AddReadinessCheck(name string, check func() error) {
+	a.readiness = append(a.readiness, readinessCheck{name: name, check: check})
+}
+
+// addDefaultReadinessChecks registers the shutdown and backlog checks; the
+// backlog check always passes when READY_MAX_BACKLOG is 0.
+func (a *App) addDefaultReadinessChecks() {
+	a.AddReadinessCheck("shutdown", func() error {
+		if a.Manager.IsShuttingDown() {
+			return errShuttingDown
+		}
+		return nil
+	})
+	a.AddReadinessCheck("backlog", func() error {
+		limit := a.Cfg.ReadyMaxBacklog
+		if n := a.Manager.BacklogSize(); limit > 0 && n > limit {
+			return fmt.Errorf("backlog %d exceeds %d", n, limit)
+		}
+		return nil
+	})
+}
+
+// readyHandler reports readiness to receive traffic: 200 when every check
+// passes, 503 otherwise, with a per-check breakdown. Unlike /healthz it
+// goes not-ready while draining or overloaded.
+func (a *App) readyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "")
+		return
+	}
+	resp := readyResponse{Status: "ready", Checks: make([]checkResult, 0, len(a.readiness))}
+	var failed []string
+	for _, c := range a.readiness {
+		res := checkResult{Name: c.name, Status: "ok"}
+		if err := c.check(); err != nil {
+			res.Status, res.Error = "fail", err.Error()
+			failed = append(failed, c.name)
+		}
+		resp.Checks = append(resp.Checks, res)
+	}
+	status := http.StatusOK
+	if len(failed) > 0 {
+		resp.Status, status = "not_ready", http.StatusServiceUnavailable
+	}
+	if wasReady := a.ready.Swap(len(failed) == 0); wasReady != (len(failed) == 0) {
+		obs.Logger.Info("readiness_changed", "status", resp.Status, "failed_checks", failed)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -9,11 +9,25 @@ import (
 func NewRouter(app *App) http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/events", app.postEventsHandler)
+	mux.HandleFunc("/events:batch", app.postEventsBatchHandler)
+	mux.HandleFunc("/events/", app.getEventStatusHandler)
+	mux.HandleFunc("/events/scheduled", app.scheduledHandler)
+	mux.HandleFunc("/events/scheduled/", app.scheduledEventHandler)
+	mux.HandleFunc("/products:stream", app.productStreamHandler)
 	mux.HandleFunc("/products/", app.getProductHandler)
+	mux.HandleFunc("/admin/dlq", app.dlqHandler)
+	mux.HandleFunc("/admin/webhooks", app.webhooksHandler)
+	mux.HandleFunc("/admin/webhooks/dead-letters", app.webhookDeadLettersHandler)
+	mux.HandleFunc("/admin/webhooks/", app.webhookHandler)
+	mux.HandleFunc("/admin/workers", app.workersHandler)
+	mux.HandleFunc("/admin/workers/pause", app.workersPauseHandler)
+	mux.HandleFunc("/admin/workers/resume", app.workersResumeHandler)
 	mux.HandleFunc("/healthz", app.healthHandler)
+	mux.HandleFunc("/readyz", app.readyHandler)
 	mux.HandleFunc("/debug/metrics", app.metricsHandler)
+	mux.HandleFunc("/metrics", app.prometheusHandler)
 	mux.Handle("/debug/vars", expvar.Handler())
 	mux.HandleFunc("/openapi.yaml", app.openapiHandler)
 	mux.HandleFunc("/docs", app.docsHandler)
-	return WithRequestID(WithLogging(mux))
+	return WithRequestID(WithLogging(app.instrument(app.traceRequests(mux))))
 }
@@ -0,0 +1,43 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/obs"
+)
+
+// scheduledHandler lists the events held until their effective_at.
+func (a *App) scheduledHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "")
+		return
+	}
+	held := a.Manager.ScheduledEvents()
+	writeJSON(w, http.StatusOK, map[string]any{"count": len(held), "events": held})
+}
+
+// scheduledEventHandler cancels (DELETE) one held event.
+func (a *App) scheduledEventHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		WriteJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "")
+		return
+	}
+	seq, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/events/scheduled/"), 10, 64)
+	if err != nil || seq == 0 {
+		WriteJSONError(w, http.StatusBadRequest, "validation_error", "sequence must be a positive integer")
+		return
+	}
+	ev, ok := a.Manager.CancelScheduled(seq)
+	if !ok {
+		WriteJSONError(w, http.StatusNotFound, "not_found", "no scheduled event with this sequence")
+		return
+	}
+	obs.Logger.Info("scheduled_event_cancelled",
+		"request_id", RequestIDFromContext(r.Context()),
+		"sequence", ev.Sequence,
+		"product_id", ev.ProductID,
+	)
+	writeJSON(w, http.StatusOK, map[string]any{"status": "cancelled", "event": ev})
+}
@@ -0,0 +1,147 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/changes"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/obs"
+)
+
+// sseMetrics counts change-stream subscribers and deliveries.
+type sseMetrics struct {
+	subscribers atomic.Int64
+	sent        atomic.Uint64
+	lagged      atomic.Uint64
+}
+
+// changeFilter selects the changes a subscriber receives. An empty filter
+// matches everything.
+type changeFilter struct {
+	ids    map[string]bool
+	prefix string
+}
+
+func parseChangeFilter(r *http.Request) changeFilter {
+	var f changeFilter
+	for _, v := range r.URL.Query()["product_id"] {
+		for _, id := range strings.Split(v, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				if f.ids == nil {
+					f.ids = make(map[string]bool)
+				}
+				f.ids[id] = true
+			}
+		}
+	}
+	f.prefix = r.URL.Query().Get("prefix")
+	return f
+}
+
+func (f changeFilter) match(c changes.Change) bool {
+	if f.ids != nil && !f.ids[c.ProductID] {
+		return false
+	}
+	return strings.HasPrefix(c.ProductID, f.prefix)
+}
+
+// productStreamHandler streams applied product changes as Server-Sent
+// Events. Each event carries the sequence as its id, so a reconnecting
+// client resumes with Last-Event-ID from the bounded change log.
+func (a *App) productStreamHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "")
+		return
+	}
+	log := a.Manager.Changes()
+	if log == nil {
+		WriteJSONError(w, http.StatusServiceUnavailable, "change_log_disabled", "CHANGE_LOG_SIZE is 0")
+		return
+	}
+	pos := log.Head()
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+	if lastID != "" {
+		seq, err := strconv.ParseUint(lastID, 10, 64)
+		if err != nil {
+			WriteJSONError(w, http.StatusBadRequest, "invalid_last_event_id", "Last-Event-ID must be a sequence number")
+			return
+		}
+		pos = log.Resume(seq)
+	}
+	filter := parseChangeFilter(r)
+
+	rc := http.NewResponseController(w)
+	// The stream outlives the server's per-request write deadline.
+	_ = rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	a.sse.subscribers.Add(1)
+	defer a.sse.subscribers.Add(-1)
+	reqID := RequestIDFromContext(r.Context())
+	obs.Logger.Info("change_stream_opened", "request_id", reqID, "prefix", filter.prefix, "product_ids", len(filter.ids))
+
+	heartbeat := time.NewTicker(a.Cfg.SSEHeartbeat)
+	defer heartbeat.Stop()
+	var sent uint64
+	for {
+		wake := log.Wait()
+		batch, next, missed := log.Since(pos)
+		pos = next
+		wrote := false
+		if missed > 0 {
+			// The reader fell behind the ring; tell it so it can re-read state.
+			a.sse.lagged.Add(1)
+			if _, err := fmt.Fprintf(w, "event: lagged\ndata: {\"missed\":%d}\n\n", missed); err != nil {
+				return
+			}
+			wrote = true
+		}
+		for _, c := range batch {
+			if !filter.match(c) {
+				continue
+			}
+			data, _ := json.Marshal(c)
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: change\ndata: %s\n\n", c.Sequence, data); err != nil {
+				return
+			}
+			sent++
+			a.sse.sent.Add(1)
+			wrote = true
+		}
+		if wrote {
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+		select {
+		case <-r.Context().Done():
+			obs.Logger.Info("change_stream_closed", "request_id", reqID, "sent", sent)
+			return
+		case <-a.streamsDone:
+			obs.Logger.Info("change_stream_closed", "request_id", reqID, "sent", sent, "reason", "shutdown")
+			return
+		case <-wake:
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
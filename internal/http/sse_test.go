@@ -0,0 +1,165 @@
+package httpapi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/changes"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/model"
+)
+
+// sseEvent is one parsed Server-Sent Event.
+type sseEvent struct {
+	id, event, data string
+}
+
+// readSSE parses events from br until n change events were read.
+func readSSE(t *testing.T, br *bufio.Reader, n int) []sseEvent {
+	t.Helper()
+	var out []sseEvent
+	var cur sseEvent
+	for len(out) < n {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read stream: %v (got %d events)", err, len(out))
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			if cur.event == "change" {
+				out = append(out, cur)
+			}
+			cur = sseEvent{}
+		case strings.HasPrefix(line, "id: "):
+			cur.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			cur.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			cur.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	return out
+}
+
+func postEvent(t *testing.T, h http.Handler, body string) ackResp {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/events", bytes.NewBufferString(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", w.Code)
+	}
+	var ac ackResp
+	if err := json.Unmarshal(w.Body.Bytes(), &ac); err != nil {
+		t.Fatalf("decode ack: %v", err)
+	}
+	return ac
+}
+
+// openStream connects to the change stream; reads fail after 5s.
+func openStream(t *testing.T, url, lastID string) *bufio.Reader {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected stream response: %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+func TestProductStream_FilterAndPrevious(t *testing.T) {
+	_, _, cleanup, mux := setupApp(t)
+	defer cleanup()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close) // after openStream's cleanup cancels the request
+	br := openStream(t, srv.URL+"/products:stream?prefix=sku-", "")
+	postEvent(t, mux, `{"product_id":"other","price":1}`)
+	first := postEvent(t, mux, `{"product_id":"sku-1","price":5}`)
+	second := postEvent(t, mux, `{"product_id":"sku-1","stock":2}`)
+
+	evs := readSSE(t, br, 2)
+	if evs[0].id != fmt.Sprint(first.Sequence) || evs[1].id != fmt.Sprint(second.Sequence) {
+		t.Fatalf("unexpected ids: %+v", evs)
+	}
+	var c changes.Change
+	if err := json.Unmarshal([]byte(evs[1].data), &c); err != nil {
+		t.Fatalf("decode change: %v", err)
+	}
+	if c.ProductID != "sku-1" || c.Product.Price != 5 || c.Product.Stock != 2 {
+		t.Fatalf("unexpected product in change: %+v", c)
+	}
+	if c.Previous == nil || c.Previous.Stock != 0 || c.Previous.Price != 5 {
+		t.Fatalf("unexpected previous state: %+v", c.Previous)
+	}
+}
+
+func TestProductStream_ResumeFromLastEventID(t *testing.T) {
+	_, mgr, cleanup, mux := setupApp(t)
+	defer cleanup()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close) // after openStream's cleanup cancels the request
+
+	a := postEvent(t, mux, `{"product_id":"r-1","price":1}`)
+	b := postEvent(t, mux, `{"product_id":"r-2","price":2}`)
+	c := postEvent(t, mux, `{"product_id":"r-1","price":3}`)
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer drainCancel()
+	if !mgr.DrainUntil(drainCtx) {
+		t.Fatalf("drain timeout")
+	}
+
+	br := openStream(t, srv.URL+"/products:stream?product_id=r-1", fmt.Sprint(a.Sequence))
+	evs := readSSE(t, br, 1)
+	if evs[0].id != fmt.Sprint(c.Sequence) {
+		t.Fatalf("expected resume at %d (skipping filtered %d), got %+v", c.Sequence, b.Sequence, evs)
+	}
+}
+
+func TestProductStream_BadLastEventID(t *testing.T) {
+	_, _, cleanup, mux := setupApp(t)
+	defer cleanup()
+	r := httptest.NewRequest(http.MethodGet, "/products:stream", nil)
+	r.Header.Set("Last-Event-ID", "nope")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
+
+func TestProductStream_DoesNotShadowProductID(t *testing.T) {
+	_, _, cleanup, mux := setupApp(t)
+	defer cleanup()
+	ac := postEvent(t, mux, `{"product_id":"stream","price":4}`)
+	r := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/products/stream?min_sequence=%d&timeout_ms=2000", ac.Sequence), nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var p model.Product
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decode product: %v", err)
+	}
+	if p.ProductID != "stream" || p.Price != 4 {
+		t.Fatalf("unexpected product: %+v", p)
+	}
+}
@@ -0,0 +1,180 @@
+package httpapi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/obs"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/queue"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/tracing"
+)
+
+// ndjsonContentType is the media type for newline-delimited JSON streams.
+const ndjsonContentType = "application/x-ndjson"
+
+// maxStreamLineBytes bounds a single NDJSON line.
+const maxStreamLineBytes = 1 << 20
+
+var errLineTooLong = errors.New("line exceeds 1 MiB")
+
+// streamItem is the per-line outcome written back on an NDJSON stream.
+type streamItem struct {
+	Line      int    `json:"line"`
+	Status    string `json:"status"`
+	Sequence  uint64 `json:"sequence,omitempty"`
+	ProductID string `json:"product_id,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Details   string `json:"details,omitempty"`
+}
+
+// isNDJSON reports whether the request declares an NDJSON body.
+func isNDJSON(r *http.Request) bool {
+	return strings.HasPrefix(strings.ToLower(r.Header.Get("Content-Type")), ndjsonContentType)
+}
+
+// readLine reads one newline-terminated line of at most max bytes. Longer
+// lines are discarded up to their newline and reported as errLineTooLong.
+func readLine(br *bufio.Reader, max int) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := br.ReadSlice('\n')
+		if len(line)+len(chunk) > max {
+			for errors.Is(err, bufio.ErrBufferFull) {
+				_, err = br.ReadSlice('\n')
+			}
+			if err != nil && !errors.Is(err, io.EOF) {
+				return nil, err
+			}
+			return nil, errLineTooLong
+		}
+		line = append(line, chunk...)
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		return line, err
+	}
+}
+
+// postEventsStreamHandler decodes NDJSON events one line at a time,
+// enqueues each as it arrives and streams back a per-line ack or error.
+// The body is never buffered as a whole, so one connection can carry an
+// unbounded number of events. prio is the X-Priority default.
+func (a *App) postEventsStreamHandler(w http.ResponseWriter, r *http.Request, prio string) {
+	rc := http.NewResponseController(w)
+	// Read and write concurrently, and lift the server deadlines that are
+	// meant for single-event requests.
+	_ = rc.EnableFullDuplex()
+	_ = rc.SetReadDeadline(time.Time{})
+	_ = rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", ndjsonContentType)
+	w.WriteHeader(http.StatusOK)
+	_ = rc.Flush()
+
+	reqID := RequestIDFromContext(r.Context())
+	br := bufio.NewReader(r.Body)
+	enc := json.NewEncoder(w)
+	accepted, rejected, lineNo := 0, 0, 0
+	for {
+		raw, err := readLine(br, maxStreamLineBytes)
+		if len(raw) == 0 && err != nil && !errors.Is(err, errLineTooLong) {
+			if !errors.Is(err, io.EOF) {
+				_ = enc.Encode(streamItem{Line: lineNo + 1, Status: statusRejected, Error: "stream_error", Details: err.Error()})
+			}
+			break
+		}
+		lineNo++
+		raw = bytes.TrimSpace(raw)
+		if len(raw) == 0 && !errors.Is(err, errLineTooLong) {
+			if err != nil {
+				break
+			}
+			continue
+		}
+		item := a.acceptStreamLine(r.Context(), lineNo, raw, err, prio)
+		if item.Status == statusAccepted || item.Status == statusScheduled {
+			accepted++
+		} else {
+			rejected++
+		}
+		_ = enc.Encode(item)
+		// Flush only when the next read would block, so bursts are coalesced.
+		if br.Buffered() == 0 {
+			_ = rc.Flush()
+		}
+		if item.Error == "shutting_down" || (err != nil && !errors.Is(err, errLineTooLong)) {
+			break
+		}
+	}
+	_ = rc.Flush()
+	obs.Logger.Info("event_stream_closed",
+		"request_id", reqID,
+		"trace_id", traceID(r.Context()),
+		"lines", lineNo,
+		"accepted", accepted,
+		"rejected", rejected,
+	)
+}
+
+// acceptStreamLine validates and enqueues one NDJSON line.
+func (a *App) acceptStreamLine(ctx context.Context, lineNo int, raw []byte, readErr error, prio string) streamItem {
+	received := time.Now()
+	item := streamItem{Line: lineNo, Status: statusRejected}
+	if errors.Is(readErr, errLineTooLong) {
+		item.Error, item.Details = "invalid_json", readErr.Error()
+		return item
+	}
+	_, decodeSpan := a.Manager.Tracer().Start(ctx, "event.decode", tracing.Int("line", int64(lineNo)))
+	ev, err := decodeEvent(raw)
+	if err != nil {
+		decodeSpan.RecordError(err)
+		decodeSpan.End()
+		item.Error, item.Details = "invalid_json", err.Error()
+		return item
+	}
+	item.ProductID = ev.ProductID
+	ev = withPriority(ev, prio)
+	if msg := a.validateEvent(ev); msg != "" {
+		decodeSpan.RecordError(errors.New(msg))
+		decodeSpan.End()
+		item.Error, item.Details = "validation_error", msg
+		return item
+	}
+	decodeSpan.End()
+	ev.ReceivedAt = received
+	if a.closing || a.Manager.IsShuttingDown() {
+		item.Error = "shutting_down"
+		return item
+	}
+	ev = a.schedule(ev)
+	ev.Sequence = a.Manager.NextSequence()
+	enqSpan := a.startEnqueue(ctx, 1)
+	err = a.Manager.Offer(traced(ctx, enqSpan, ev))
+	enqSpan.RecordError(err)
+	enqSpan.End()
+	switch {
+	case errors.Is(err, queue.ErrQueueFull):
+		item.Error = "queue_full"
+		return item
+	case errors.Is(err, queue.ErrEventDropped):
+		item.Status = statusDropped
+	case errors.Is(err, queue.ErrNotDurable):
+		item.Status = statusAccepted
+		item.Error, item.Details = "not_durable", notDurableDetails(ev.Sequence)
+	case err != nil:
+		item.Error = "shutting_down"
+		return item
+	case ev.EffectiveAt != nil:
+		item.Status = statusScheduled
+	default:
+		item.Status = statusAccepted
+	}
+	item.Sequence = ev.Sequence
+	return item
+}
@@ -0,0 +1,126 @@
+package httpapi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func decodeStream(t *testing.T, body io.Reader) []streamItem {
+	t.Helper()
+	var items []streamItem
+	dec := json.NewDecoder(body)
+	for {
+		var it streamItem
+		if err := dec.Decode(&it); err == io.EOF {
+			return items
+		} else if err != nil {
+			t.Fatalf("decode stream ack: %v", err)
+		}
+		items = append(items, it)
+	}
+}
+
+func TestNDJSONStream_PerLineAcks(t *testing.T) {
+	_, _, cleanup, mux := setupApp(t)
+	defer cleanup()
+	body := strings.Join([]string{
+		`{"product_id":"s-1","price":1}`,
+		``,
+		`{"product_id":"s-1","foo":1}`,
+		`{"product_id":"s-2","stock":-1}`,
+		`not json`,
+		`{"product_id":"s-2","stock":4}`,
+	}, "\n")
+	r := httptest.NewRequest(http.MethodPost, "/events", bytes.NewBufferString(body))
+	r.Header.Set("Content-Type", "application/x-ndjson")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != ndjsonContentType {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	items := decodeStream(t, w.Body)
+	if len(items) != 5 {
+		t.Fatalf("expected 5 acks, got %d: %+v", len(items), items)
+	}
+	want := []struct {
+		line   int
+		status string
+		err    string
+	}{
+		{1, statusAccepted, ""},
+		{3, statusRejected, "invalid_json"},
+		{4, statusRejected, "validation_error"},
+		{5, statusRejected, "invalid_json"},
+		{6, statusAccepted, ""},
+	}
+	for i, wnt := range want {
+		if items[i].Line != wnt.line || items[i].Status != wnt.status || items[i].Error != wnt.err {
+			t.Fatalf("item %d: got %+v, want %+v", i, items[i], wnt)
+		}
+	}
+	if items[4].Sequence <= items[0].Sequence {
+		t.Fatalf("expected increasing sequences, got %d then %d", items[0].Sequence, items[4].Sequence)
+	}
+}
+
+func TestNDJSONStream_Incremental(t *testing.T) {
+	_, _, cleanup, mux := setupApp(t)
+	defer cleanup()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	pr, pw := io.Pipe()
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/events", pr)
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	respc := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Errorf("do: %v", err)
+			close(respc)
+			return
+		}
+		respc <- resp
+	}()
+	// Each ack must arrive before the next line is sent, proving the
+	// server neither buffers the request body nor the response.
+	_, _ = fmt.Fprintln(pw, `{"product_id":"inc","price":1}`)
+	var resp *http.Response
+	select {
+	case resp = <-respc:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no response headers before body completed")
+	}
+	if resp == nil {
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+	br := bufio.NewReader(resp.Body)
+	for i := 1; i <= 3; i++ {
+		if i > 1 {
+			_, _ = fmt.Fprintf(pw, "{\"product_id\":\"inc\",\"price\":%d}\n", i)
+		}
+		line, err := br.ReadBytes('\n')
+		if err != nil {
+			t.Fatalf("read ack %d: %v", i, err)
+		}
+		var it streamItem
+		if err := json.Unmarshal(line, &it); err != nil || it.Line != i || it.Status != statusAccepted {
+			t.Fatalf("unexpected ack %d: %s (%v)", i, line, err)
+		}
+	}
+	_ = pw.Close()
+	if _, err := br.ReadBytes('\n'); err != io.EOF {
+		t.Fatalf("expected end of stream, got %v", err)
+	}
+}
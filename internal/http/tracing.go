@@ -0,0 +1,72 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/model"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/tracing"
+)
+
+// traceRequests starts a server span per request, continuing the caller's
+// trace when a valid traceparent header is present. It runs directly
+// around the mux and copies the matched pattern back to r, which the outer
+// middleware reads for its route label.
+func (a *App) traceRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tr := a.Manager.Tracer()
+		parent, _ := tracing.ParseTraceparent(r.Header.Get("traceparent"))
+		span := tr.StartFrom(parent, r.Method, time.Now(),
+			tracing.String("http.request.method", r.Method),
+			tracing.String("url.path", r.URL.Path),
+			tracing.String("request_id", RequestIDFromContext(r.Context())),
+		)
+		span.SetKind(tracing.KindServer)
+		sr := &statusRecorder{h: w, st: 200}
+		inner := r.WithContext(tracing.ContextWithSpan(r.Context(), span))
+		next.ServeHTTP(sr, inner)
+		r.Pattern = inner.Pattern
+		if r.Pattern != "" {
+			span.SetName(r.Method + " " + r.Pattern)
+			span.SetAttrs(tracing.String("http.route", r.Pattern))
+		}
+		span.SetAttrs(tracing.Int("http.response.status_code", int64(sr.st)))
+		if sr.st >= 500 {
+			span.RecordError(errorStatus(sr.st))
+		}
+		span.End()
+	})
+}
+
+// errorStatus is the span error for a 5xx response.
+type errorStatus int
+
+func (e errorStatus) Error() string { return "HTTP " + strconv.Itoa(int(e)) }
+
+// startEnqueue starts the producer span for handing n events to the queue.
+// Events offered under it must be stamped with traced.
+func (a *App) startEnqueue(ctx context.Context, n int) *tracing.Span {
+	_, span := a.Manager.Tracer().Start(ctx, "event.enqueue", tracing.Int("events", int64(n)))
+	span.SetKind(tracing.KindProducer)
+	return span
+}
+
+// traced stamps ev with the enqueue span's trace context and the request
+// ID, so worker spans and logs join the request's trace.
+func traced(ctx context.Context, span *tracing.Span, ev model.Event) model.Event {
+	ev.TraceParent = span.Context().Traceparent()
+	ev.RequestID = RequestIDFromContext(ctx)
+	return ev
+}
+
+// traceID returns the trace ID of the span in ctx for log correlation, or
+// "" when there is none.
+func traceID(ctx context.Context) string {
+	sc := tracing.SpanFromContext(ctx).Context()
+	if !sc.IsValid() {
+		return ""
+	}
+	return sc.TraceID.String()
+}
@@ -0,0 +1,83 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/obs"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/webhook"
+)
+
+// webhooksHandler lists (GET) and registers (POST) webhook subscriptions.
+func (a *App) webhooksHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]any{"subscriptions": a.Webhooks.List()})
+	case http.MethodPost:
+		if !a.Webhooks.Enabled() {
+			WriteJSONError(w, http.StatusServiceUnavailable, "webhooks_disabled", "CHANGE_LOG_SIZE is 0")
+			return
+		}
+		if !isJSON(r) {
+			WriteJSONError(w, http.StatusUnsupportedMediaType, "unsupported_media_type", "expected application/json")
+			return
+		}
+		var spec webhook.Spec
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&spec); err != nil {
+			WriteJSONError(w, http.StatusBadRequest, "invalid_json", err.Error())
+			return
+		}
+		sub, err := a.Webhooks.Create(spec)
+		if errors.Is(err, webhook.ErrInvalidSubscription) {
+			WriteJSONError(w, http.StatusBadRequest, "validation_error", err.Error())
+			return
+		}
+		if err != nil {
+			WriteJSONError(w, http.StatusInternalServerError, "internal_error", err.Error())
+			return
+		}
+		obs.Logger.Info("webhook_created", "request_id", RequestIDFromContext(r.Context()), "subscription_id", sub.ID)
+		writeJSON(w, http.StatusCreated, sub)
+	default:
+		WriteJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "")
+	}
+}
+
+// webhookHandler reads (GET) or removes (DELETE) one subscription.
+func (a *App) webhookHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/admin/webhooks/")
+	if id == "" || strings.Contains(id, "/") {
+		WriteJSONError(w, http.StatusNotFound, "not_found", "")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		sub, ok := a.Webhooks.Get(id)
+		if !ok {
+			WriteJSONError(w, http.StatusNotFound, "not_found", "")
+			return
+		}
+		writeJSON(w, http.StatusOK, sub)
+	case http.MethodDelete:
+		if !a.Webhooks.Delete(id) {
+			WriteJSONError(w, http.StatusNotFound, "not_found", "")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		WriteJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "")
+	}
+}
+
+// webhookDeadLettersHandler lists changes that could not be delivered.
+func (a *App) webhookDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"dead_letters": a.Webhooks.DeadLetters()})
+}
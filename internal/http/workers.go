@@ -0,0 +1,71 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/obs"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/queue"
+)
+
+// workersHandler reads (GET) or changes (PATCH) the worker pool settings.
+func (a *App) workersHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, a.Manager.Pool())
+	case http.MethodPatch:
+		if !isJSON(r) {
+			WriteJSONError(w, http.StatusUnsupportedMediaType, "unsupported_media_type", "expected application/json")
+			return
+		}
+		var u queue.PoolUpdate
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&u); err != nil {
+			WriteJSONError(w, http.StatusBadRequest, "invalid_json", err.Error())
+			return
+		}
+		before := a.Manager.Pool()
+		after, err := a.Manager.UpdatePool(u)
+		if errors.Is(err, queue.ErrInvalidPool) {
+			WriteJSONError(w, http.StatusBadRequest, "validation_error", err.Error())
+			return
+		}
+		if err != nil {
+			WriteJSONError(w, http.StatusInternalServerError, "internal_error", err.Error())
+			return
+		}
+		obs.Logger.Info("admin_workers_updated",
+			"request_id", RequestIDFromContext(r.Context()),
+			"before", before,
+			"after", after,
+		)
+		writeJSON(w, http.StatusOK, after)
+	default:
+		WriteJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "")
+	}
+}
+
+// workersPauseHandler stops dispatching queued events to workers; intake
+// keeps accepting and the backlog grows until resumed.
+func (a *App) workersPauseHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		WriteJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "")
+		return
+	}
+	a.Manager.Pause()
+	obs.Logger.Info("admin_workers_paused", "request_id", RequestIDFromContext(r.Context()))
+	writeJSON(w, http.StatusOK, a.Manager.Pool())
+}
+
+// workersResumeHandler restarts processing after a pause.
+func (a *App) workersResumeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		WriteJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "")
+		return
+	}
+	a.Manager.Resume()
+	obs.Logger.Info("admin_workers_resumed", "request_id", RequestIDFromContext(r.Context()))
+	writeJSON(w, http.StatusOK, a.Manager.Pool())
+}
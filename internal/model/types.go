@@ -1,12 +1,36 @@
 // Package model defines domain types used by the service.
 package model
 
+import "time"
+
 // Event represents an incoming product update event.
 type Event struct {
 	ProductID string   `json:"product_id"`
 	Price     *float64 `json:"price,omitempty"`
 	Stock     *int64   `json:"stock,omitempty"`
-	Sequence  uint64   `json:"-"`
+	// Priority selects the queue lane: "high", "normal" (default) or "low".
+	Priority string `json:"priority,omitempty"`
+	// EffectiveAt, when in the future, holds the event until that time.
+	EffectiveAt *time.Time `json:"effective_at,omitempty"`
+	// Version and SourceTimestamp are an optional client-side order of the
+	// product's updates (at most one is set); the store's ordering mode
+	// decides whether they or Sequence gate updates.
+	Version         *uint64    `json:"version,omitempty"`
+	SourceTimestamp *time.Time `json:"source_timestamp,omitempty"`
+	Sequence        uint64     `json:"-"`
+	// Merged lists the sequences of pending events folded into this one
+	// by queue coalescing; they complete together with Sequence.
+	Merged []uint64 `json:"-"`
+	// TraceParent is the W3C traceparent of the request span that accepted
+	// the event, and RequestID its X-Request-ID; both travel through the
+	// queue so worker spans and logs tie back to the request.
+	TraceParent string `json:"-"`
+	RequestID   string `json:"-"`
+	// ReceivedAt is when the HTTP layer took the event in, and EnqueuedAt
+	// when the queue admitted it; they start the end-to-end and queue-wait
+	// latency clocks.
+	ReceivedAt time.Time `json:"-"`
+	EnqueuedAt time.Time `json:"-"`
 }
 
 // Product represents the current state of a product.
@@ -0,0 +1,128 @@
+package obs
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// latencySubBuckets is the number of buckets per doubling. Quantiles are
+// reported as a bucket's upper bound, so they overstate the true value by
+// at most 2^(1/8)-1, about 9%.
+const latencySubBuckets = 8
+
+// latencyBuckets covers 1µs to 2^34µs (about 4.8 hours); bucket 0 holds
+// anything under 1µs and the last bucket anything above the range.
+const latencyBuckets = latencySubBuckets*34 + 2
+
+// LatencyQuantiles are the quantiles reported by LatencyHistogram.
+var LatencyQuantiles = []float64{0.5, 0.9, 0.99, 0.999}
+
+// LatencyHistogram records durations in log-scale buckets and reports
+// quantiles from them in constant memory. The zero value is ready to use.
+type LatencyHistogram struct {
+	mu     sync.Mutex
+	counts [latencyBuckets]uint64
+	count  uint64
+	sum    time.Duration
+	max    time.Duration
+}
+
+// Observe records d. Negative durations count as zero.
+func (h *LatencyHistogram) Observe(d time.Duration) {
+	d = max(d, 0)
+	i := latencyBucket(d)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[i]++
+	h.count++
+	h.sum += d
+	h.max = max(h.max, d)
+}
+
+func latencyBucket(d time.Duration) int {
+	if d < time.Microsecond {
+		return 0
+	}
+	i := int(math.Floor(latencySubBuckets*math.Log2(float64(d)/float64(time.Microsecond)))) + 1
+	return min(i, latencyBuckets-1)
+}
+
+// latencyUpperBound returns the largest duration that falls in bucket i.
+func latencyUpperBound(i int) time.Duration {
+	if i == 0 {
+		return time.Microsecond
+	}
+	return time.Duration(float64(time.Microsecond) * math.Exp2(float64(i)/latencySubBuckets))
+}
+
+// LatencySnapshot summarises a LatencyHistogram, in milliseconds.
+type LatencySnapshot struct {
+	Count  uint64  `json:"count"`
+	MeanMs float64 `json:"mean_ms"`
+	P50Ms  float64 `json:"p50_ms"`
+	P90Ms  float64 `json:"p90_ms"`
+	P99Ms  float64 `json:"p99_ms"`
+	P999Ms float64 `json:"p999_ms"`
+	MaxMs  float64 `json:"max_ms"`
+}
+
+// Snapshot returns the count, mean, LatencyQuantiles and maximum.
+func (h *LatencyHistogram) Snapshot() LatencySnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := LatencySnapshot{Count: h.count, MaxMs: ms(h.max)}
+	if h.count == 0 {
+		return s
+	}
+	s.MeanMs = ms(h.sum / time.Duration(h.count)) //nolint:gosec // count is far below MaxInt64
+	s.P50Ms = ms(h.quantileLocked(0.5))
+	s.P90Ms = ms(h.quantileLocked(0.9))
+	s.P99Ms = ms(h.quantileLocked(0.99))
+	s.P999Ms = ms(h.quantileLocked(0.999))
+	return s
+}
+
+// Quantile returns an upper estimate of the q-quantile, or 0 when empty.
+func (h *LatencyHistogram) Quantile(q float64) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.quantileLocked(q)
+}
+
+func (h *LatencyHistogram) quantileLocked(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(h.count)))
+	rank = max(rank, 1)
+	var seen uint64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			return min(latencyUpperBound(i), h.max)
+		}
+	}
+	return h.max
+}
+
+// Write writes the histogram as a Prometheus summary named name, in
+// seconds: one sample per LatencyQuantiles entry plus _sum and _count.
+func (h *LatencyHistogram) Write(p *PromWriter, name, help string) {
+	h.mu.Lock()
+	quantiles := make([]time.Duration, len(LatencyQuantiles))
+	for i, q := range LatencyQuantiles {
+		quantiles[i] = h.quantileLocked(q)
+	}
+	sum, count := h.sum, h.count
+	h.mu.Unlock()
+	p.header(name, "summary", help)
+	for i, q := range LatencyQuantiles {
+		p.sample(name, []Label{{Name: "quantile", Value: strconv.FormatFloat(q, 'g', -1, 64)}}, quantiles[i].Seconds())
+	}
+	p.sample(name+"_sum", nil, sum.Seconds())
+	p.sample(name+"_count", nil, float64(count))
+}
+
+func ms(d time.Duration) float64 { return float64(d.Microseconds()) / 1000.0 }
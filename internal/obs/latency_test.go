@@ -0,0 +1,54 @@
+package obs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLatencyHistogramQuantiles(t *testing.T) {
+	var h LatencyHistogram
+	if s := h.Snapshot(); s.Count != 0 || s.P99Ms != 0 {
+		t.Fatalf("empty snapshot = %+v", s)
+	}
+	for i := 1; i <= 1000; i++ {
+		h.Observe(time.Duration(i) * time.Millisecond)
+	}
+	s := h.Snapshot()
+	if s.Count != 1000 || s.MaxMs != 1000 || s.MeanMs != 500.5 {
+		t.Fatalf("unexpected snapshot %+v", s)
+	}
+	for _, c := range []struct {
+		got, want float64
+	}{{s.P50Ms, 500}, {s.P90Ms, 900}, {s.P99Ms, 990}, {s.P999Ms, 999}} {
+		// Buckets are 2^(1/8) wide and quantiles report the upper bound.
+		if c.got < c.want || c.got > c.want*1.1 {
+			t.Fatalf("quantile %.1fms, want within 10%% above %.0fms (%+v)", c.got, c.want, s)
+		}
+	}
+	h.Observe(-time.Second)
+	if q := h.Quantile(0); q > time.Microsecond {
+		t.Fatalf("negative duration not clamped: p0 = %s", q)
+	}
+}
+
+func TestLatencyHistogramWrite(t *testing.T) {
+	var h LatencyHistogram
+	h.Observe(2 * time.Second)
+	var buf bytes.Buffer
+	p := NewPromWriter(&buf)
+	h.Write(p, "wait_seconds", "Wait.")
+	_ = p.Flush()
+	for _, want := range []string{
+		"# TYPE wait_seconds summary\n",
+		`wait_seconds{quantile="0.5"} 2` + "\n",
+		`wait_seconds{quantile="0.999"} 2` + "\n",
+		"wait_seconds_sum 2\n",
+		"wait_seconds_count 1\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("output missing %q:\n%s", want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package obs
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PromContentType is the media type of the Prometheus text exposition
+// format written by PromWriter.
+const PromContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultLatencyBuckets are histogram upper bounds, in seconds, for request
+// latencies.
+var DefaultLatencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Label is one Prometheus label pair.
+type Label struct {
+	Name, Value string
+}
+
+// PromSample is one sample of a metric family.
+type PromSample struct {
+	Labels []Label
+	Value  float64
+}
+
+// PromWriter writes metric families in the Prometheus text exposition
+// format. Call Flush when done.
+type PromWriter struct {
+	w *bufio.Writer
+}
+
+// NewPromWriter returns a PromWriter writing to w.
+func NewPromWriter(w io.Writer) *PromWriter {
+	return &PromWriter{w: bufio.NewWriter(w)}
+}
+
+// Flush writes any buffered output.
+func (p *PromWriter) Flush() error { return p.w.Flush() }
+
+// Counter writes an unlabelled counter.
+func (p *PromWriter) Counter(name, help string, v float64) {
+	p.Family(name, "counter", help, PromSample{Value: v})
+}
+
+// Gauge writes an unlabelled gauge.
+func (p *PromWriter) Gauge(name, help string, v float64) {
+	p.Family(name, "gauge", help, PromSample{Value: v})
+}
+
+// Family writes the HELP and TYPE lines of a metric family followed by its
+// samples.
+func (p *PromWriter) Family(name, typ, help string, samples ...PromSample) {
+	p.header(name, typ, help)
+	for _, s := range samples {
+		p.sample(name, s.Labels, s.Value)
+	}
+}
+
+func (p *PromWriter) header(name, typ, help string) {
+	_, _ = p.w.WriteString("# HELP " + name + " " + escapeHelp(help) + "\n")
+	_, _ = p.w.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+func (p *PromWriter) sample(name string, labels []Label, v float64) {
+	_, _ = p.w.WriteString(name)
+	if len(labels) > 0 {
+		_ = p.w.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				_ = p.w.WriteByte(',')
+			}
+			_, _ = p.w.WriteString(l.Name + `="` + escapeLabel(l.Value) + `"`)
+		}
+		_ = p.w.WriteByte('}')
+	}
+	_ = p.w.WriteByte(' ')
+	_, _ = p.w.WriteString(formatFloat(v))
+	_ = p.w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+// seriesKey joins label values into a map key.
+func seriesKey(values []string) string { return strings.Join(values, "\xff") }
+
+// labelsFor pairs label names with values.
+func labelsFor(names, values []string) []Label {
+	out := make([]Label, len(names))
+	for i, n := range names {
+		out[i] = Label{Name: n, Value: values[i]}
+	}
+	return out
+}
+
+// CounterVec is a counter partitioned by label values.
+type CounterVec struct {
+	name, help string
+	labels     []string
+
+	mu     sync.Mutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	values []string
+	n      float64
+}
+
+// NewCounterVec returns a counter family with the given label names.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{name: name, help: help, labels: labels, series: make(map[string]*counterSeries)}
+}
+
+// Inc adds one to the series with the given label values, which must match
+// the label names in number and order.
+func (c *CounterVec) Inc(values ...string) { c.Add(1, values...) }
+
+// Add adds v to the series with the given label values.
+func (c *CounterVec) Add(v float64, values ...string) {
+	key := seriesKey(values)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.series[key]
+	if !ok {
+		s = &counterSeries{values: append([]string(nil), values...)}
+		c.series[key] = s
+	}
+	s.n += v
+}
+
+// Write writes the family with its series sorted by label values.
+func (c *CounterVec) Write(p *PromWriter) {
+	c.mu.Lock()
+	samples := make([]PromSample, 0, len(c.series))
+	for _, s := range c.series {
+		samples = append(samples, PromSample{Labels: labelsFor(c.labels, s.values), Value: s.n})
+	}
+	c.mu.Unlock()
+	sortSamples(samples)
+	p.Family(c.name, "counter", c.help, samples...)
+}
+
+// HistogramVec is a histogram partitioned by label values.
+type HistogramVec struct {
+	name, help string
+	labels     []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	values []string
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// NewHistogramVec returns a histogram family with the given upper bounds,
+// in increasing order, and label names.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return &HistogramVec{name: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*histogramSeries)}
+}
+
+// Observe records v in the series with the given label values.
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	key := seriesKey(values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{values: append([]string(nil), values...), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.sum += v
+	s.count++
+}
+
+// Write writes the family: cumulative _bucket series with an le label, then
+// _sum and _count, per label set.
+func (h *HistogramVec) Write(p *PromWriter) {
+	h.mu.Lock()
+	series := make([]histogramSeries, 0, len(h.series))
+	for _, s := range h.series {
+		cp := *s
+		cp.counts = append([]uint64(nil), s.counts...)
+		series = append(series, cp)
+	}
+	h.mu.Unlock()
+	sort.Slice(series, func(i, j int) bool { return seriesKey(series[i].values) < seriesKey(series[j].values) })
+	p.header(h.name, "histogram", h.help)
+	for _, s := range series {
+		labels := labelsFor(h.labels, s.values)
+		var cum uint64
+		for i, ub := range h.buckets {
+			cum += s.counts[i]
+			p.sample(h.name+"_bucket", append(labels, Label{Name: "le", Value: formatFloat(ub)}), float64(cum))
+		}
+		p.sample(h.name+"_bucket", append(labels, Label{Name: "le", Value: "+Inf"}), float64(s.count))
+		p.sample(h.name+"_sum", labels, s.sum)
+		p.sample(h.name+"_count", labels, float64(s.count))
+	}
+}
+
+func sortSamples(samples []PromSample) {
+	key := func(s PromSample) string {
+		values := make([]string, len(s.Labels))
+		for i, l := range s.Labels {
+			values[i] = l.Value
+		}
+		return seriesKey(values)
+	}
+	sort.Slice(samples, func(i, j int) bool { return key(samples[i]) < key(samples[j]) })
+}
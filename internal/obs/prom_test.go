@@ -0,0 +1,42 @@
+package obs
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPromWriterFormat(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewPromWriter(&buf)
+	p.Gauge("up", "Whether the service is up.", 1)
+	c := NewCounterVec("requests_total", "Requests.", "route")
+	c.Inc("/b")
+	c.Add(2, `/a"x`)
+	c.Write(p)
+	h := NewHistogramVec("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	h.Observe(0.05, "/a")
+	h.Observe(0.1, "/a")
+	h.Observe(3, "/a")
+	h.Write(p)
+	if err := p.Flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	want := `# HELP up Whether the service is up.
+# TYPE up gauge
+up 1
+# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{route="/a\"x"} 2
+requests_total{route="/b"} 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/a",le="0.1"} 2
+latency_seconds_bucket{route="/a",le="1"} 2
+latency_seconds_bucket{route="/a",le="+Inf"} 3
+latency_seconds_sum{route="/a"} 3.15
+latency_seconds_count{route="/a"} 3
+`
+	if buf.String() != want {
+		t.Fatalf("unexpected exposition:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
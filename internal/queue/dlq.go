@@ -0,0 +1,112 @@
+package queue
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/model"
+)
+
+// DeadEvent is an event whose application failed after every retry.
+type DeadEvent struct {
+	Sequence  uint64    `json:"sequence"`
+	ProductID string    `json:"product_id"`
+	Price     *float64  `json:"price,omitempty"`
+	Stock     *int64    `json:"stock,omitempty"`
+	Attempts  int       `json:"attempts"`
+	Error     string    `json:"error"`
+	FailedAt  time.Time `json:"failed_at"`
+
+	event model.Event
+}
+
+func newDeadEvent(ev model.Event, attempts int, err error) DeadEvent {
+	// Merged sequences are acknowledged with ev; a replay stands alone.
+	ev.Merged = nil
+	return DeadEvent{
+		Sequence:  ev.Sequence,
+		ProductID: ev.ProductID,
+		Price:     ev.Price,
+		Stock:     ev.Stock,
+		Attempts:  attempts,
+		Error:     err.Error(),
+		FailedAt:  time.Now().UTC(),
+		event:     ev,
+	}
+}
+
+// DeadLetterQueue holds failed events in failure order, bounded to limit
+// entries; when full the oldest entry is evicted.
+type DeadLetterQueue struct {
+	mu      sync.Mutex
+	items   []DeadEvent
+	limit   int
+	evicted uint64
+}
+
+// NewDeadLetterQueue returns a DLQ retaining up to limit events (at least 1).
+func NewDeadLetterQueue(limit int) *DeadLetterQueue {
+	if limit < 1 {
+		limit = 1
+	}
+	return &DeadLetterQueue{limit: limit}
+}
+
+// Add appends d, evicting the oldest entry when the queue is full.
+func (q *DeadLetterQueue) Add(d DeadEvent) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) >= q.limit {
+		q.items = q.items[1:]
+		q.evicted++
+	}
+	q.items = append(q.items, d)
+}
+
+// List returns a copy of the queued dead events, oldest first.
+func (q *DeadLetterQueue) List() []DeadEvent {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]DeadEvent(nil), q.items...)
+}
+
+// Len returns the number of queued dead events.
+func (q *DeadLetterQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// Evicted returns how many dead events were dropped for lack of room.
+func (q *DeadLetterQueue) Evicted() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.evicted
+}
+
+// Take removes and returns the dead events with the given sequences, or
+// every dead event when seqs is empty.
+func (q *DeadLetterQueue) Take(seqs []uint64) []DeadEvent {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(seqs) == 0 {
+		out := q.items
+		q.items = nil
+		return out
+	}
+	want := make(map[uint64]bool, len(seqs))
+	for _, s := range seqs {
+		want[s] = true
+	}
+	var out []DeadEvent
+	keep := q.items[:0]
+	for _, d := range q.items {
+		if want[d.Sequence] {
+			out = append(out, d)
+		} else {
+			keep = append(keep, d)
+		}
+	}
+	q.items = keep
+	return out
+}
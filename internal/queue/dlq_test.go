@@ -0,0 +1,174 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/config"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/model"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/obs"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/store"
+)
+
+// flakyStore fails every Upsert for products in failing.
+type flakyStore struct {
+	*store.Store
+	mu      sync.Mutex
+	failing map[string]bool
+	calls   map[string]int
+}
+
+func newFlakyStore(failing ...string) *flakyStore {
+	s := &flakyStore{Store: store.New(), failing: map[string]bool{}, calls: map[string]int{}}
+	for _, id := range failing {
+		s.failing[id] = true
+	}
+	return s
+}
+
+func (s *flakyStore) Upsert(ev model.Event) (store.Result, error) {
+	s.mu.Lock()
+	s.calls[ev.ProductID]++
+	fail := s.failing[ev.ProductID]
+	s.mu.Unlock()
+	if fail {
+		return store.Result{}, errors.New("backend unavailable")
+	}
+	return s.Store.Upsert(ev)
+}
+
+func (s *flakyStore) heal(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.failing, id)
+}
+
+func TestRetryDelayBoundedWithJitter(t *testing.T) {
+	base, maxDelay := 10*time.Millisecond, 50*time.Millisecond
+	for n := 1; n <= 40; n++ {
+		want := maxDelay
+		if n <= 3 {
+			want = base << (n - 1)
+		}
+		if d := retryDelay(n, base, maxDelay); d < want/2 || d > want {
+			t.Fatalf("retry %d: delay %s outside [%s, %s]", n, d, want/2, want)
+		}
+	}
+}
+
+func TestFailedApplyRetriedThenDeadLettered(t *testing.T) {
+	obs.InitLogger()
+	cfg := config.Load()
+	cfg.InitialWorkerCount = 1
+	cfg.ApplyMaxRetries = 2
+	cfg.ApplyRetryBackoff = time.Millisecond
+	cfg.ApplyRetryMaxBackoff = 2 * time.Millisecond
+	st := newFlakyStore("bad")
+	q := New(8)
+	mgr := NewManager(cfg, q, st)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mgr.Start(ctx)
+	defer mgr.Stop()
+
+	price := 1.0
+	bad := model.Event{ProductID: "bad", Price: &price, Sequence: mgr.NextSequence()}
+	good := model.Event{ProductID: "good", Price: &price, Sequence: mgr.NextSequence()}
+	mgr.Enqueue(bad)
+	mgr.Enqueue(good)
+	drain := func() {
+		t.Helper()
+		ctxDrain, cancelDrain := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancelDrain()
+		if !mgr.DrainUntil(ctxDrain) {
+			t.Fatalf("drain timeout")
+		}
+	}
+	drain()
+
+	if got := st.calls["bad"]; got != 3 {
+		t.Fatalf("expected 1 attempt + 2 retries, got %d", got)
+	}
+	dead := mgr.DeadLetters()
+	if len(dead) != 1 || dead[0].Sequence != bad.Sequence || dead[0].Attempts != 3 || dead[0].Error == "" {
+		t.Fatalf("unexpected dead letters: %+v", dead)
+	}
+	if s, _, _ := mgr.EventStatus(bad.Sequence); s.Status != StatusDropped {
+		t.Fatalf("expected dropped status, got %q", s.Status)
+	}
+
+	st.heal("bad")
+	replayed, err := mgr.ReplayDeadLetters(nil)
+	if err != nil || len(replayed) != 1 || replayed[0] != bad.Sequence {
+		t.Fatalf("unexpected replay result: %v %v", replayed, err)
+	}
+	drain()
+	if p, ok := st.Get("bad"); !ok || p.Price != 1 {
+		t.Fatalf("replayed event not applied: %+v", p)
+	}
+	if len(mgr.DeadLetters()) != 0 {
+		t.Fatalf("expected empty DLQ after replay")
+	}
+	if s, _, _ := mgr.EventStatus(bad.Sequence); s.Status != StatusApplied {
+		t.Fatalf("expected applied status after replay, got %q", s.Status)
+	}
+}
+
+func TestReplayRefusedByFullQueueStaysDeadLettered(t *testing.T) {
+	obs.InitLogger()
+	cfg := config.Load()
+	cfg.InitialWorkerCount, cfg.WorkerMin, cfg.WorkerMax = 1, 1, 1
+	cfg.ApplyMaxRetries = 0
+	cfg.QueueCapacity, cfg.QueueOverloadPolicy = 1, OverloadReject
+	st := newFlakyStore("bad")
+	mgr := NewManager(cfg, New(1), st)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mgr.Start(ctx)
+	defer mgr.Stop()
+
+	price := 1.0
+	bad := model.Event{ProductID: "bad", Price: &price, Sequence: mgr.NextSequence()}
+	_ = mgr.Offer(bad)
+	ctxDrain, cancelDrain := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancelDrain()
+	if !mgr.DrainUntil(ctxDrain) {
+		t.Fatalf("drain timeout")
+	}
+
+	mgr.Pause()
+	for i := 0; i < 4; i++ {
+		if err := mgr.Offer(priceEvent("filler", mgr.NextSequence(), 1)); errors.Is(err, ErrQueueFull) {
+			break
+		}
+	}
+	replayed, err := mgr.ReplayDeadLetters(nil)
+	if !errors.Is(err, ErrQueueFull) || len(replayed) != 0 {
+		t.Fatalf("expected refusal, got %v %v", replayed, err)
+	}
+	if len(mgr.DeadLetters()) != 1 {
+		t.Fatalf("expected refused event back in the DLQ")
+	}
+	if s, _, _ := mgr.EventStatus(bad.Sequence); s.Status != StatusDropped {
+		t.Fatalf("expected dropped status after refused replay, got %q", s.Status)
+	}
+}
+
+func TestDeadLetterQueueBoundedAndTake(t *testing.T) {
+	q := NewDeadLetterQueue(2)
+	for seq := uint64(1); seq <= 3; seq++ {
+		q.Add(newDeadEvent(model.Event{ProductID: "p", Sequence: seq}, 1, errors.New("x")))
+	}
+	if q.Len() != 2 || q.Evicted() != 1 {
+		t.Fatalf("expected 2 kept and 1 evicted, got %d/%d", q.Len(), q.Evicted())
+	}
+	if got := q.Take([]uint64{3, 9}); len(got) != 1 || got[0].Sequence != 3 {
+		t.Fatalf("unexpected take: %+v", got)
+	}
+	if l := q.List(); len(l) != 1 || l[0].Sequence != 2 {
+		t.Fatalf("unexpected remainder: %+v", l)
+	}
+}
@@ -0,0 +1,334 @@
+package queue
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/model"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/wal"
+)
+
+const (
+	segmentPrefix = "seg-"
+	segmentExt    = ".log"
+	ackExt        = ".ack"
+)
+
+// JournalOptions configures the on-disk queue mode.
+type JournalOptions struct {
+	// Dir holds the segment files.
+	Dir string
+	// Sync selects when segment appends are fsynced. SyncAlways guarantees
+	// an event is on disk before its 202 ack; the events of one offer are
+	// synced together (group commit).
+	Sync wal.SyncPolicy
+	// SegmentEvents is the number of events per segment before rolling.
+	SegmentEvents int
+}
+
+// journalRecord is the on-disk form of a queued event.
+type journalRecord struct {
+	ProductID string   `json:"product_id"`
+	Price     *float64 `json:"price,omitempty"`
+	Stock     *int64   `json:"stock,omitempty"`
+	Priority  string   `json:"priority,omitempty"`
+	Sequence  uint64   `json:"sequence"`
+	// EffectiveAt is set for events held until that time.
+	EffectiveAt     *time.Time `json:"effective_at,omitempty"`
+	Version         *uint64    `json:"version,omitempty"`
+	SourceTimestamp *time.Time `json:"source_timestamp,omitempty"`
+	TraceParent     string     `json:"traceparent,omitempty"`
+	RequestID       string     `json:"request_id,omitempty"`
+	ReceivedAt      time.Time  `json:"received_at,omitzero"`
+}
+
+func recordFromEvent(ev model.Event) journalRecord {
+	return journalRecord{ProductID: ev.ProductID, Price: ev.Price, Stock: ev.Stock, Priority: ev.Priority, Sequence: ev.Sequence, EffectiveAt: ev.EffectiveAt, Version: ev.Version, SourceTimestamp: ev.SourceTimestamp, TraceParent: ev.TraceParent, RequestID: ev.RequestID, ReceivedAt: ev.ReceivedAt}
+}
+
+func (r journalRecord) event() model.Event {
+	return model.Event{ProductID: r.ProductID, Price: r.Price, Stock: r.Stock, Priority: r.Priority, Sequence: r.Sequence, EffectiveAt: r.EffectiveAt, Version: r.Version, SourceTimestamp: r.SourceTimestamp, TraceParent: r.TraceParent, RequestID: r.RequestID, ReceivedAt: r.ReceivedAt}
+}
+
+// segment is one journal file plus its acknowledgement log.
+type segment struct {
+	id     uint64
+	log    *wal.Log
+	acks   *wal.Log
+	total  int
+	acked  int
+	sealed bool
+}
+
+// journal persists queued events in rolling segment files. A segment is
+// deleted once it is sealed and every event in it has been acknowledged.
+type journal struct {
+	mu       sync.Mutex
+	opts     JournalOptions
+	active   *segment
+	nextID   uint64
+	pending  map[uint64]*segment // sequence -> segment of unacked events
+	segments map[uint64]*segment
+	maxSeq   uint64
+	// flushLog fsyncs one segment log; tests replace it to fail syncs.
+	flushLog func(*wal.Log) error
+}
+
+// logPolicy is the sync policy segment logs are opened with. Under
+// SyncAlways the journal syncs once per offer in commit instead of once
+// per append.
+func (j *journal) logPolicy() wal.SyncPolicy {
+	if j.opts.Sync == wal.SyncAlways {
+		return wal.SyncInterval
+	}
+	return j.opts.Sync
+}
+
+// openJournal opens the journal in opts.Dir and returns the events that
+// were persisted but never acknowledged, in append order.
+func openJournal(opts JournalOptions) (*journal, []model.Event, error) {
+	if opts.Dir == "" {
+		return nil, nil, errors.New("queue: journal dir is required")
+	}
+	if opts.SegmentEvents <= 0 {
+		opts.SegmentEvents = 10000
+	}
+	if err := os.MkdirAll(opts.Dir, 0o750); err != nil {
+		return nil, nil, err
+	}
+	j := &journal{opts: opts, nextID: 1, pending: make(map[uint64]*segment), segments: make(map[uint64]*segment), flushLog: (*wal.Log).Flush}
+	ids, err := j.segmentIDs()
+	if err != nil {
+		return nil, nil, err
+	}
+	var replay []model.Event
+	for _, id := range ids {
+		evs, err := j.recoverSegment(id)
+		if err != nil {
+			j.close()
+			return nil, nil, err
+		}
+		replay = append(replay, evs...)
+		if id >= j.nextID {
+			j.nextID = id + 1
+		}
+	}
+	return j, replay, nil
+}
+
+// segmentIDs lists existing segment IDs in ascending order.
+func (j *journal) segmentIDs() ([]uint64, error) {
+	matches, err := filepath.Glob(filepath.Join(j.opts.Dir, segmentPrefix+"*"+segmentExt))
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint64, 0, len(matches))
+	for _, m := range matches {
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(m), segmentPrefix), segmentExt)
+		id, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(a, b int) bool { return ids[a] < ids[b] })
+	return ids, nil
+}
+
+func (j *journal) paths(id uint64) (logPath, ackPath string) {
+	base := filepath.Join(j.opts.Dir, fmt.Sprintf("%s%020d", segmentPrefix, id))
+	return base + segmentExt, base + ackExt
+}
+
+// recoverSegment replays one sealed segment and returns its unacked events.
+// Fully acknowledged segments are removed.
+func (j *journal) recoverSegment(id uint64) ([]model.Event, error) {
+	logPath, ackPath := j.paths(id)
+	acked := make(map[uint64]bool)
+	acks, err := wal.Open(ackPath, wal.SyncNever, func(p []byte) error {
+		if len(p) == 8 {
+			acked[binary.LittleEndian.Uint64(p)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var evs []model.Event
+	total := 0
+	log, err := wal.Open(logPath, j.logPolicy(), func(p []byte) error {
+		var rec journalRecord
+		if err := json.Unmarshal(p, &rec); err != nil {
+			return fmt.Errorf("queue: decode journal record: %w", err)
+		}
+		total++
+		if rec.Sequence > j.maxSeq {
+			j.maxSeq = rec.Sequence
+		}
+		if !acked[rec.Sequence] {
+			evs = append(evs, rec.event())
+		}
+		return nil
+	})
+	if err != nil {
+		_ = acks.Close()
+		return nil, err
+	}
+	seg := &segment{id: id, log: log, acks: acks, total: total, acked: total - len(evs), sealed: true}
+	if len(evs) == 0 {
+		j.remove(seg)
+		return nil, nil
+	}
+	j.segments[id] = seg
+	for _, ev := range evs {
+		j.pending[ev.Sequence] = seg
+	}
+	return evs, nil
+}
+
+// append writes ev to the active segment, rolling to a new one when full.
+// Under SyncAlways the write is durable once commit returns.
+func (j *journal) append(ev model.Event) error {
+	payload, err := json.Marshal(recordFromEvent(ev))
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.active == nil || j.active.total >= j.opts.SegmentEvents {
+		if err := j.rollLocked(); err != nil {
+			return err
+		}
+	}
+	if err := j.active.log.Append(payload); err != nil {
+		return err
+	}
+	j.active.total++
+	j.pending[ev.Sequence] = j.active
+	if ev.Sequence > j.maxSeq {
+		j.maxSeq = ev.Sequence
+	}
+	return nil
+}
+
+func (j *journal) rollLocked() error {
+	if j.active != nil {
+		j.active.sealed = true
+		if j.active.acked == j.active.total {
+			j.removeLocked(j.active)
+		}
+		j.active = nil
+	}
+	id := j.nextID
+	logPath, ackPath := j.paths(id)
+	log, err := wal.Open(logPath, j.logPolicy(), nil)
+	if err != nil {
+		return err
+	}
+	acks, err := wal.Open(ackPath, wal.SyncNever, nil)
+	if err != nil {
+		_ = log.Close()
+		return err
+	}
+	j.nextID++
+	j.active = &segment{id: id, log: log, acks: acks}
+	j.segments[id] = j.active
+	return nil
+}
+
+// ack records that the event with seq was processed. Acks are not fsynced:
+// losing one only causes a harmless replay that sequence gating skips.
+func (j *journal) ack(seq uint64) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	seg, ok := j.pending[seq]
+	if !ok {
+		return nil
+	}
+	delete(j.pending, seq)
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], seq)
+	if err := seg.acks.Append(buf[:]); err != nil {
+		return err
+	}
+	seg.acked++
+	if seg.sealed && seg.acked == seg.total {
+		j.removeLocked(seg)
+	}
+	return nil
+}
+
+// flush fsyncs every segment with unsynced appends, including one sealed
+// by a roll since the last flush. The fsyncs run without j.mu held.
+func (j *journal) flush() error {
+	j.mu.Lock()
+	logs := make([]*wal.Log, 0, len(j.segments))
+	for _, seg := range j.segments {
+		logs = append(logs, seg.log)
+	}
+	j.mu.Unlock()
+	for _, l := range logs {
+		// A segment removed meanwhile was synced by Close; Flush is a no-op.
+		if err := j.flushLog(l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commit makes the appends made so far durable when the policy is
+// SyncAlways. Other policies leave syncing to the broker's ticker.
+func (j *journal) commit() error {
+	if j.opts.Sync != wal.SyncAlways {
+		return nil
+	}
+	return j.flush()
+}
+
+// segmentCount returns the number of segments still on disk.
+func (j *journal) segmentCount() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return len(j.segments)
+}
+
+func (j *journal) remove(seg *segment) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.removeLocked(seg)
+}
+
+// removeLocked garbage-collects a fully acknowledged segment.
+func (j *journal) removeLocked(seg *segment) {
+	_ = seg.log.Close()
+	_ = seg.acks.Close()
+	logPath, ackPath := j.paths(seg.id)
+	_ = os.Remove(logPath)
+	_ = os.Remove(ackPath)
+	delete(j.segments, seg.id)
+}
+
+// close closes every open segment, leaving files in place for replay.
+func (j *journal) close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var err error
+	for _, seg := range j.segments {
+		if cerr := seg.log.Close(); err == nil {
+			err = cerr
+		}
+		_ = seg.acks.Close()
+	}
+	j.segments = map[uint64]*segment{}
+	j.active = nil
+	return err
+}
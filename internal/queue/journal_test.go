@@ -0,0 +1,170 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/config"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/model"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/obs"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/store"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/wal"
+)
+
+func openTestDurable(t *testing.T, dir string) *Queue {
+	t.Helper()
+	obs.InitLogger()
+	q, err := NewDurable(4, JournalOptions{Dir: dir, Sync: wal.SyncAlways, SegmentEvents: 3})
+	if err != nil {
+		t.Fatalf("open durable queue: %v", err)
+	}
+	return q
+}
+
+func TestDurableQueueReplaysUnacked(t *testing.T) {
+	dir := t.TempDir()
+	q := openTestDurable(t, dir)
+	for i := 1; i <= 5; i++ {
+		p := float64(i)
+		if !q.Enqueue(model.Event{ProductID: "d", Price: &p, Sequence: uint64(i)}) {
+			t.Fatalf("enqueue %d failed", i)
+		}
+	}
+	// Acknowledge the first two events only.
+	q.MarkProcessed(1)
+	q.MarkProcessed(2)
+	if err := q.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	q2 := openTestDurable(t, dir)
+	defer func() { _ = q2.Close() }()
+	if got := q2.BacklogSize(); got != 3 {
+		t.Fatalf("expected 3 replayed events, got %d", got)
+	}
+	if got := q2.RecoveredMaxSequence(); got != 5 {
+		t.Fatalf("expected max sequence 5, got %d", got)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q2.Start(ctx, 0)
+	var seqs []uint64
+	timeout := time.After(2 * time.Second)
+	for len(seqs) < 3 {
+		select {
+		case ev := <-q2.Out():
+			seqs = append(seqs, ev.Sequence)
+		case <-timeout:
+			t.Fatalf("timed out waiting for replayed events, got %v", seqs)
+		}
+	}
+	if seqs[0] != 3 || seqs[2] != 5 {
+		t.Fatalf("unexpected replay order: %v", seqs)
+	}
+}
+
+func TestDurableQueueGarbageCollectsAckedSegments(t *testing.T) {
+	dir := t.TempDir()
+	q := openTestDurable(t, dir)
+	defer func() { _ = q.Close() }()
+	for i := 1; i <= 7; i++ {
+		_ = q.Enqueue(model.Event{ProductID: "g", Sequence: uint64(i)})
+	}
+	// 3 events per segment: [1-3] [4-6] [7 active]
+	if got := q.journal.segmentCount(); got != 3 {
+		t.Fatalf("expected 3 segments, got %d", got)
+	}
+	for i := 1; i <= 5; i++ {
+		q.MarkProcessed(uint64(i))
+	}
+	if got := q.journal.segmentCount(); got != 2 {
+		t.Fatalf("expected first segment collected, got %d segments", got)
+	}
+	q.MarkProcessed(6)
+	if got := q.journal.segmentCount(); got != 1 {
+		t.Fatalf("expected only the active segment left, got %d", got)
+	}
+	ids, err := q.journal.segmentIDs()
+	if err != nil || len(ids) != 1 {
+		t.Fatalf("expected one segment file on disk, got %v (%v)", ids, err)
+	}
+}
+
+func TestDurableQueueHealthReportsJournalFailure(t *testing.T) {
+	dir := t.TempDir()
+	q := openTestDurable(t, dir)
+	p := 1.0
+	if !q.Enqueue(model.Event{ProductID: "h", Price: &p, Sequence: 1}) || q.Health() != nil {
+		t.Fatalf("healthy journal: enqueue failed or health = %v", q.Health())
+	}
+	// Without its directory the journal cannot open a new segment.
+	_ = q.journal.close()
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatalf("remove dir: %v", err)
+	}
+	if _, err := q.OfferBatch([]model.Event{{ProductID: "h", Price: &p, Sequence: 2}}); err == nil {
+		t.Fatalf("offer after journal close succeeded")
+	}
+	if q.Health() == nil {
+		t.Fatalf("failed journal append not reported by Health")
+	}
+}
+
+func TestDurableQueueGroupCommitsBatch(t *testing.T) {
+	dir := t.TempDir()
+	q := openTestDurable(t, dir)
+	batch := make([]model.Event, 5)
+	for i := range batch {
+		batch[i] = model.Event{ProductID: "b", Sequence: uint64(i + 1)}
+	}
+	// The batch spans a segment roll: [1-3] sealed, [4-5] active.
+	if refused, err := q.OfferBatch(batch); err != nil || refused[0] != nil {
+		t.Fatalf("offer batch: %v %v", refused, err)
+	}
+	for i := 1; i <= 3; i++ {
+		q.MarkProcessed(uint64(i))
+	}
+	// Syncing after the sealed segment was collected must not fail.
+	if err := q.journal.commit(); err != nil {
+		t.Fatalf("commit after segment GC: %v", err)
+	}
+	if err := q.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	q2 := openTestDurable(t, dir)
+	defer func() { _ = q2.Close() }()
+	if got := q2.BacklogSize(); got != 2 {
+		t.Fatalf("expected 2 replayed events, got %d", got)
+	}
+}
+
+func TestDurableQueueSyncFailureKeepsEventsQueued(t *testing.T) {
+	q := openTestDurable(t, t.TempDir())
+	defer func() { _ = q.Close() }()
+	cfg := config.Load()
+	cfg.QueueCapacity, cfg.QueueOverloadPolicy = 2, OverloadDropOldest
+	mgr := NewManager(cfg, q, store.New())
+	for i := 1; i <= 2; i++ {
+		if err := mgr.Offer(priceEvent("s", uint64(i), 1)); err != nil {
+			t.Fatalf("offer %d: %v", i, err)
+		}
+	}
+	q.journal.flushLog = func(*wal.Log) error { return errors.New("disk gone") }
+	refused, err := mgr.OfferBatch([]model.Event{priceEvent("s", 3, 1)})
+	if !errors.Is(err, ErrNotDurable) || refused == nil || refused[0] != nil {
+		t.Fatalf("expected the event admitted with ErrNotDurable, got %v %v", refused, err)
+	}
+	if s, _, _ := mgr.EventStatus(3); s.Status != StatusQueued {
+		t.Fatalf("sequence 3 status %q, want queued", s.Status)
+	}
+	// The evicted event was completed despite the failed sync.
+	if s, _, _ := mgr.EventStatus(1); s.Status != StatusDropped {
+		t.Fatalf("sequence 1 status %q, want dropped", s.Status)
+	}
+	if b := pendingEvents(q); len(b) != 2 || b[1].Sequence != 3 {
+		t.Fatalf("unexpected backlog: %+v", b)
+	}
+}
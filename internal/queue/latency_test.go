@@ -0,0 +1,95 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/config"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/model"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/obs"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/store"
+)
+
+func TestLatencyHistogramsAndSLOBreaches(t *testing.T) {
+	obs.InitLogger()
+	cfg := config.Load()
+	cfg.InitialWorkerCount = 1
+	cfg.SLOLatencyTarget = 20 * time.Millisecond
+	mgr := NewManager(cfg, New(8), store.New())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mgr.Start(ctx)
+	defer mgr.Stop()
+
+	price := 1.0
+	now := time.Now()
+	for i, received := range []time.Time{now.Add(-time.Second), now, {}} {
+		ev := model.Event{ProductID: "lat", Price: &price, Sequence: mgr.NextSequence(), ReceivedAt: received}
+		if err := mgr.Offer(ev); err != nil {
+			t.Fatalf("offer %d: %v", i, err)
+		}
+	}
+	queueWait, apply, endToEnd := mgr.Latencies()
+	// Histograms are updated after an event is acknowledged, so poll.
+	deadline := time.Now().Add(2 * time.Second)
+	for apply.Snapshot().Count < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if queueWait.Snapshot().Count != 3 || apply.Snapshot().Count != 3 {
+		t.Fatalf("queue wait %+v, apply %+v; want 3 observations each", queueWait.Snapshot(), apply.Snapshot())
+	}
+	// Without an intake time the enqueue time is used.
+	e2e := endToEnd.Snapshot()
+	if e2e.Count != 3 || e2e.MaxMs < 1000 {
+		t.Fatalf("end to end %+v", e2e)
+	}
+	if target, breaches := mgr.SLOStats(); target != 20*time.Millisecond || breaches != 1 {
+		t.Fatalf("slo target %s breaches %d, want 20ms and 1", target, breaches)
+	}
+}
+
+func TestReplayedDeadLetterRestartsLatencyClock(t *testing.T) {
+	obs.InitLogger()
+	cfg := config.Load()
+	cfg.InitialWorkerCount = 1
+	cfg.ApplyMaxRetries = 0
+	cfg.SLOLatencyTarget = time.Second
+	st := newFlakyStore("bad")
+	mgr := NewManager(cfg, New(8), st)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mgr.Start(ctx)
+	defer mgr.Stop()
+
+	price := 1.0
+	ev := model.Event{ProductID: "bad", Price: &price, Sequence: mgr.NextSequence(), ReceivedAt: time.Now().Add(-time.Hour)}
+	if err := mgr.Offer(ev); err != nil {
+		t.Fatalf("offer: %v", err)
+	}
+	drain := func() {
+		t.Helper()
+		ctxDrain, cancelDrain := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancelDrain()
+		if !mgr.DrainUntil(ctxDrain) {
+			t.Fatalf("drain timeout")
+		}
+	}
+	drain()
+	st.heal("bad")
+	if _, err := mgr.ReplayDeadLetters(nil); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	drain()
+	_, _, endToEnd := mgr.Latencies()
+	deadline := time.Now().Add(2 * time.Second)
+	for endToEnd.Snapshot().Count < 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if e2e := endToEnd.Snapshot(); e2e.Count != 1 || e2e.MaxMs >= 1000 {
+		t.Fatalf("end to end %+v; want one observation from the replay", e2e)
+	}
+	if _, breaches := mgr.SLOStats(); breaches != 0 {
+		t.Fatalf("breaches = %d, want 0", breaches)
+	}
+}
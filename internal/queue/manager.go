@@ -3,42 +3,155 @@ package queue
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/fairyhunter13/product-update-service-simulator/internal/changes"
 	"github.com/fairyhunter13/product-update-service-simulator/internal/config"
 	"github.com/fairyhunter13/product-update-service-simulator/internal/model"
 	"github.com/fairyhunter13/product-update-service-simulator/internal/obs"
 	"github.com/fairyhunter13/product-update-service-simulator/internal/store"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/tracing"
 )
 
 // Manager coordinates workers processing queued events and scaling.
 type Manager struct {
+	// cfgMu guards the pool and scaler fields of cfg, policy and pinned,
+	// which the admin API changes at runtime.
+	cfgMu  sync.RWMutex
 	cfg    config.Config
 	q      *Queue
-	st     *store.Store
+	st     store.ProductStore
 	seq    Sequencer
 	ctx    context.Context
 	cancel context.CancelFunc
 
 	mu            sync.Mutex
 	workerCancels []context.CancelFunc
+	// running tracks worker, lane worker and dispatch goroutines so Stop
+	// can wait for them.
+	running sync.WaitGroup
+
+	// parts is non-nil in partitioned dispatch mode.
+	parts *partitioner
+
+	status *StatusTracker
+
+	dlq          *DeadLetterQueue
+	applyRetries atomic.Uint64
+	deadLettered atomic.Uint64
+	// staleSkipped counts events Store.Upsert skipped by sequence gating;
+	// staleVersions and duplicateVersions those skipped by client version.
+	staleSkipped      atomic.Uint64
+	staleVersions     atomic.Uint64
+	duplicateVersions atomic.Uint64
+
+	// poison holds events whose processing panicked.
+	poison         *DeadLetterQueue
+	workerCrashes  atomic.Uint64
+	workerRestarts atomic.Uint64
+
+	policy     ScalingPolicy
+	pinned     bool
+	scalerKick chan struct{}
+	scalerDone chan struct{}
+	scaleMu    sync.Mutex
+	// scaleUps, scaleDowns and scaleHolds count scaler decisions.
+	scaleUps   atomic.Uint64
+	scaleDowns atomic.Uint64
+	scaleHolds atomic.Uint64
+	// pendingWorkers is a partitioned resize deferred while paused; 0 if none.
+	pendingWorkers int
+	gate           *gate
+	now            func() time.Time
+	// applyCount and applyNanos accumulate per-event processing time.
+	applyCount atomic.Uint64
+	applyNanos atomic.Uint64
+	// queueWait, applyTime and endToEnd are the latency histograms behind
+	// the SLO; sloBreaches counts applied events over the target and
+	// sloLogged is when a breach was last logged, in Unix nanoseconds.
+	queueWait   obs.LatencyHistogram
+	applyTime   obs.LatencyHistogram
+	endToEnd    obs.LatencyHistogram
+	sloBreaches atomic.Uint64
+	sloLogged   atomic.Int64
+
+	changeLog *changes.Log
+	tracer    *tracing.Tracer
+	// applyLocks serialise apply+record per product (striped by hash) so
+	// the change log sees each product's changes in the order they applied.
+	applyLocks [64]sync.Mutex
 }
 
 // NewManager constructs a Manager with the given config, queue, and store.
-func NewManager(cfg config.Config, q *Queue, st *store.Store) *Manager {
-	return &Manager{cfg: cfg, q: q, st: st}
+func NewManager(cfg config.Config, q *Queue, st store.ProductStore) *Manager {
+	m := &Manager{
+		cfg:        cfg,
+		q:          q,
+		st:         st,
+		status:     NewStatusTracker(cfg.EventStatusRetention),
+		dlq:        NewDeadLetterQueue(cfg.DLQSize),
+		poison:     NewDeadLetterQueue(cfg.DLQSize),
+		changeLog:  changes.NewLog(cfg.ChangeLogSize),
+		now:        time.Now,
+		scalerKick: make(chan struct{}, 1),
+		gate:       newGate(),
+		tracer:     tracing.NewTracer(nil),
+	}
+	if cfg.DispatchMode == DispatchPartitioned {
+		m.parts = &partitioner{}
+	}
+	policy, err := NewScalingPolicy(cfg)
+	if err != nil {
+		obs.Logger.Warn("scale_policy_unknown", "policy", cfg.ScalePolicy, "fallback", PolicyThreshold)
+		policy = &ThresholdPolicy{UpBacklogPerWorker: cfg.ScaleUpBacklogPerWorker, DownIdleTicks: cfg.ScaleDownIdleTicks}
+	}
+	m.policy = policy
+	if err := q.SetCapacity(cfg.QueueCapacity, cfg.QueueOverloadPolicy, m.dropEvicted); err != nil {
+		obs.Logger.Warn("queue_overload_policy_invalid", "error", err, "fallback", OverloadReject)
+		_ = q.SetCapacity(max(cfg.QueueCapacity, 0), OverloadReject, m.dropEvicted)
+	}
+	q.SetCoalescing(cfg.QueueCoalesce)
+	weights, err := ParsePriorityWeights(cfg.QueuePriorityWeights)
+	if err != nil {
+		obs.Logger.Warn("queue_priority_weights_invalid", "error", err, "fallback", DefaultPriorityWeights)
+		weights = DefaultPriorityWeights
+	}
+	_ = q.SetPriorityWeights(weights)
+	q.SetRelease(&m.seq, m.released)
+	order, err := store.ParseOrdering(cfg.OrderingMode)
+	if err != nil {
+		obs.Logger.Warn("ordering_mode_invalid", "error", err, "fallback", store.OrderSequence)
+	}
+	q.SetOrdering(order)
+	return m
 }
 
 // Start begins processing and autoscaling in the background.
 func (m *Manager) Start(parent context.Context) {
 	m.ctx, m.cancel = context.WithCancel(parent)
 	m.q.Start(m.ctx, m.cfg.QueueHighWatermark)
+	if m.parts != nil {
+		m.running.Add(1)
+		go func() {
+			defer m.running.Done()
+			m.dispatch(m.ctx)
+		}()
+	}
 	m.addWorkers(m.cfg.InitialWorkerCount)
+	m.scalerDone = make(chan struct{})
 	go m.scaler()
 }
 
-// Stop cancels background routines and stops workers.
+// Stop cancels background routines and stops workers. It waits for the
+// scaler to exit so no resize races the caller, then for the workers, so
+// none is still processing an event when Stop returns.
 func (m *Manager) Stop() {
 	if m.cancel != nil {
 		m.cancel()
@@ -49,52 +162,159 @@ func (m *Manager) Stop() {
 	}
 	m.workerCancels = nil
 	m.mu.Unlock()
+	if m.scalerDone != nil {
+		<-m.scalerDone
+	}
+	m.running.Wait()
 }
 
-// scaler adjusts worker count based on backlog and configuration.
+// scaler feeds a Sample to the scaling policy on every tick and moves the
+// pool to the clamped target. It stands still while the pool is pinned or
+// processing is paused.
 func (m *Manager) scaler() {
-	t := time.NewTicker(m.cfg.ScaleInterval)
+	defer close(m.scalerDone)
+	cfg, _, _ := m.scalerState()
+	t := time.NewTicker(cfg.ScaleInterval)
 	defer t.Stop()
-	idleTicks := 0
+	prev := m.counters()
 	for {
 		select {
 		case <-m.ctx.Done():
 			return
+		case <-m.scalerKick:
+			cfg, _, _ := m.scalerState()
+			t.Reset(cfg.ScaleInterval)
 		case <-t.C:
-			backlog := m.q.BacklogSize()
-			wc := m.WorkerCount()
-			if backlog > wc*m.cfg.ScaleUpBacklogPerWorker && wc < m.cfg.WorkerMax {
-				m.addWorkers(1)
-				idleTicks = 0
+			cfg, policy, pinned := m.scalerState()
+			cur := m.counters()
+			s := m.sample(prev, cur, cfg)
+			prev = cur
+			if pinned || m.q.Paused() {
 				continue
 			}
-			if backlog == 0 {
-				idleTicks++
-				if idleTicks >= m.cfg.ScaleDownIdleTicks && wc > m.cfg.WorkerMin {
-					m.removeWorkers(1)
-					idleTicks = 0
-				}
-			} else {
-				idleTicks = 0
+			d := policy.Decide(s)
+			target := clampWorkers(d.Target, s.Min, s.Max)
+			switch {
+			case target > s.Workers:
+				m.scaleUps.Add(1)
+			case target < s.Workers:
+				m.scaleDowns.Add(1)
+			default:
+				m.scaleHolds.Add(1)
+				obs.Logger.Debug("scale_hold", "worker_count", s.Workers, "reason", d.Reason, "backlog_size", s.Backlog)
+				continue
 			}
+			obs.Logger.Info("scale_decision",
+				"from", s.Workers,
+				"to", target,
+				"reason", d.Reason,
+				"backlog_size", s.Backlog,
+				"throughput", s.Throughput(),
+				"latency_ms", s.Latency.Milliseconds(),
+			)
+			m.setWorkers(target)
 		}
 	}
 }
 
+// scalerState returns the runtime-tunable settings, policy and pin flag.
+func (m *Manager) scalerState() (config.Config, ScalingPolicy, bool) {
+	m.cfgMu.RLock()
+	defer m.cfgMu.RUnlock()
+	return m.cfg, m.policy, m.pinned
+}
+
+// scaleCounters is a snapshot of the cumulative counters a Sample is
+// derived from.
+type scaleCounters struct {
+	at                 time.Time
+	enq, proc          uint64
+	applyN, applyNanos uint64
+}
+
+func (m *Manager) counters() scaleCounters {
+	enq, proc, _, _ := m.q.Metrics()
+	return scaleCounters{
+		at:         m.now(),
+		enq:        enq,
+		proc:       proc,
+		applyN:     m.applyCount.Load(),
+		applyNanos: m.applyNanos.Load(),
+	}
+}
+
+// sample builds the policy input for the tick between prev and cur.
+func (m *Manager) sample(prev, cur scaleCounters, cfg config.Config) Sample {
+	s := Sample{
+		Now:       cur.at,
+		Interval:  cur.at.Sub(prev.at),
+		Backlog:   m.q.BacklogSize(),
+		Workers:   m.WorkerCount(),
+		Arrived:   cur.enq - prev.enq,
+		Processed: cur.proc - prev.proc,
+		Min:       cfg.WorkerMin,
+		Max:       cfg.WorkerMax,
+	}
+	if n := cur.applyN - prev.applyN; n > 0 {
+		s.Latency = time.Duration((cur.applyNanos - prev.applyNanos) / n) //nolint:gosec // mean of durations fits
+	}
+	return s
+}
+
+// SetScalingPolicy replaces the scaling policy; call it before Start.
+func (m *Manager) SetScalingPolicy(p ScalingPolicy) {
+	m.cfgMu.Lock()
+	defer m.cfgMu.Unlock()
+	m.policy = p
+}
+
+// setWorkers moves the pool to n workers. In partitioned mode a resize
+// drains the current lanes, which cannot happen while processing is
+// paused, so the change is deferred until Resume.
+func (m *Manager) setWorkers(n int) {
+	m.scaleMu.Lock()
+	defer m.scaleMu.Unlock()
+	if m.parts != nil && m.q.Paused() {
+		m.pendingWorkers = n
+		obs.Logger.Info("workers_resize_deferred", "worker_count", m.WorkerCount(), "target", n)
+		return
+	}
+	switch wc := m.WorkerCount(); {
+	case n > wc:
+		m.addWorkers(n - wc)
+	case n < wc:
+		m.removeWorkers(wc - n)
+	}
+}
+
 // addWorkers spawns n workers.
 func (m *Manager) addWorkers(n int) {
+	if m.parts != nil {
+		m.resizeLanes(m.WorkerCount() + n)
+		obs.Logger.Info("workers scaled", "worker_count", m.WorkerCount(), "dispatch_mode", DispatchPartitioned)
+		return
+	}
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	for i := 0; i < n; i++ {
 		wctx, cancel := context.WithCancel(m.ctx)
 		m.workerCancels = append(m.workerCancels, cancel)
-		go m.worker(wctx)
+		m.running.Add(1)
+		go func() {
+			defer m.running.Done()
+			m.worker(wctx)
+		}()
 	}
 	obs.Logger.Info("workers scaled", "worker_count", len(m.workerCancels))
 }
 
 // removeWorkers stops up to n workers.
 func (m *Manager) removeWorkers(n int) {
+	if m.parts != nil {
+		m.resizeLanes(m.WorkerCount() - n)
+		obs.Logger.Info("workers scaled", "worker_count", m.WorkerCount(), "dispatch_mode", DispatchPartitioned)
+		return
+	}
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	if n > len(m.workerCancels) {
@@ -110,19 +330,463 @@ func (m *Manager) removeWorkers(n int) {
 
 // worker drains events from the queue and updates the store.
 func (m *Manager) worker(ctx context.Context) {
+	m.supervise(func(cur *model.Event) {
+		for {
+			running, paused := m.gate.state()
+			select {
+			case <-ctx.Done():
+				return
+			case <-running:
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-paused:
+			case ev := <-m.q.Out():
+				*cur = ev
+				m.process(ev)
+				*cur = model.Event{}
+			}
+		}
+	})
+}
+
+// supervise runs a worker loop, restarting it in place after each panic so
+// the pool keeps its size. The loop publishes its in-flight event via cur.
+func (m *Manager) supervise(loop func(cur *model.Event)) {
+	for m.runGuarded(loop) {
+		if m.ctx.Err() != nil {
+			return
+		}
+		m.workerRestarts.Add(1)
+		obs.Logger.Warn("worker_restarted", "worker_restarts", m.workerRestarts.Load())
+	}
+}
+
+// runGuarded runs loop and reports whether it ended in a recovered panic.
+func (m *Manager) runGuarded(loop func(cur *model.Event)) (crashed bool) {
+	var cur model.Event
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		crashed = true
+		m.workerCrashes.Add(1)
+		if cur.Sequence == 0 {
+			obs.Logger.Error("worker_panic", "panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+			// Not tied to an event; avoid a hot restart loop.
+			time.Sleep(100 * time.Millisecond)
+			return
+		}
+		eventLogger(cur).Error("worker_panic",
+			"product_id", cur.ProductID,
+			"sequence", cur.Sequence,
+			"panic", fmt.Sprint(r),
+			"stack", string(debug.Stack()),
+		)
+		m.poison.Add(newDeadEvent(cur, 1, fmt.Errorf("panic: %v", r)))
+		m.finish(cur, StatusDropped)
+	}()
+	loop(&cur)
+	return false
+}
+
+// process applies one event to the store and acknowledges it. A failed
+// apply is retried per the configured policy; an event that still fails is
+// moved to the dead-letter queue.
+func (m *Manager) process(ev model.Event) {
+	start := time.Now()
+	parent, _ := tracing.ParseTraceparent(ev.TraceParent)
+	var wait time.Duration
+	if !ev.EnqueuedAt.IsZero() {
+		wait = start.Sub(ev.EnqueuedAt)
+		m.queueWait.Observe(wait)
+		m.tracer.StartFrom(parent, "queue.wait", ev.EnqueuedAt, eventSpanAttrs(ev)...).End()
+	}
+	span := m.tracer.StartFrom(parent, "store.apply", start, eventSpanAttrs(ev)...)
+	span.SetKind(tracing.KindConsumer)
+	defer func() {
+		took := time.Since(start)
+		m.applyCount.Add(1)
+		m.applyNanos.Add(uint64(took)) //nolint:gosec // durations are positive
+		m.applyTime.Observe(took)
+		span.End()
+	}()
+	m.status.Set(ev.Sequence, ev.ProductID, StatusProcessing)
+	res, attempts, err := m.applyWithRetry(ev)
+	span.SetAttrs(tracing.Int("attempts", int64(attempts)))
+	span.RecordError(err)
+	switch {
+	case err != nil && m.ctx.Err() != nil:
+		// Stopped mid-retry: leave the event unacknowledged so a durable
+		// queue replays it on the next start.
+		eventLogger(ev).Warn("event_apply_aborted", "product_id", ev.ProductID, "sequence", ev.Sequence, "attempts", attempts, "error", err)
+		return
+	case err != nil:
+		eventLogger(ev).Error("event_apply_failed", "product_id", ev.ProductID, "sequence", ev.Sequence, "attempts", attempts, "error", err)
+		m.dlq.Add(newDeadEvent(ev, attempts, err))
+		m.deadLettered.Add(1)
+		m.finish(ev, StatusDropped)
+		span.SetAttrs(tracing.String("status", StatusDropped))
+	case res.Applied:
+		m.finish(ev, StatusApplied)
+		m.observeVisible(ev, wait, time.Now())
+		span.SetAttrs(tracing.String("status", StatusApplied))
+	default:
+		m.skipped(ev, res.Reason)
+		span.SetAttrs(tracing.String("status", StatusSuperseded), tracing.String("reason", res.Reason))
+	}
+}
+
+// skipped completes an event the store did not apply and records why.
+// Skips by client version are logged: they mean the producer sent updates
+// out of order. Stale sequences are routine, e.g. after a journal replay.
+func (m *Manager) skipped(ev model.Event, reason string) {
+	switch reason {
+	case store.ReasonStaleVersion:
+		m.staleVersions.Add(1)
+	case store.ReasonDuplicateVersion:
+		m.duplicateVersions.Add(1)
+	default:
+		m.staleSkipped.Add(1)
+	}
+	if reason == store.ReasonStaleVersion || reason == store.ReasonDuplicateVersion {
+		eventLogger(ev).Info("event_out_of_order",
+			"product_id", ev.ProductID,
+			"sequence", ev.Sequence,
+			"version", store.ClientVersion(ev),
+			"reason", reason,
+		)
+	}
+	// Record the reason before finish so it is visible once the event
+	// counts as processed.
+	m.status.SetReason(ev.Sequence, reason)
+	for _, seq := range ev.Merged {
+		m.status.SetReason(seq, reason)
+	}
+	m.finish(ev, StatusSuperseded)
+}
+
+// observeVisible records the intake-to-visible latency of an applied event
+// and reports it when it exceeds SLO_LATENCY_TARGET_MS. Breaches are logged
+// at most once a second, with the running total, so an overload does not
+// flood the log. Events without an intake time, such as those replayed
+// from the journal of an older build, fall back to their enqueue time.
+func (m *Manager) observeVisible(ev model.Event, wait time.Duration, at time.Time) {
+	from := ev.ReceivedAt
+	if from.IsZero() {
+		from = ev.EnqueuedAt
+	}
+	if from.IsZero() {
+		return
+	}
+	lat := at.Sub(from)
+	m.endToEnd.Observe(lat)
+	target := m.cfg.SLOLatencyTarget
+	if target <= 0 || lat <= target {
+		return
+	}
+	total := m.sloBreaches.Add(1)
+	last := m.sloLogged.Load()
+	if at.UnixNano()-last < int64(time.Second) || !m.sloLogged.CompareAndSwap(last, at.UnixNano()) {
+		return
+	}
+	eventLogger(ev).Warn("slo_latency_breach",
+		"product_id", ev.ProductID,
+		"sequence", ev.Sequence,
+		"latency_ms", float64(lat.Microseconds())/1000.0,
+		"queue_wait_ms", float64(wait.Microseconds())/1000.0,
+		"target_ms", target.Milliseconds(),
+		"breaches_total", total,
+	)
+}
+
+// eventSpanAttrs identifies ev on worker-side spans.
+func eventSpanAttrs(ev model.Event) []tracing.Attr {
+	return []tracing.Attr{
+		tracing.String("product_id", ev.ProductID),
+		tracing.Uint("sequence", ev.Sequence),
+		tracing.String("request_id", ev.RequestID),
+	}
+}
+
+// eventLogger returns a logger carrying the request ID and trace ID of the
+// request that accepted ev, so worker logs can be joined to it.
+func eventLogger(ev model.Event) *slog.Logger {
+	sc, _ := tracing.ParseTraceparent(ev.TraceParent)
+	traceID := ""
+	if sc.IsValid() {
+		traceID = sc.TraceID.String()
+	}
+	return obs.Logger.With("request_id", ev.RequestID, "trace_id", traceID)
+}
+
+// finish records the final status of ev, and of any events merged into
+// it, and acknowledges them to the queue.
+func (m *Manager) finish(ev model.Event, status string) {
+	m.status.Set(ev.Sequence, ev.ProductID, status)
+	m.q.MarkProcessed(ev.Sequence)
+	for _, seq := range ev.Merged {
+		m.status.SetMerged(seq, ev.ProductID, status, ev.Sequence)
+		m.q.MarkProcessed(seq)
+	}
+}
+
+// dropEvicted completes a pending event evicted by the drop_oldest
+// overload policy.
+func (m *Manager) dropEvicted(ev model.Event) {
+	obs.Logger.Debug("event_dropped_overload", "product_id", ev.ProductID, "sequence", ev.Sequence)
+	m.finish(ev, StatusDropped)
+}
+
+// released tracks a scheduled event queued under a fresh sequence.
+func (m *Manager) released(orig uint64, ev model.Event) {
+	obs.Logger.Info("scheduled_event_released", "product_id", ev.ProductID, "sequence", orig, "released_as", ev.Sequence)
+	m.status.SetReleased(orig, ev.ProductID, ev.Sequence)
+	m.status.Set(ev.Sequence, ev.ProductID, StatusQueued)
+}
+
+// applyWithRetry applies ev, retrying failures up to ApplyMaxRetries times
+// with jittered exponential backoff. It returns the number of attempts made.
+func (m *Manager) applyWithRetry(ev model.Event) (store.Result, int, error) {
+	attempts := 0
 	for {
+		attempts++
+		res, err := m.apply(ev)
+		if err == nil || attempts > m.cfg.ApplyMaxRetries {
+			return res, attempts, err
+		}
+		m.applyRetries.Add(1)
+		delay := retryDelay(attempts, m.cfg.ApplyRetryBackoff, m.cfg.ApplyRetryMaxBackoff)
+		eventLogger(ev).Warn("event_apply_retry", "product_id", ev.ProductID, "sequence", ev.Sequence, "attempt", attempts, "delay_ms", delay.Milliseconds(), "error", err)
+		t := time.NewTimer(delay)
 		select {
-		case <-ctx.Done():
-			return
-		case ev := <-m.q.Out():
-			m.st.Upsert(ev)
-			m.q.MarkProcessed()
+		case <-m.ctx.Done():
+			t.Stop()
+			return res, attempts, err
+		case <-t.C:
+		}
+	}
+}
+
+// retryDelay returns the wait before retry n (1-based): base doubled per
+// retry and capped at max, with equal jitter (half fixed, half random) so
+// workers retrying together spread out.
+func retryDelay(n int, base, maxDelay time.Duration) time.Duration {
+	d := maxDelay
+	if n <= 30 {
+		if b := base << (n - 1); b > 0 && b < maxDelay {
+			d = b
+		}
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + rand.N(d-half)
+}
+
+// ApplyMetrics returns apply retries, events dead-lettered, current DLQ
+// size, and dead events evicted from a full DLQ.
+func (m *Manager) ApplyMetrics() (retries, deadLettered uint64, dlqSize int, dlqEvicted uint64) {
+	return m.applyRetries.Load(), m.deadLettered.Load(), m.dlq.Len(), m.dlq.Evicted()
+}
+
+// StaleSkipped returns how many events Store.Upsert skipped because the
+// product already had a newer sequence.
+func (m *Manager) StaleSkipped() uint64 { return m.staleSkipped.Load() }
+
+// SkipStats returns how many events Store.Upsert skipped, by reason.
+func (m *Manager) SkipStats() map[string]uint64 {
+	return map[string]uint64{
+		store.ReasonStaleSequence:    m.staleSkipped.Load(),
+		store.ReasonStaleVersion:     m.staleVersions.Load(),
+		store.ReasonDuplicateVersion: m.duplicateVersions.Load(),
+	}
+}
+
+// ScaleDecisions returns how many scaler ticks decided to add workers,
+// remove workers, or hold. Ticks while pinned or paused are not counted.
+func (m *Manager) ScaleDecisions() (up, down, hold uint64) {
+	return m.scaleUps.Load(), m.scaleDowns.Load(), m.scaleHolds.Load()
+}
+
+// CrashMetrics returns recovered worker panics, worker restarts, and the
+// number of events in the poison bucket.
+func (m *Manager) CrashMetrics() (crashes, restarts uint64, poisoned int) {
+	return m.workerCrashes.Load(), m.workerRestarts.Load(), m.poison.Len()
+}
+
+// PoisonEvents returns the events whose processing panicked, oldest first.
+func (m *Manager) PoisonEvents() []DeadEvent { return m.poison.List() }
+
+// DeadLetters returns the events in the dead-letter queue, oldest first.
+func (m *Manager) DeadLetters() []DeadEvent { return m.dlq.List() }
+
+// ReplayDeadLetters re-enqueues the dead events with the given sequences
+// (all when seqs is empty) under their original sequence, so sequence
+// gating still applies. It returns the replayed sequences and, when the
+// queue refused an event, the refusal (see Queue.Offer); the refused event
+// and the rest stay in the dead-letter queue. Replayed events restart
+// their latency clock, so time spent dead-lettered is not counted as
+// queue wait or intake-to-visible latency.
+func (m *Manager) ReplayDeadLetters(seqs []uint64) ([]uint64, error) {
+	if m.q.IsShuttingDown() {
+		return nil, ErrShuttingDown
+	}
+	taken := m.dlq.Take(seqs)
+	out := make([]uint64, 0, len(taken))
+	for i, d := range taken {
+		ev := d.event
+		ev.ReceivedAt, ev.EnqueuedAt = time.Time{}, time.Time{}
+		// Requeue before Offer: once offered, a worker may finish the
+		// event before a later Requeue would reset its result.
+		m.status.Requeue(d.Sequence, d.ProductID)
+		// ErrNotDurable still queued the event.
+		if err := m.q.Offer(ev); err != nil && !errors.Is(err, ErrNotDurable) {
+			m.status.Set(d.Sequence, d.ProductID, StatusDropped)
+			for _, rest := range taken[i:] {
+				m.dlq.Add(rest)
+			}
+			if len(out) > 0 {
+				obs.Logger.Info("dlq_replayed", "count", len(out))
+			}
+			return out, err
+		}
+		out = append(out, d.Sequence)
+	}
+	if len(out) > 0 {
+		obs.Logger.Info("dlq_replayed", "count", len(out))
+	}
+	return out, nil
+}
+
+// apply upserts ev and records the change when it mutated the product.
+func (m *Manager) apply(ev model.Event) (store.Result, error) {
+	mu := &m.applyLocks[partitionFor(ev.ProductID, len(m.applyLocks))]
+	mu.Lock()
+	defer mu.Unlock()
+	res, err := m.st.Upsert(ev)
+	if err == nil && res.Applied {
+		m.changeLog.Append(changes.Change{
+			Sequence:  ev.Sequence,
+			ProductID: ev.ProductID,
+			Product:   res.Product,
+			Previous:  res.Previous,
+			ChangedAt: time.Now().UTC(),
+		})
+	}
+	return res, err
+}
+
+// Changes returns the log of applied product changes, or nil when
+// CHANGE_LOG_SIZE disables it.
+func (m *Manager) Changes() *changes.Log { return m.changeLog }
+
+// Enqueue proxies to the underlying queue and tracks the event as queued.
+func (m *Manager) Enqueue(ev model.Event) bool {
+	err := m.Offer(ev)
+	return err == nil || errors.Is(err, ErrNotDurable)
+}
+
+// EnqueueBatch proxies to the underlying queue and tracks events as queued.
+func (m *Manager) EnqueueBatch(evs []model.Event) bool {
+	_, err := m.OfferBatch(evs)
+	return err == nil || errors.Is(err, ErrNotDurable)
+}
+
+// Latencies returns the histograms of queue wait (enqueue to worker
+// pickup), apply time (including retries) and intake-to-visible latency.
+func (m *Manager) Latencies() (queueWait, apply, endToEnd *obs.LatencyHistogram) {
+	return &m.queueWait, &m.applyTime, &m.endToEnd
+}
+
+// SLOStats returns the intake-to-visible latency target (0 when disabled)
+// and the number of applied events that exceeded it.
+func (m *Manager) SLOStats() (target time.Duration, breaches uint64) {
+	return m.cfg.SLOLatencyTarget, m.sloBreaches.Load()
+}
+
+// SetTracer sets the tracer for worker-side spans. Call before events
+// are offered.
+func (m *Manager) SetTracer(t *tracing.Tracer) { m.tracer = t }
+
+// Tracer returns the manager's tracer, which the HTTP layer shares.
+func (m *Manager) Tracer() *tracing.Tracer { return m.tracer }
+
+// Offer enqueues ev under the queue's overload policy (see Queue.Offer)
+// and tracks it as queued, or as dropped when the policy discarded it.
+func (m *Manager) Offer(ev model.Event) error {
+	refused, err := m.OfferBatch([]model.Event{ev})
+	if refused != nil && refused[0] != nil {
+		return refused[0]
+	}
+	return err
+}
+
+// OfferBatch enqueues evs under the queue's overload policy (see
+// Queue.OfferBatch) and tracks each event's status. Events with
+// EffectiveAt set are held until then; clear it for events already due.
+// Statuses are tracked also when err wraps ErrNotDurable, as the events
+// were queued.
+func (m *Manager) OfferBatch(evs []model.Event) ([]error, error) {
+	refused, err := m.q.OfferBatch(evs)
+	if refused == nil {
+		return nil, err
+	}
+	for i, ev := range evs {
+		switch refused[i] {
+		case nil:
+			status := StatusQueued
+			if ev.EffectiveAt != nil {
+				status = StatusScheduled
+			}
+			m.status.Set(ev.Sequence, ev.ProductID, status)
+		case ErrEventDropped:
+			m.status.Set(ev.Sequence, ev.ProductID, StatusDropped)
 		}
 	}
+	return refused, err
+}
+
+// OverloadStats returns the queue capacity settings and overload counters.
+func (m *Manager) OverloadStats() OverloadStats { return m.q.OverloadStats() }
+
+// CoalesceStats returns the coalescing queue's merge count and the share
+// of admitted events that were merged away.
+func (m *Manager) CoalesceStats() (merged uint64, ratio float64) { return m.q.CoalesceStats() }
+
+// Now returns the time scheduled events are released against.
+func (m *Manager) Now() time.Time { return m.q.Now() }
+
+// ScheduledEvents returns the events held until their effective time.
+func (m *Manager) ScheduledEvents() []ScheduledEvent { return m.q.Scheduled() }
+
+// ScheduledStats returns the held event count and the released and
+// cancelled totals.
+func (m *Manager) ScheduledStats() (held int, released, cancelled uint64) {
+	return m.q.ScheduledStats()
+}
+
+// CancelScheduled cancels the held event with sequence seq.
+func (m *Manager) CancelScheduled(seq uint64) (ScheduledEvent, bool) {
+	ev, ok := m.q.CancelScheduled(seq)
+	if ok {
+		m.status.Set(seq, ev.ProductID, StatusCancelled)
+	}
+	return ev, ok
 }
 
-// Enqueue proxies to the underlying queue.
-func (m *Manager) Enqueue(ev model.Event) bool { return m.q.Enqueue(ev) }
+// LaneBacklog returns the pending events per priority lane.
+func (m *Manager) LaneBacklog() map[string]int { return m.q.LaneBacklog() }
+
+// EventStatus returns the tracked processing status of a sequence. expired
+// is true when the sequence aged out of the retention window.
+func (m *Manager) EventStatus(seq uint64) (st EventStatus, ok, expired bool) {
+	st, ok = m.status.Get(seq)
+	return st, ok, !ok && m.status.Expired(seq)
+}
 
 // BacklogSize returns pending items in the queue.
 func (m *Manager) BacklogSize() int { return m.q.BacklogSize() }
@@ -132,6 +796,9 @@ func (m *Manager) QueueDepth() int { return m.q.QueueDepth() }
 
 // WorkerCount returns the current number of workers.
 func (m *Manager) WorkerCount() int {
+	if m.parts != nil {
+		return int(m.parts.count.Load())
+	}
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	return len(m.workerCancels)
@@ -140,6 +807,13 @@ func (m *Manager) WorkerCount() int {
 // NextSequence returns the next sequence number.
 func (m *Manager) NextSequence() uint64 { return m.seq.Next() }
 
+// NextSequences reserves n consecutive sequence numbers and returns the first.
+func (m *Manager) NextSequences(n int) uint64 { return m.seq.NextN(n) }
+
+// SeedSequence ensures future sequences are greater than n, e.g. the
+// highest sequence recovered from persistent storage.
+func (m *Manager) SeedSequence(n uint64) { m.seq.Advance(n) }
+
 // IsShuttingDown reports whether new enqueues are rejected.
 func (m *Manager) IsShuttingDown() bool { return m.q.IsShuttingDown() }
 
@@ -0,0 +1,314 @@
+package queue
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/model"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/obs"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/store"
+)
+
+// Overload policies applied when a bounded queue is at capacity.
+const (
+	// OverloadReject refuses new events with ErrQueueFull.
+	OverloadReject = "reject"
+	// OverloadDropOldest evicts the oldest pending event to make room.
+	OverloadDropOldest = "drop_oldest"
+	// OverloadDropNewest discards the incoming event with ErrEventDropped.
+	OverloadDropNewest = "drop_newest"
+	// OverloadCoalesce merges the incoming event into the pending event for
+	// the same product; events for products with nothing pending are
+	// refused with ErrQueueFull.
+	OverloadCoalesce = "coalesce"
+)
+
+// Admission errors.
+var (
+	ErrShuttingDown = errors.New("queue: intake closed")
+	ErrQueueFull    = errors.New("queue: at capacity")
+	ErrEventDropped = errors.New("queue: event dropped at capacity")
+	// ErrNotDurable reports that admitted events are queued and will be
+	// processed, but the journal failed to sync them to disk.
+	ErrNotDurable = errors.New("queue: journal sync failed")
+)
+
+// ValidOverloadPolicy reports whether p names an overload policy.
+func ValidOverloadPolicy(p string) bool {
+	switch p {
+	case OverloadReject, OverloadDropOldest, OverloadDropNewest, OverloadCoalesce:
+		return true
+	}
+	return false
+}
+
+// OverloadStats reports the capacity settings and what each overload
+// policy has done so far. Counters of policies other than the active one
+// stay at zero unless the policy was changed.
+type OverloadStats struct {
+	Capacity      int    `json:"capacity"`
+	Policy        string `json:"policy"`
+	Rejected      uint64 `json:"rejected"`
+	DroppedOldest uint64 `json:"dropped_oldest"`
+	DroppedNewest uint64 `json:"dropped_newest"`
+	Coalesced     uint64 `json:"coalesced"`
+}
+
+// admission is the decision for one offered event.
+type admission uint8
+
+const (
+	admitAppend   admission = iota
+	admitEvict              // append, then evict the oldest pending event
+	admitMerge              // merge into the pending event (coalescing queue)
+	admitCoalesce           // merge into the pending event (coalesce policy)
+	admitSchedule           // hold until the event's effective time
+	refuseFull
+	refuseDrop
+)
+
+// SetCoalescing turns on merging of every offered event into the pending
+// event for the same product, whether or not the queue is at capacity.
+// Call it before Start.
+func (q *Queue) SetCoalescing(on bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.coalesce = on
+}
+
+// SetOrdering makes merges keep the fields of the event that order would
+// apply last, so coalescing agrees with the store. Call it before Start.
+func (q *Queue) SetOrdering(order store.Ordering) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.order = order
+}
+
+// CoalesceStats returns how many offered events were merged into a pending
+// event by the coalescing queue, and the merge ratio: the share of all
+// admitted events, merges by either the coalescing queue or the coalesce
+// overload policy included, that were folded away instead of applied.
+func (q *Queue) CoalesceStats() (merged uint64, ratio float64) {
+	q.mu.Lock()
+	merged, total := q.merged, q.merged+q.coalesced
+	q.mu.Unlock()
+	if enq := q.enqueued.Load(); enq > 0 {
+		ratio = float64(total) / float64(enq)
+	}
+	return merged, ratio
+}
+
+// SetCapacity bounds the backlog to capacity events (0 = unbounded) and
+// selects the overload policy. onDrop is called, outside the queue lock,
+// with every pending event evicted by OverloadDropOldest. Call it before
+// Start.
+func (q *Queue) SetCapacity(capacity int, policy string, onDrop func(model.Event)) error {
+	if capacity < 0 {
+		return fmt.Errorf("queue: capacity must be >= 0, got %d", capacity)
+	}
+	if !ValidOverloadPolicy(policy) {
+		return fmt.Errorf("queue: unknown overload policy %q", policy)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.capacity, q.overload, q.onDrop = capacity, policy, onDrop
+	return nil
+}
+
+// OverloadStats returns the capacity settings and overload counters.
+func (q *Queue) OverloadStats() OverloadStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return OverloadStats{
+		Capacity:      q.capacity,
+		Policy:        q.overload,
+		Rejected:      q.rejected,
+		DroppedOldest: q.droppedOldest,
+		DroppedNewest: q.droppedNewest,
+		Coalesced:     q.coalesced,
+	}
+}
+
+// Offer enqueues ev, applying the overload policy when the backlog is at
+// capacity. It returns ErrShuttingDown once intake is closed, ErrQueueFull
+// or ErrEventDropped when the policy refuses the event, or the journal
+// error in durable mode; an error wrapping ErrNotDurable means ev was
+// queued anyway.
+func (q *Queue) Offer(ev model.Event) error {
+	refused, err := q.OfferBatch([]model.Event{ev})
+	if refused != nil && refused[0] != nil {
+		return refused[0]
+	}
+	return err
+}
+
+// OfferBatch enqueues evs as one unit. The returned slice holds, per event,
+// nil when it was admitted or the policy's refusal. Under OverloadReject a
+// batch that does not fit is refused as a whole. err is set, and nothing
+// is enqueued, when intake is closed or the journal rejects a write. When
+// the journal sync after the write fails, err wraps ErrNotDurable and the
+// per-event result is still returned: admitted events stay queued and are
+// processed, only their durability is unknown.
+func (q *Queue) OfferBatch(evs []model.Event) ([]error, error) {
+	if q.shuttingDown.Load() {
+		return nil, ErrShuttingDown
+	}
+	refused := make([]error, len(evs))
+	q.mu.Lock()
+	plan := q.planLocked(evs)
+	admitted := make([]model.Event, 0, len(evs))
+	scheduled := 0
+	for i, a := range plan {
+		switch a {
+		case refuseFull:
+			refused[i] = ErrQueueFull
+		case refuseDrop:
+			refused[i] = ErrEventDropped
+		case admitSchedule:
+			scheduled++
+			admitted = append(admitted, evs[i])
+		default:
+			admitted = append(admitted, evs[i])
+		}
+	}
+	if err := q.journalLocked(admitted); err != nil {
+		q.mu.Unlock()
+		obs.Logger.Error("queue_journal_append_failed", "error", err)
+		return nil, err
+	}
+	var evicted []model.Event
+	for i, a := range plan {
+		switch a {
+		case admitAppend:
+			q.pushLocked(evs[i])
+		case admitEvict:
+			if ev, ok := q.popOldestLocked(q.pushLocked(evs[i])); ok {
+				evicted = append(evicted, ev)
+				q.droppedOldest++
+			}
+		case admitMerge:
+			q.mergeLocked(evs[i])
+			q.merged++
+		case admitCoalesce:
+			q.mergeLocked(evs[i])
+			q.coalesced++
+		case admitSchedule:
+			heap.Push(&q.delayed, evs[i])
+		case refuseFull:
+			q.rejected++
+		case refuseDrop:
+			q.droppedNewest++
+		}
+	}
+	q.enqueued.Add(uint64(len(admitted) - scheduled))
+	onDrop := q.onDrop
+	q.mu.Unlock()
+	var err error
+	if len(admitted) > 0 {
+		// Sync outside q.mu so a slow disk does not stall intake or the
+		// broker; concurrent offers share one fsync. The events are queued
+		// either way, so the broker is woken and evictions completed even
+		// when the sync fails.
+		err = q.commitJournal()
+		select {
+		case q.notify <- struct{}{}:
+		default:
+		}
+	}
+	if onDrop != nil {
+		for _, ev := range evicted {
+			onDrop(ev)
+		}
+	}
+	return refused, err
+}
+
+// planLocked decides, without mutating the queue, how each event of a
+// batch is admitted.
+func (q *Queue) planLocked(evs []model.Event) []admission {
+	plan := make([]admission, len(evs))
+	room := q.capacity - q.sizeLocked()
+	// Products gaining a pending event earlier in this batch, with its
+	// client version.
+	added := make(map[string]uint64)
+	canMerge := func(ev model.Event) bool {
+		v, ok := added[ev.ProductID]
+		if !ok {
+			pp, pending := q.products[ev.ProductID]
+			if !pending {
+				return false
+			}
+			v = pp.version
+		}
+		return q.foldable(store.ClientVersion(ev), v)
+	}
+	full := false
+	for i, ev := range evs {
+		switch {
+		case ev.EffectiveAt != nil:
+			plan[i] = admitSchedule
+			continue
+		case q.coalesce && canMerge(ev):
+			plan[i] = admitMerge
+			continue
+		case q.capacity <= 0 || room > 0:
+			room--
+			plan[i] = admitAppend
+			added[ev.ProductID] = store.ClientVersion(ev)
+			continue
+		}
+		switch q.overload {
+		case OverloadReject:
+			plan[i], full = refuseFull, true
+		case OverloadDropOldest:
+			plan[i] = admitEvict
+		case OverloadDropNewest:
+			plan[i] = refuseDrop
+		case OverloadCoalesce:
+			if canMerge(ev) {
+				plan[i] = admitCoalesce
+			} else {
+				plan[i] = refuseFull
+			}
+		}
+	}
+	if full {
+		// Under reject a batch that does not fit is refused whole.
+		for i := range plan {
+			plan[i] = refuseFull
+		}
+	}
+	return plan
+}
+
+// journalLocked writes evs to the journal in durable mode, all or none.
+// They are durable once commitJournal returns.
+func (q *Queue) journalLocked(evs []model.Event) error {
+	if q.journal == nil {
+		return nil
+	}
+	for i, ev := range evs {
+		if err := q.recordJournal(q.journal.append(ev)); err != nil {
+			// Acknowledge what was written so it is not replayed later.
+			for _, w := range evs[:i] {
+				_ = q.journal.ack(w.Sequence)
+			}
+			return fmt.Errorf("queue: journal append sequence %d: %w", ev.Sequence, err)
+		}
+	}
+	return nil
+}
+
+// commitJournal syncs the journal writes made so far (see journal.commit).
+// Call it without q.mu held.
+func (q *Queue) commitJournal() error {
+	if q.journal == nil {
+		return nil
+	}
+	if err := q.recordJournal(q.journal.commit()); err != nil {
+		obs.Logger.Error("queue_journal_sync_failed", "error", err)
+		return fmt.Errorf("%w: %w", ErrNotDurable, err)
+	}
+	return nil
+}
@@ -0,0 +1,350 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/config"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/model"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/obs"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/store"
+)
+
+func priceEvent(id string, seq uint64, price float64) model.Event {
+	return model.Event{ProductID: id, Price: &price, Sequence: seq}
+}
+
+// pendingEvents returns the live backlog, highest lane first.
+func pendingEvents(q *Queue) []model.Event {
+	var out []model.Event
+	for _, ln := range q.lanes {
+		for _, s := range ln.slots {
+			if !s.absorbed {
+				out = append(out, s.ev)
+			}
+		}
+	}
+	return out
+}
+
+// boundedQueue returns an unstarted queue holding two pending events.
+func boundedQueue(t *testing.T, policy string, onDrop func(model.Event)) *Queue {
+	t.Helper()
+	q := New(1)
+	if err := q.SetCapacity(2, policy, onDrop); err != nil {
+		t.Fatalf("set capacity: %v", err)
+	}
+	for i, id := range []string{"a", "b"} {
+		if err := q.Offer(priceEvent(id, uint64(i+1), 1)); err != nil {
+			t.Fatalf("offer below capacity: %v", err)
+		}
+	}
+	return q
+}
+
+func TestOverloadReject(t *testing.T) {
+	q := boundedQueue(t, OverloadReject, nil)
+	if err := q.Offer(priceEvent("c", 3, 1)); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+	if refused, err := q.OfferBatch([]model.Event{priceEvent("d", 4, 1)}); err != nil || !errors.Is(refused[0], ErrQueueFull) {
+		t.Fatalf("expected batch refused, got %v %v", refused, err)
+	}
+	if st := q.OverloadStats(); st.Rejected != 2 || q.BacklogSize() != 2 {
+		t.Fatalf("unexpected state: %+v backlog=%d", st, q.BacklogSize())
+	}
+}
+
+func TestOverloadDropOldest(t *testing.T) {
+	var dropped []uint64
+	q := boundedQueue(t, OverloadDropOldest, func(ev model.Event) { dropped = append(dropped, ev.Sequence) })
+	if err := q.Offer(priceEvent("c", 3, 1)); err != nil {
+		t.Fatalf("offer: %v", err)
+	}
+	if len(dropped) != 1 || dropped[0] != 1 {
+		t.Fatalf("expected sequence 1 evicted, got %v", dropped)
+	}
+	if b := pendingEvents(q); b[0].Sequence != 2 || b[1].Sequence != 3 {
+		t.Fatalf("unexpected backlog: %+v", b)
+	}
+	if st := q.OverloadStats(); st.DroppedOldest != 1 {
+		t.Fatalf("expected dropped_oldest=1, got %+v", st)
+	}
+}
+
+func TestOverloadDropOldestNeverEvictsIncoming(t *testing.T) {
+	var dropped []uint64
+	q := New(1)
+	if err := q.SetCapacity(2, OverloadDropOldest, func(ev model.Event) { dropped = append(dropped, ev.Sequence) }); err != nil {
+		t.Fatalf("set capacity: %v", err)
+	}
+	for i, id := range []string{"a", "b"} {
+		ev := priceEvent(id, uint64(i+1), 1)
+		ev.Priority = PriorityHigh
+		if err := q.Offer(ev); err != nil {
+			t.Fatalf("offer below capacity: %v", err)
+		}
+	}
+	low := priceEvent("c", 3, 1)
+	low.Priority = PriorityLow
+	if err := q.Offer(low); err != nil {
+		t.Fatalf("offer: %v", err)
+	}
+	if len(dropped) != 1 || dropped[0] != 1 {
+		t.Fatalf("expected sequence 1 evicted, got %v", dropped)
+	}
+	if b := pendingEvents(q); len(b) != 2 || b[0].Sequence != 2 || b[1].Sequence != 3 {
+		t.Fatalf("unexpected backlog: %+v", b)
+	}
+}
+
+func TestOverloadDropNewest(t *testing.T) {
+	q := boundedQueue(t, OverloadDropNewest, nil)
+	if err := q.Offer(priceEvent("c", 3, 1)); !errors.Is(err, ErrEventDropped) {
+		t.Fatalf("expected ErrEventDropped, got %v", err)
+	}
+	if st := q.OverloadStats(); st.DroppedNewest != 1 || q.BacklogSize() != 2 {
+		t.Fatalf("unexpected state: %+v backlog=%d", st, q.BacklogSize())
+	}
+}
+
+func TestOverloadCoalesce(t *testing.T) {
+	q := boundedQueue(t, OverloadCoalesce, nil)
+	stock := int64(7)
+	if err := q.Offer(model.Event{ProductID: "a", Stock: &stock, Sequence: 3}); err != nil {
+		t.Fatalf("offer for pending product: %v", err)
+	}
+	if err := q.Offer(priceEvent("c", 4, 1)); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull for a product with nothing pending, got %v", err)
+	}
+	got := pendingEvents(q)[0]
+	if got.Sequence != 3 || *got.Price != 1 || *got.Stock != 7 || len(got.Merged) != 1 || got.Merged[0] != 1 {
+		t.Fatalf("unexpected merged event: %+v", got)
+	}
+	if st := q.OverloadStats(); st.Coalesced != 1 || st.Rejected != 1 {
+		t.Fatalf("unexpected stats: %+v", st)
+	}
+	// Once "a" leaves the backlog a new event for it needs room again.
+	q.popLaneLocked(laneOf(PriorityNormal))
+	if err := q.Offer(priceEvent("a", 5, 2)); err != nil {
+		t.Fatalf("offer after pop: %v", err)
+	}
+	if b := pendingEvents(q); q.products["a"] == nil || b[1].Sequence != 5 {
+		t.Fatalf("expected a re-appended: %+v", b)
+	}
+}
+
+func TestManagerOverloadCompletesEvents(t *testing.T) {
+	for _, policy := range []string{OverloadDropOldest, OverloadDropNewest, OverloadCoalesce} {
+		t.Run(policy, func(t *testing.T) {
+			obs.InitLogger()
+			cfg := config.Load()
+			cfg.QueueCapacity, cfg.QueueOverloadPolicy = 2, policy
+			cfg.InitialWorkerCount, cfg.WorkerMin, cfg.WorkerMax = 1, 1, 1
+			st := store.New()
+			mgr := NewManager(cfg, New(1), st)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			mgr.Pause()
+			mgr.Start(ctx)
+			defer mgr.Stop()
+
+			var seqs []uint64
+			for i := 0; i < 6; i++ {
+				ev := priceEvent("hot", mgr.NextSequence(), float64(i))
+				seqs = append(seqs, ev.Sequence)
+				_ = mgr.Offer(ev)
+			}
+			mgr.Resume()
+			ctxDrain, cancelDrain := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancelDrain()
+			if !mgr.DrainUntil(ctxDrain) {
+				t.Fatalf("drain timeout")
+			}
+			for _, seq := range seqs {
+				s, ok, _ := mgr.EventStatus(seq)
+				if !ok || s.Status == StatusQueued || s.Status == StatusProcessing {
+					t.Fatalf("sequence %d left in state %+v", seq, s)
+				}
+			}
+			p, _ := st.Get("hot")
+			want := 5.0
+			if policy == OverloadDropNewest {
+				want = 1
+			}
+			if p.Price != want {
+				t.Fatalf("expected price %v, got %v", want, p.Price)
+			}
+		})
+	}
+}
+
+func TestCoalescingQueueMerges(t *testing.T) {
+	q := New(1)
+	q.SetCoalescing(true)
+	stock := int64(4)
+	if refused, err := q.OfferBatch([]model.Event{
+		priceEvent("a", 1, 1),
+		priceEvent("b", 2, 1),
+		{ProductID: "a", Stock: &stock, Sequence: 3},
+	}); err != nil || refused[0] != nil || refused[2] != nil {
+		t.Fatalf("offer batch: %v %v", refused, err)
+	}
+	if err := q.Offer(priceEvent("a", 4, 9)); err != nil {
+		t.Fatalf("offer: %v", err)
+	}
+	if q.BacklogSize() != 2 {
+		t.Fatalf("expected 2 pending events, got %d", q.BacklogSize())
+	}
+	got := pendingEvents(q)[0]
+	if got.Sequence != 4 || *got.Price != 9 || *got.Stock != 4 || len(got.Merged) != 2 || got.Merged[0] != 1 || got.Merged[1] != 3 {
+		t.Fatalf("unexpected merged event: %+v", got)
+	}
+	if merged, ratio := q.CoalesceStats(); merged != 2 || ratio != 0.5 {
+		t.Fatalf("expected 2 merged at ratio 0.5, got %d %v", merged, ratio)
+	}
+}
+
+func TestManagerCoalescingRecordsMergedSequences(t *testing.T) {
+	obs.InitLogger()
+	cfg := config.Load()
+	cfg.QueueCoalesce = true
+	cfg.InitialWorkerCount, cfg.WorkerMin, cfg.WorkerMax = 1, 1, 1
+	st := store.New()
+	mgr := NewManager(cfg, New(1), st)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mgr.Pause()
+	mgr.Start(ctx)
+	defer mgr.Stop()
+
+	first := priceEvent("hot", mgr.NextSequence(), 1)
+	stock := int64(3)
+	second := model.Event{ProductID: "hot", Stock: &stock, Sequence: mgr.NextSequence()}
+	_ = mgr.Offer(first)
+	_ = mgr.Offer(second)
+	mgr.Resume()
+	ctxDrain, cancelDrain := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancelDrain()
+	if !mgr.DrainUntil(ctxDrain) {
+		t.Fatalf("drain timeout")
+	}
+	if p, _ := st.Get("hot"); p.Price != 1 || p.Stock != 3 {
+		t.Fatalf("expected merged fields applied, got %+v", p)
+	}
+	s, _, _ := mgr.EventStatus(first.Sequence)
+	if s.Status != StatusApplied || s.MergedInto != second.Sequence {
+		t.Fatalf("expected first applied via %d, got %+v", second.Sequence, s)
+	}
+	if last, _ := st.LastSequence("hot"); last != second.Sequence {
+		t.Fatalf("expected last sequence %d, got %d", second.Sequence, last)
+	}
+}
+
+func TestCoalescingRespectsClientVersions(t *testing.T) {
+	versioned := func(seq, v uint64, price float64) model.Event {
+		ev := priceEvent("a", seq, price)
+		ev.Version = &v
+		return ev
+	}
+	cases := []struct {
+		order   store.Ordering
+		pending int
+	}{
+		{store.OrderSequence, 1},
+		// Only the two events at version 6 fold.
+		{store.OrderHybrid, 2},
+		{store.OrderVersion, 3},
+	}
+	for _, tc := range cases {
+		t.Run(string(tc.order), func(t *testing.T) {
+			q := New(1)
+			q.SetCoalescing(true)
+			q.SetOrdering(tc.order)
+			for _, ev := range []model.Event{versioned(1, 4, 1), versioned(2, 6, 2), versioned(3, 6, 3)} {
+				if err := q.Offer(ev); err != nil {
+					t.Fatalf("offer: %v", err)
+				}
+			}
+			if q.BacklogSize() != tc.pending {
+				t.Fatalf("expected %d pending events, got %d", tc.pending, q.BacklogSize())
+			}
+			last := pendingEvents(q)[tc.pending-1]
+			if last.Sequence != 3 || *last.Version != 6 || *last.Price != 3 {
+				t.Fatalf("unexpected newest pending event: %+v", last)
+			}
+		})
+	}
+}
+
+func TestPriorityAbsorbRespectsClientVersions(t *testing.T) {
+	q := New(1)
+	q.SetOrdering(store.OrderHybrid)
+	v1, v2 := uint64(1), uint64(2)
+	low := priceEvent("a", 1, 1)
+	low.Priority, low.Version = PriorityLow, &v1
+	high := priceEvent("a", 2, 2)
+	high.Priority, high.Version = PriorityHigh, &v2
+	_ = q.Offer(low)
+	_ = q.Offer(high)
+	// Different versions cannot be folded, so high joins the low lane
+	// behind the pending event instead of absorbing it.
+	if got := q.LaneBacklog(); got[PriorityLow] != 2 || got[PriorityHigh] != 0 {
+		t.Fatalf("unexpected lanes: %v", got)
+	}
+}
+
+func TestManagerRecordsSkipReason(t *testing.T) {
+	obs.InitLogger()
+	cfg := config.Load()
+	cfg.OrderingMode = string(store.OrderVersion)
+	cfg.InitialWorkerCount, cfg.WorkerMin, cfg.WorkerMax = 1, 1, 1
+	st := store.NewOrdered(store.OrderVersion)
+	mgr := NewManager(cfg, New(1), st)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mgr.Start(ctx)
+	defer mgr.Stop()
+
+	v2, v1 := uint64(2), uint64(1)
+	newer := priceEvent("p", mgr.NextSequence(), 2)
+	newer.Version = &v2
+	older := priceEvent("p", mgr.NextSequence(), 1)
+	older.Version = &v1
+	_ = mgr.Offer(newer)
+	_ = mgr.Offer(older)
+	ctxDrain, cancelDrain := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancelDrain()
+	if !mgr.DrainUntil(ctxDrain) {
+		t.Fatalf("drain timeout")
+	}
+	s, _, _ := mgr.EventStatus(older.Sequence)
+	if s.Status != StatusSuperseded || s.Reason != store.ReasonStaleVersion {
+		t.Fatalf("expected superseded with stale_version, got %+v", s)
+	}
+	if p, _ := st.Get("p"); p.Price != 2 {
+		t.Fatalf("expected price 2, got %v", p.Price)
+	}
+	if skips := mgr.SkipStats(); skips[store.ReasonStaleVersion] != 1 || mgr.StaleSkipped() != 0 {
+		t.Fatalf("unexpected skip stats: %v", skips)
+	}
+}
+
+func TestPriorityAbsorbIgnoresVersionsBySequence(t *testing.T) {
+	q := New(1)
+	v1, v2 := uint64(1), uint64(2)
+	first := priceEvent("a", 1, 1)
+	first.Priority, first.Version = PriorityLow, &v1
+	second := priceEvent("a", 2, 2)
+	second.Priority, second.Version = PriorityLow, &v2
+	high := priceEvent("a", 3, 3)
+	high.Priority = PriorityHigh
+	for _, ev := range []model.Event{first, second, high} {
+		_ = q.Offer(ev)
+	}
+	if got := q.LaneBacklog(); got[PriorityHigh] != 1 || got[PriorityLow] != 0 {
+		t.Fatalf("expected the high event to absorb the low ones, got %v", got)
+	}
+}
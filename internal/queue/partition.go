@@ -0,0 +1,115 @@
+package queue
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/model"
+)
+
+// Dispatch modes for Manager.
+const (
+	// DispatchShared lets every worker pull from the queue's output channel.
+	DispatchShared = "shared"
+	// DispatchPartitioned routes each product to a single worker lane so its
+	// events are applied strictly in sequence order.
+	DispatchPartitioned = "partitioned"
+)
+
+// laneBuffer is the per-lane channel capacity.
+const laneBuffer = 16
+
+// partitioner owns the per-worker lanes used in partitioned mode.
+type partitioner struct {
+	// mu is held while routing an event and while resizing, so a resize
+	// never races with an in-flight routing decision.
+	mu    sync.Mutex
+	lanes []chan model.Event
+	wg    sync.WaitGroup
+	count atomic.Int32
+}
+
+// partitionFor maps a product ID onto one of n lanes.
+func partitionFor(productID string, n int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(productID))
+	return int(h.Sum32() % uint32(n)) //nolint:gosec // n is a small positive lane count
+}
+
+// dispatch routes events from the queue to lanes until ctx is done.
+func (m *Manager) dispatch(ctx context.Context) {
+	p := m.parts
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-m.q.Out():
+			p.mu.Lock()
+			lane := p.lanes[partitionFor(ev.ProductID, len(p.lanes))]
+			select {
+			case lane <- ev:
+				p.mu.Unlock()
+			case <-ctx.Done():
+				p.mu.Unlock()
+				return
+			}
+		}
+	}
+}
+
+// resizeLanes rebalances partitions onto n lanes. Existing lanes are closed
+// and drained by their workers before new lanes start, so no product is
+// ever applied by two workers at once and per-product order is preserved.
+func (m *Manager) resizeLanes(n int) {
+	if n < 1 {
+		n = 1
+	}
+	p := m.parts
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, lane := range p.lanes {
+		close(lane)
+	}
+	p.wg.Wait()
+	p.lanes = make([]chan model.Event, n)
+	for i := range p.lanes {
+		lane := make(chan model.Event, laneBuffer)
+		p.lanes[i] = lane
+		p.wg.Add(1)
+		m.running.Add(1)
+		go m.laneWorker(lane)
+	}
+	p.count.Store(int32(n)) //nolint:gosec // bounded by WorkerMax
+}
+
+// laneWorker applies every event routed to its lane, in order, until the
+// lane is closed by a resize or the manager stops. A panic restarts the
+// worker on the same lane, so ordering is kept.
+func (m *Manager) laneWorker(lane <-chan model.Event) {
+	defer m.running.Done()
+	defer m.parts.wg.Done()
+	m.supervise(func(cur *model.Event) {
+		for {
+			running, paused := m.gate.state()
+			select {
+			case <-m.ctx.Done():
+				return
+			case <-running:
+			}
+			select {
+			case <-m.ctx.Done():
+				return
+			case <-paused:
+			case ev, ok := <-lane:
+				if !ok {
+					return
+				}
+				*cur = ev
+				m.process(ev)
+				*cur = model.Event{}
+			}
+		}
+	})
+}
@@ -0,0 +1,112 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/config"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/model"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/obs"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/store"
+)
+
+// orderStore records the apply order per product and flags concurrent
+// applies of the same product.
+type orderStore struct {
+	*store.Store
+	mu         sync.Mutex
+	inFlight   map[string]bool
+	seen       map[string][]uint64
+	concurrent bool
+}
+
+func newOrderStore() *orderStore {
+	return &orderStore{Store: store.New(), inFlight: map[string]bool{}, seen: map[string][]uint64{}}
+}
+
+func (s *orderStore) Upsert(ev model.Event) (store.Result, error) {
+	s.mu.Lock()
+	if s.inFlight[ev.ProductID] {
+		s.concurrent = true
+	}
+	s.inFlight[ev.ProductID] = true
+	s.seen[ev.ProductID] = append(s.seen[ev.ProductID], ev.Sequence)
+	s.mu.Unlock()
+	time.Sleep(50 * time.Microsecond)
+	res, err := s.Store.Upsert(ev)
+	s.mu.Lock()
+	s.inFlight[ev.ProductID] = false
+	s.mu.Unlock()
+	return res, err
+}
+
+func TestPartitionForStable(t *testing.T) {
+	for _, n := range []int{1, 3, 7} {
+		a := partitionFor("sku-1", n)
+		if a < 0 || a >= n || a != partitionFor("sku-1", n) {
+			t.Fatalf("unstable or out-of-range partition %d for n=%d", a, n)
+		}
+	}
+}
+
+func TestPartitionedDispatchOrdersPerProduct(t *testing.T) {
+	obs.InitLogger()
+	cfg := config.Load()
+	cfg.DispatchMode = DispatchPartitioned
+	cfg.InitialWorkerCount = 2
+	cfg.WorkerMin, cfg.WorkerMax = 1, 6
+	cfg.ScaleInterval = time.Hour // resize manually below
+	st := newOrderStore()
+	q := New(8)
+	mgr := NewManager(cfg, q, st)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mgr.Start(ctx)
+	defer mgr.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			if i%2 == 0 {
+				mgr.addWorkers(1)
+			} else {
+				mgr.removeWorkers(1)
+			}
+			time.Sleep(2 * time.Millisecond)
+		}
+	}()
+	for i := 0; i < 600; i++ {
+		ev := model.Event{ProductID: fmt.Sprintf("p-%d", i%5), Sequence: mgr.NextSequence()}
+		_ = mgr.Enqueue(ev)
+	}
+	<-done
+	ctxDrain, cancelDrain := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelDrain()
+	if !mgr.DrainUntil(ctxDrain) {
+		t.Fatalf("drain timeout")
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.concurrent {
+		t.Fatalf("same product applied concurrently")
+	}
+	total := 0
+	for id, seqs := range st.seen {
+		total += len(seqs)
+		for i := 1; i < len(seqs); i++ {
+			if seqs[i] <= seqs[i-1] {
+				t.Fatalf("product %s applied out of order: %v", id, seqs)
+			}
+		}
+	}
+	if total != 600 {
+		t.Fatalf("expected 600 applies, got %d", total)
+	}
+	if wc := mgr.WorkerCount(); wc != 2 {
+		t.Fatalf("expected 2 lanes after balanced resizes, got %d", wc)
+	}
+}
@@ -0,0 +1,310 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/config"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/obs"
+)
+
+// ErrInvalidPool is returned by UpdatePool for inconsistent settings.
+var ErrInvalidPool = errors.New("queue: invalid pool settings")
+
+// ScalerSettings are the scaler parameters that can change at runtime.
+type ScalerSettings struct {
+	Policy             string  `json:"policy"`
+	IntervalMs         int64   `json:"interval_ms"`
+	UpBacklogPerWorker int     `json:"up_backlog_per_worker"`
+	DownIdleTicks      int     `json:"down_idle_ticks"`
+	LatencyTargetMs    int64   `json:"latency_target_ms"`
+	MaxStep            int     `json:"max_step"`
+	DownCooldownMs     int64   `json:"down_cooldown_ms"`
+	EWMAAlpha          float64 `json:"ewma_alpha"`
+	WorkerRate         float64 `json:"worker_rate"`
+}
+
+// PoolSettings describe the worker pool.
+type PoolSettings struct {
+	Min     int            `json:"min"`
+	Max     int            `json:"max"`
+	Current int            `json:"current"`
+	Pinned  bool           `json:"pinned"`
+	Paused  bool           `json:"paused"`
+	Scaler  ScalerSettings `json:"scaler"`
+}
+
+// ScalerUpdate carries optional scaler changes; nil fields are unchanged.
+type ScalerUpdate struct {
+	Policy             *string  `json:"policy,omitempty"`
+	IntervalMs         *int64   `json:"interval_ms,omitempty"`
+	UpBacklogPerWorker *int     `json:"up_backlog_per_worker,omitempty"`
+	DownIdleTicks      *int     `json:"down_idle_ticks,omitempty"`
+	LatencyTargetMs    *int64   `json:"latency_target_ms,omitempty"`
+	MaxStep            *int     `json:"max_step,omitempty"`
+	DownCooldownMs     *int64   `json:"down_cooldown_ms,omitempty"`
+	EWMAAlpha          *float64 `json:"ewma_alpha,omitempty"`
+	WorkerRate         *float64 `json:"worker_rate,omitempty"`
+}
+
+// PoolUpdate carries optional pool changes; nil fields are unchanged.
+// Current sets the worker count; Pin suspends (true) or resumes (false)
+// the scaler so the count stays where it was set.
+type PoolUpdate struct {
+	Min     *int          `json:"min,omitempty"`
+	Max     *int          `json:"max,omitempty"`
+	Current *int          `json:"current,omitempty"`
+	Pin     *bool         `json:"pin,omitempty"`
+	Scaler  *ScalerUpdate `json:"scaler,omitempty"`
+}
+
+// gate holds workers while processing is paused. running is closed while
+// processing runs; paused is closed once a pause is requested.
+type gate struct {
+	mu      sync.Mutex
+	running chan struct{}
+	paused  chan struct{}
+}
+
+func newGate() *gate {
+	g := &gate{running: make(chan struct{}), paused: make(chan struct{})}
+	close(g.running)
+	return g
+}
+
+// state returns the current running and paused channels.
+func (g *gate) state() (running, paused <-chan struct{}) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.running, g.paused
+}
+
+func (g *gate) pause() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	select {
+	case <-g.paused:
+		return false
+	default:
+	}
+	g.running = make(chan struct{})
+	close(g.paused)
+	return true
+}
+
+func (g *gate) resume() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	select {
+	case <-g.running:
+		return false
+	default:
+	}
+	g.paused = make(chan struct{})
+	close(g.running)
+	return true
+}
+
+// Pool returns the current pool settings.
+func (m *Manager) Pool() PoolSettings {
+	m.cfgMu.RLock()
+	cfg, pinned := m.cfg, m.pinned
+	m.cfgMu.RUnlock()
+	_, paused := m.gate.state()
+	isPaused := false
+	select {
+	case <-paused:
+		isPaused = true
+	default:
+	}
+	return PoolSettings{
+		Min:     cfg.WorkerMin,
+		Max:     cfg.WorkerMax,
+		Current: m.WorkerCount(),
+		Pinned:  pinned,
+		Paused:  isPaused,
+		Scaler: ScalerSettings{
+			Policy:             cfg.ScalePolicy,
+			IntervalMs:         cfg.ScaleInterval.Milliseconds(),
+			UpBacklogPerWorker: cfg.ScaleUpBacklogPerWorker,
+			DownIdleTicks:      cfg.ScaleDownIdleTicks,
+			LatencyTargetMs:    cfg.ScaleLatencyTarget.Milliseconds(),
+			MaxStep:            cfg.ScaleMaxStep,
+			DownCooldownMs:     cfg.ScaleDownCooldown.Milliseconds(),
+			EWMAAlpha:          cfg.ScaleEWMAAlpha,
+			WorkerRate:         cfg.ScaleWorkerRate,
+		},
+	}
+}
+
+// UpdatePool validates u against the current settings and applies it as a
+// whole, or not at all. The worker count is moved into the new bounds.
+func (m *Manager) UpdatePool(u PoolUpdate) (PoolSettings, error) {
+	m.cfgMu.Lock()
+	cfg, pinned := m.cfg, m.pinned
+	if u.Min != nil {
+		cfg.WorkerMin = *u.Min
+	}
+	if u.Max != nil {
+		cfg.WorkerMax = *u.Max
+	}
+	if u.Pin != nil {
+		pinned = *u.Pin
+	}
+	if u.Scaler != nil {
+		applyScalerUpdate(&cfg, *u.Scaler)
+	}
+	if err := validatePool(cfg, u.Current); err != nil {
+		m.cfgMu.Unlock()
+		return PoolSettings{}, err
+	}
+	var policy ScalingPolicy
+	if u.Scaler != nil {
+		if err := validateScaler(cfg, *u.Scaler); err != nil {
+			m.cfgMu.Unlock()
+			return PoolSettings{}, err
+		}
+		p, err := NewScalingPolicy(cfg)
+		if err != nil {
+			m.cfgMu.Unlock()
+			return PoolSettings{}, fmt.Errorf("%w: %v", ErrInvalidPool, err)
+		}
+		policy = p
+	}
+	intervalChanged := cfg.ScaleInterval != m.cfg.ScaleInterval
+	m.cfg.WorkerMin, m.cfg.WorkerMax = cfg.WorkerMin, cfg.WorkerMax
+	m.cfg.ScalePolicy = cfg.ScalePolicy
+	m.cfg.ScaleInterval = cfg.ScaleInterval
+	m.cfg.ScaleUpBacklogPerWorker = cfg.ScaleUpBacklogPerWorker
+	m.cfg.ScaleDownIdleTicks = cfg.ScaleDownIdleTicks
+	m.cfg.ScaleLatencyTarget = cfg.ScaleLatencyTarget
+	m.cfg.ScaleMaxStep = cfg.ScaleMaxStep
+	m.cfg.ScaleDownCooldown = cfg.ScaleDownCooldown
+	m.cfg.ScaleEWMAAlpha = cfg.ScaleEWMAAlpha
+	m.cfg.ScaleWorkerRate = cfg.ScaleWorkerRate
+	m.pinned = pinned
+	if policy != nil {
+		m.policy = policy
+	}
+	m.cfgMu.Unlock()
+
+	if intervalChanged {
+		select {
+		case m.scalerKick <- struct{}{}:
+		default:
+		}
+	}
+	target := m.WorkerCount()
+	if u.Current != nil {
+		target = *u.Current
+	}
+	m.setWorkers(clampWorkers(target, cfg.WorkerMin, cfg.WorkerMax))
+	return m.Pool(), nil
+}
+
+func applyScalerUpdate(cfg *config.Config, u ScalerUpdate) {
+	if u.Policy != nil {
+		cfg.ScalePolicy = *u.Policy
+	}
+	if u.IntervalMs != nil {
+		cfg.ScaleInterval = time.Duration(*u.IntervalMs) * time.Millisecond
+	}
+	if u.UpBacklogPerWorker != nil {
+		cfg.ScaleUpBacklogPerWorker = *u.UpBacklogPerWorker
+	}
+	if u.DownIdleTicks != nil {
+		cfg.ScaleDownIdleTicks = *u.DownIdleTicks
+	}
+	if u.LatencyTargetMs != nil {
+		cfg.ScaleLatencyTarget = time.Duration(*u.LatencyTargetMs) * time.Millisecond
+	}
+	if u.MaxStep != nil {
+		cfg.ScaleMaxStep = *u.MaxStep
+	}
+	if u.DownCooldownMs != nil {
+		cfg.ScaleDownCooldown = time.Duration(*u.DownCooldownMs) * time.Millisecond
+	}
+	if u.EWMAAlpha != nil {
+		cfg.ScaleEWMAAlpha = *u.EWMAAlpha
+	}
+	if u.WorkerRate != nil {
+		cfg.ScaleWorkerRate = *u.WorkerRate
+	}
+}
+
+// validatePool checks that the pool bounds are consistent with each other.
+func validatePool(cfg config.Config, current *int) error {
+	switch {
+	case cfg.WorkerMin < 1:
+		return fmt.Errorf("%w: min must be >= 1", ErrInvalidPool)
+	case cfg.WorkerMax < cfg.WorkerMin:
+		return fmt.Errorf("%w: max (%d) must be >= min (%d)", ErrInvalidPool, cfg.WorkerMax, cfg.WorkerMin)
+	case current != nil && (*current < cfg.WorkerMin || *current > cfg.WorkerMax):
+		return fmt.Errorf("%w: current (%d) must be within [min, max] = [%d, %d]", ErrInvalidPool, *current, cfg.WorkerMin, cfg.WorkerMax)
+	}
+	return nil
+}
+
+// validateScaler checks the scaler fields set by u and those the resulting
+// policy uses. Parameters of inactive policies that u leaves alone are not
+// checked, so an out-of-range startup value for one of them does not block
+// unrelated updates.
+func validateScaler(cfg config.Config, u ScalerUpdate) error {
+	var threshold, latency, ewma, proportional bool
+	switch cfg.ScalePolicy {
+	case "", PolicyThreshold:
+		threshold = true
+	case PolicyLatency:
+		latency = true
+	case PolicyEWMA:
+		ewma = true
+	case PolicyProportional:
+		proportional = true
+	}
+	switch {
+	case u.IntervalMs != nil && cfg.ScaleInterval < 10*time.Millisecond:
+		return fmt.Errorf("%w: scaler interval_ms must be >= 10", ErrInvalidPool)
+	case (threshold || u.UpBacklogPerWorker != nil) && cfg.ScaleUpBacklogPerWorker < 1:
+		return fmt.Errorf("%w: scaler up_backlog_per_worker must be >= 1", ErrInvalidPool)
+	case (threshold || u.DownIdleTicks != nil) && cfg.ScaleDownIdleTicks < 1:
+		return fmt.Errorf("%w: scaler down_idle_ticks must be >= 1", ErrInvalidPool)
+	case (latency || proportional || u.LatencyTargetMs != nil) && cfg.ScaleLatencyTarget <= 0:
+		return fmt.Errorf("%w: scaler latency_target_ms must be > 0", ErrInvalidPool)
+	case (proportional || u.MaxStep != nil) && cfg.ScaleMaxStep < 1:
+		return fmt.Errorf("%w: scaler max_step must be >= 1", ErrInvalidPool)
+	case (proportional || u.DownCooldownMs != nil) && cfg.ScaleDownCooldown < 0:
+		return fmt.Errorf("%w: scaler down_cooldown_ms must be >= 0", ErrInvalidPool)
+	case (ewma || u.EWMAAlpha != nil) && (cfg.ScaleEWMAAlpha <= 0 || cfg.ScaleEWMAAlpha > 1):
+		return fmt.Errorf("%w: scaler ewma_alpha must be in (0, 1]", ErrInvalidPool)
+	case (ewma || proportional || u.WorkerRate != nil) && cfg.ScaleWorkerRate <= 0:
+		return fmt.Errorf("%w: scaler worker_rate must be > 0", ErrInvalidPool)
+	}
+	return nil
+}
+
+// Pause stops the broker and holds every worker before its next event.
+// Events being applied finish; intake continues into the backlog.
+func (m *Manager) Pause() {
+	m.q.Pause()
+	if m.gate.pause() {
+		obs.Logger.Warn("processing_paused", "backlog_size", m.q.BacklogSize())
+	}
+}
+
+// Resume restarts processing after Pause and applies any worker count
+// change deferred while paused.
+func (m *Manager) Resume() {
+	if m.gate.resume() {
+		obs.Logger.Info("processing_resumed", "backlog_size", m.q.BacklogSize())
+	}
+	m.q.Resume()
+	m.scaleMu.Lock()
+	n := m.pendingWorkers
+	m.pendingWorkers = 0
+	m.scaleMu.Unlock()
+	if n > 0 {
+		m.setWorkers(n)
+	}
+}
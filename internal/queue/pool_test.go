@@ -0,0 +1,175 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/config"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/model"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/obs"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/store"
+)
+
+func intp(v int) *int { return &v }
+
+func TestUpdatePoolValidation(t *testing.T) {
+	obs.InitLogger()
+	cfg := config.Load()
+	cfg.InitialWorkerCount, cfg.WorkerMin, cfg.WorkerMax = 2, 1, 4
+	mgr := NewManager(cfg, New(8), store.New())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mgr.Start(ctx)
+	defer mgr.Stop()
+
+	bad := []PoolUpdate{
+		{Min: intp(5)},
+		{Min: intp(0)},
+		{Max: intp(3), Current: intp(4)},
+		{Scaler: &ScalerUpdate{MaxStep: intp(0)}},
+	}
+	policy := "unknown"
+	bad = append(bad, PoolUpdate{Scaler: &ScalerUpdate{Policy: &policy}})
+	for _, u := range bad {
+		if _, err := mgr.UpdatePool(u); !errors.Is(err, ErrInvalidPool) {
+			t.Fatalf("expected ErrInvalidPool for %+v, got %v", u, err)
+		}
+	}
+	if p := mgr.Pool(); p.Min != 1 || p.Max != 4 || p.Scaler.MaxStep != cfg.ScaleMaxStep {
+		t.Fatalf("rejected update leaked into settings: %+v", p)
+	}
+
+	p, err := mgr.UpdatePool(PoolUpdate{Min: intp(3), Max: intp(6)})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if p.Min != 3 || p.Max != 6 || p.Current != 3 {
+		t.Fatalf("expected count clamped up to new min: %+v", p)
+	}
+}
+
+func TestUpdatePoolIgnoresInactivePolicySettings(t *testing.T) {
+	obs.InitLogger()
+	cfg := config.Load()
+	cfg.InitialWorkerCount, cfg.WorkerMin, cfg.WorkerMax = 2, 1, 4
+	cfg.ScalePolicy = PolicyThreshold
+	cfg.ScaleEWMAAlpha, cfg.ScaleWorkerRate = 0, 0
+	mgr := NewManager(cfg, New(8), store.New())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mgr.Start(ctx)
+	defer mgr.Stop()
+
+	if _, err := mgr.UpdatePool(PoolUpdate{Min: intp(2), Max: intp(6), Current: intp(3)}); err != nil {
+		t.Fatalf("pool update blocked by inactive scaler settings: %v", err)
+	}
+	if _, err := mgr.UpdatePool(PoolUpdate{Scaler: &ScalerUpdate{MaxStep: intp(4)}}); err != nil {
+		t.Fatalf("scaler update blocked by inactive policy settings: %v", err)
+	}
+	policy := PolicyEWMA
+	if _, err := mgr.UpdatePool(PoolUpdate{Scaler: &ScalerUpdate{Policy: &policy}}); !errors.Is(err, ErrInvalidPool) {
+		t.Fatalf("expected ErrInvalidPool switching to a policy with invalid settings, got %v", err)
+	}
+}
+
+// blockingStore holds every apply until release is closed.
+type blockingStore struct {
+	*store.Store
+	release chan struct{}
+}
+
+func (s blockingStore) Upsert(ev model.Event) (store.Result, error) {
+	<-s.release
+	return s.Store.Upsert(ev)
+}
+
+func TestPinnedPoolIgnoresScaler(t *testing.T) {
+	obs.InitLogger()
+	cfg := config.Load()
+	cfg.InitialWorkerCount, cfg.WorkerMin, cfg.WorkerMax = 1, 1, 8
+	cfg.ScaleInterval = 10 * time.Millisecond
+	cfg.ScaleUpBacklogPerWorker = 1
+	st := blockingStore{Store: store.New(), release: make(chan struct{})}
+	mgr := NewManager(cfg, New(4), st)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mgr.Start(ctx)
+	defer mgr.Stop()
+	defer close(st.release)
+
+	pin := true
+	if _, err := mgr.UpdatePool(PoolUpdate{Current: intp(2), Pin: &pin}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	price := 1.0
+	for i := 0; i < 20; i++ {
+		mgr.Enqueue(model.Event{ProductID: "p", Price: &price, Sequence: mgr.NextSequence()})
+	}
+	time.Sleep(100 * time.Millisecond)
+	if wc := mgr.WorkerCount(); wc != 2 {
+		t.Fatalf("pinned pool resized to %d", wc)
+	}
+
+	pin = false
+	if _, err := mgr.UpdatePool(PoolUpdate{Pin: &pin}); err != nil {
+		t.Fatalf("unpin: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for mgr.WorkerCount() <= 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("scaler did not resume after unpin")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Pin again so the scaler is quiet before the next test starts.
+	pin = true
+	if _, err := mgr.UpdatePool(PoolUpdate{Pin: &pin}); err != nil {
+		t.Fatalf("re-pin: %v", err)
+	}
+}
+
+func TestPauseHoldsProcessing(t *testing.T) {
+	for _, mode := range []string{DispatchShared, DispatchPartitioned} {
+		t.Run(mode, func(t *testing.T) {
+			obs.InitLogger()
+			cfg := config.Load()
+			cfg.DispatchMode = mode
+			cfg.InitialWorkerCount, cfg.WorkerMin, cfg.WorkerMax = 2, 1, 4
+			st := store.New()
+			mgr := NewManager(cfg, New(64), st)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			mgr.Start(ctx)
+			defer mgr.Stop()
+
+			mgr.Pause()
+			if !mgr.Pool().Paused {
+				t.Fatalf("expected paused")
+			}
+			price := 3.0
+			mgr.Enqueue(model.Event{ProductID: "held", Price: &price, Sequence: mgr.NextSequence()})
+			if _, err := mgr.UpdatePool(PoolUpdate{Current: intp(3)}); err != nil {
+				t.Fatalf("update while paused: %v", err)
+			}
+			time.Sleep(50 * time.Millisecond)
+			if _, ok := st.Get("held"); ok {
+				t.Fatalf("event applied while paused")
+			}
+
+			mgr.Resume()
+			ctxDrain, cancelDrain := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancelDrain()
+			if !mgr.DrainUntil(ctxDrain) {
+				t.Fatalf("drain timeout after resume")
+			}
+			if _, ok := st.Get("held"); !ok {
+				t.Fatalf("event not applied after resume")
+			}
+			if wc := mgr.WorkerCount(); wc != 3 {
+				t.Fatalf("expected 3 workers after resume, got %d", wc)
+			}
+		})
+	}
+}
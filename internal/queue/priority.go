@@ -0,0 +1,292 @@
+package queue
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/model"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/store"
+)
+
+// Event priorities. An event without a priority is PriorityNormal.
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+)
+
+// Priorities lists the priority lanes from highest to lowest.
+var Priorities = []string{PriorityHigh, PriorityNormal, PriorityLow}
+
+// DefaultPriorityWeights are the events drained per round from the high,
+// normal and low lanes.
+var DefaultPriorityWeights = [3]int{8, 4, 1}
+
+// ValidPriority reports whether p is empty or names a priority.
+func ValidPriority(p string) bool {
+	switch p {
+	case "", PriorityHigh, PriorityNormal, PriorityLow:
+		return true
+	}
+	return false
+}
+
+// laneOf returns the lane index for priority p; 0 is the highest.
+func laneOf(p string) int {
+	switch p {
+	case PriorityHigh:
+		return 0
+	case PriorityLow:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// ParsePriorityWeights parses "high,normal,low" drain weights such as
+// "8,4,1". Every weight must be at least 1 so no lane can starve.
+func ParsePriorityWeights(s string) ([3]int, error) {
+	var w [3]int
+	parts := strings.Split(s, ",")
+	if len(parts) != len(w) {
+		return w, fmt.Errorf("queue: priority weights %q: want 3 comma-separated values", s)
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || n < 1 {
+			return w, fmt.Errorf("queue: priority weight %q must be an integer >= 1", p)
+		}
+		w[i] = n
+	}
+	return w, nil
+}
+
+// slot is one backlog entry. An absorbed slot was folded into a newer
+// event in a higher lane and is skipped when the lane drains.
+type slot struct {
+	ev       model.Event
+	absorbed bool
+}
+
+// lane is the FIFO backlog of one priority.
+type lane struct {
+	slots []slot
+	head  uint64 // absolute position of slots[0]
+	live  int    // slots not absorbed
+}
+
+// productPending locates the pending events of one product. All of them
+// sit in one lane, oldest first, so the product's events drain in order
+// even when they were sent with different priorities.
+type productPending struct {
+	lane int
+	pos  []uint64
+	// version is the client version of the newest pending event; mixed is
+	// set once pending events that may not be folded together (see
+	// foldable) were queued.
+	version uint64
+	mixed   bool
+}
+
+// SetPriorityWeights sets how many events the broker drains from the high,
+// normal and low lanes per round. Call it before Start.
+func (q *Queue) SetPriorityWeights(w [3]int) error {
+	for _, n := range w {
+		if n < 1 {
+			return fmt.Errorf("queue: priority weights must be >= 1, got %v", w)
+		}
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.weights, q.turn, q.credit = w, 0, w[0]
+	return nil
+}
+
+// LaneBacklog returns the pending events per priority.
+func (q *Queue) LaneBacklog() map[string]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	out := make(map[string]int, len(Priorities))
+	for i, p := range Priorities {
+		out[p] = q.lanes[i].live
+	}
+	return out
+}
+
+// sizeLocked returns the pending events across lanes.
+func (q *Queue) sizeLocked() int {
+	n := 0
+	for i := range q.lanes {
+		n += q.lanes[i].live
+	}
+	return n
+}
+
+// pushLocked appends ev to its lane. If the product has events pending in
+// a higher lane, ev joins them there; if they are in a lower lane they are
+// absorbed into ev, which keeps every product's events in one FIFO lane.
+// ev is stamped with its enqueue time for the queue-wait span. It returns
+// the lane ev landed in.
+func (q *Queue) pushLocked(ev model.Event) int {
+	if ev.EnqueuedAt.IsZero() {
+		ev.EnqueuedAt = time.Now()
+	}
+	l := laneOf(ev.Priority)
+	v := store.ClientVersion(ev)
+	pp := q.products[ev.ProductID]
+	if pp != nil && (pp.lane < l || pp.lane > l && (pp.mixed || !q.foldable(v, pp.version))) {
+		// Join the pending lane; events that cannot be folded are not
+		// absorbed, which costs ev its higher priority.
+		l = pp.lane
+	}
+	if pp != nil && pp.lane > l {
+		ev = q.absorbLocked(pp, ev)
+	}
+	if pp == nil {
+		pp = &productPending{}
+		q.products[ev.ProductID] = pp
+	}
+	if len(pp.pos) > 0 && !q.foldable(v, pp.version) {
+		pp.mixed = true
+	}
+	pp.version = v
+	ln := &q.lanes[l]
+	pp.lane = l
+	pp.pos = append(pp.pos, ln.head+uint64(len(ln.slots))) //nolint:gosec // length is non-negative
+	ln.slots = append(ln.slots, slot{ev: ev})
+	ln.live++
+	return l
+}
+
+// absorbLocked folds the product's pending events into ev and marks
+// their slots absorbed.
+func (q *Queue) absorbLocked(pp *productPending, ev model.Event) model.Event {
+	ln := &q.lanes[pp.lane]
+	for _, pos := range pp.pos {
+		s := &ln.slots[pos-ln.head]
+		ev = fold(s.ev, ev)
+		s.ev, s.absorbed = model.Event{}, true
+		ln.live--
+	}
+	pp.pos = pp.pos[:0]
+	pp.mixed = false
+	return ev
+}
+
+// fold merges two pending events of one product into one: fields of the
+// newer event (by sequence) win, the newer sequence and client version are
+// kept and the older sequence is recorded in Merged. The priority of b is
+// kept. Callers check foldable first.
+func fold(a, b model.Event) model.Event {
+	older, newer := a, b
+	if newer.Sequence < older.Sequence {
+		older, newer = newer, older
+	}
+	out := b
+	out.Sequence = newer.Sequence
+	out.Version, out.SourceTimestamp = newer.Version, newer.SourceTimestamp
+	out.Price, out.Stock = older.Price, older.Stock
+	if newer.Price != nil {
+		out.Price = newer.Price
+	}
+	if newer.Stock != nil {
+		out.Stock = newer.Stock
+	}
+	out.Merged = make([]uint64, 0, len(a.Merged)+len(b.Merged)+1)
+	out.Merged = append(out.Merged, a.Merged...)
+	out.Merged = append(out.Merged, b.Merged...)
+	out.Merged = append(out.Merged, older.Sequence)
+	return out
+}
+
+// popLaneLocked removes and returns the oldest live event of lane l.
+func (q *Queue) popLaneLocked(l int) (model.Event, bool) {
+	ln := &q.lanes[l]
+	for len(ln.slots) > 0 {
+		s := ln.slots[0]
+		ln.slots[0] = slot{}
+		ln.slots = ln.slots[1:]
+		pos := ln.head
+		ln.head++
+		if s.absorbed {
+			continue
+		}
+		ln.live--
+		if pp := q.products[s.ev.ProductID]; pp != nil && len(pp.pos) > 0 && pp.pos[0] == pos {
+			pp.pos = pp.pos[1:]
+			if len(pp.pos) == 0 {
+				delete(q.products, s.ev.ProductID)
+			}
+		}
+		return s.ev, true
+	}
+	return model.Event{}, false
+}
+
+// popOldestLocked evicts the oldest event of the lowest non-empty lane,
+// other than the event just pushed to lane pushed: that event is the
+// newest of its lane, so the lane is skipped when it is the only one.
+func (q *Queue) popOldestLocked(pushed int) (model.Event, bool) {
+	for l := len(q.lanes) - 1; l >= 0; l-- {
+		if l == pushed && q.lanes[l].live <= 1 {
+			continue
+		}
+		if ev, ok := q.popLaneLocked(l); ok {
+			return ev, true
+		}
+	}
+	return model.Event{}, false
+}
+
+// foldable reports whether an event with client version v may be folded
+// into pending events whose newest has client version pending. Ordering by
+// sequence, it always may. Under hybrid ordering only at the same version:
+// an older pending version may already be stale in the store, and folding
+// would carry its fields past the check. Under version ordering never, as
+// the store skips a repeated version.
+func (q *Queue) foldable(v, pending uint64) bool {
+	switch q.order {
+	case store.OrderVersion:
+		return false
+	case store.OrderHybrid:
+		return v == pending
+	default:
+		return true
+	}
+}
+
+// mergeLocked folds ev into the newest pending event of its product (see
+// fold). If ev has a higher priority than the pending events, they are
+// absorbed into ev instead.
+func (q *Queue) mergeLocked(ev model.Event) {
+	pp := q.products[ev.ProductID]
+	if laneOf(ev.Priority) < pp.lane {
+		q.pushLocked(ev)
+		return
+	}
+	ln := &q.lanes[pp.lane]
+	p := &ln.slots[pp.pos[len(pp.pos)-1]-ln.head].ev
+	*p = fold(ev, *p)
+}
+
+// drainLocked moves pending events to the output buffer by weighted round
+// robin over the lanes: lane l gets up to weights[l] consecutive events
+// per turn, highest lane first. The turn survives across calls, so a lower
+// lane progresses even when the buffer frees one slot at a time.
+func (q *Queue) drainLocked() {
+	for len(q.out) < cap(q.out) && q.sizeLocked() > 0 {
+		if q.credit <= 0 {
+			q.turn = (q.turn + 1) % len(q.lanes)
+			q.credit = q.weights[q.turn]
+		}
+		ev, ok := q.popLaneLocked(q.turn)
+		if !ok {
+			q.credit = 0
+			continue
+		}
+		q.out <- ev
+		q.credit--
+	}
+}
@@ -0,0 +1,83 @@
+package queue
+
+import (
+	"testing"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/model"
+)
+
+func prioEvent(id string, seq uint64, price float64, prio string) model.Event {
+	ev := priceEvent(id, seq, price)
+	ev.Priority = prio
+	return ev
+}
+
+func TestParsePriorityWeights(t *testing.T) {
+	if w, err := ParsePriorityWeights(" 5, 2 ,1"); err != nil || w != [3]int{5, 2, 1} {
+		t.Fatalf("unexpected weights %v %v", w, err)
+	}
+	for _, s := range []string{"", "1,2", "1,2,3,4", "4,0,1", "4,x,1"} {
+		if _, err := ParsePriorityWeights(s); err == nil {
+			t.Fatalf("expected error for %q", s)
+		}
+	}
+}
+
+func TestWeightedDrainDoesNotStarve(t *testing.T) {
+	q := New(1)
+	if err := q.SetPriorityWeights([3]int{2, 1, 1}); err != nil {
+		t.Fatalf("set weights: %v", err)
+	}
+	var seq uint64
+	for _, prio := range []string{PriorityLow, PriorityNormal, PriorityHigh} {
+		for i := 0; i < 4; i++ {
+			seq++
+			q.Enqueue(prioEvent(prio+string(rune('a'+i)), seq, 1, prio))
+		}
+	}
+	if lb := q.LaneBacklog(); lb[PriorityHigh] != 4 || lb[PriorityNormal] != 4 || lb[PriorityLow] != 4 {
+		t.Fatalf("unexpected lane backlog: %v", lb)
+	}
+	// Drain one event at a time, as the broker does when a worker frees
+	// the single output slot.
+	var got []string
+	for q.BacklogSize() > 0 {
+		q.flushOnce()
+		got = append(got, (<-q.out).Priority)
+	}
+	want := []string{
+		PriorityHigh, PriorityHigh, PriorityNormal, PriorityLow,
+		PriorityHigh, PriorityHigh, PriorityNormal, PriorityLow,
+		PriorityNormal, PriorityLow, PriorityNormal, PriorityLow,
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("drain order %v, want %v", got, want)
+		}
+	}
+}
+
+func TestPriorityKeepsProductOrder(t *testing.T) {
+	q := New(8)
+	stock := int64(0)
+	q.Enqueue(prioEvent("a", 1, 1, PriorityLow))
+	q.Enqueue(prioEvent("b", 2, 1, PriorityLow))
+	q.Enqueue(model.Event{ProductID: "a", Stock: &stock, Sequence: 3, Priority: PriorityHigh})
+	// A later normal event for "a" joins its pending event in the high lane.
+	q.Enqueue(prioEvent("a", 4, 2, PriorityNormal))
+
+	if lb := q.LaneBacklog(); lb[PriorityHigh] != 2 || lb[PriorityLow] != 1 {
+		t.Fatalf("unexpected lane backlog: %v", lb)
+	}
+	q.flushOnce()
+	first, second, third := <-q.out, <-q.out, <-q.out
+	if first.Sequence != 3 || *first.Price != 1 || *first.Stock != 0 || len(first.Merged) != 1 || first.Merged[0] != 1 {
+		t.Fatalf("expected sequence 1 absorbed into 3, got %+v", first)
+	}
+	if second.Sequence != 4 || third.ProductID != "b" {
+		t.Fatalf("unexpected drain order: %+v %+v", second, third)
+	}
+	if len(q.products) != 0 {
+		t.Fatalf("expected product index empty, got %v", q.products)
+	}
+}
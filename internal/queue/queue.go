@@ -1,25 +1,63 @@
 package queue
 
 import (
+	"container/heap"
 	"context"
+	"errors"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/fairyhunter13/product-update-service-simulator/internal/model"
 	"github.com/fairyhunter13/product-update-service-simulator/internal/obs"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/store"
 )
 
 // Queue is a simple buffered event queue with a background broker.
 type Queue struct {
 	mu           sync.Mutex
-	backlog      []model.Event
 	notify       chan struct{}
 	out          chan model.Event
 	shuttingDown atomic.Bool
+	paused       atomic.Bool
 
 	enqueued  atomic.Uint64
 	processed atomic.Uint64
+
+	// capacity bounds the backlog when > 0; overload selects what happens
+	// at capacity. The counters below are guarded by mu.
+	capacity      int
+	overload      string
+	onDrop        func(model.Event)
+	rejected      uint64
+	droppedOldest uint64
+	droppedNewest uint64
+	coalesced     uint64
+	// coalesce merges every event into its product's pending event; order
+	// decides which of two merged events is newer.
+	coalesce bool
+	merged   uint64
+	order    store.Ordering
+	// lanes hold the backlog per priority, drained by weighted round robin
+	// (weights, turn, credit); products indexes each product's pending
+	// events.
+	lanes    [3]lane
+	products map[string]*productPending
+	weights  [3]int
+	turn     int
+	credit   int
+	// delayed holds events until their effective time (see SetRelease).
+	delayed   delayHeap
+	clock     Clock
+	seq       *Sequencer
+	onRelease func(orig uint64, ev model.Event)
+	released  uint64
+	cancelled uint64
+
+	// journal is non-nil in durable mode. journalFailure is the error of
+	// the latest journal write or sync, or nil when it succeeded.
+	journal        *journal
+	journalFailure atomic.Pointer[error]
 }
 
 // New creates a Queue with a buffered output channel.
@@ -28,11 +66,40 @@ func New(outBuffer int) *Queue {
 		outBuffer = 64
 	}
 	return &Queue{
-		notify: make(chan struct{}, 1),
-		out:    make(chan model.Event, outBuffer),
+		notify:   make(chan struct{}, 1),
+		out:      make(chan model.Event, outBuffer),
+		overload: OverloadReject,
+		products: make(map[string]*productPending),
+		weights:  DefaultPriorityWeights,
+		credit:   DefaultPriorityWeights[0],
+		clock:    systemClock{},
 	}
 }
 
+// NewDurable creates a Queue whose events are persisted to segment files
+// before Enqueue returns. Events left unacknowledged by a previous run are
+// replayed into the backlog.
+func NewDurable(outBuffer int, opts JournalOptions) (*Queue, error) {
+	j, replay, err := openJournal(opts)
+	if err != nil {
+		return nil, err
+	}
+	q := New(outBuffer)
+	q.journal = j
+	for _, ev := range replay {
+		if ev.EffectiveAt != nil {
+			heap.Push(&q.delayed, ev)
+			continue
+		}
+		q.pushLocked(ev)
+		q.enqueued.Add(1)
+	}
+	if len(replay) > 0 {
+		obs.Logger.Info("queue_journal_replayed", "events", len(replay), "scheduled", len(q.delayed), "max_sequence", j.maxSeq)
+	}
+	return q, nil
+}
+
 // Start runs the broker loop.
 func (q *Queue) Start(ctx context.Context, highWatermark int) {
 	go q.broker(ctx, highWatermark)
@@ -54,35 +121,79 @@ func (q *Queue) broker(ctx context.Context, highWatermark int) {
 			return
 		case <-q.notify:
 		case <-ticker.C:
+			if q.journal != nil {
+				if err := q.recordJournal(q.journal.flush()); err != nil {
+					obs.Logger.Error("queue_journal_sync_failed", "error", err)
+				}
+			}
 		}
 	}
 }
 
-// flushOnce drains backlog into the output buffer.
-func (q *Queue) flushOnce() {
-	q.mu.Lock()
-	defer q.mu.Unlock()
-	for len(q.backlog) > 0 && len(q.out) < cap(q.out) {
-		item := q.backlog[0]
-		q.backlog = q.backlog[1:]
-		q.out <- item
+// recordJournal stores err as the journal's health and returns it.
+func (q *Queue) recordJournal(err error) error {
+	if err != nil {
+		q.journalFailure.Store(&err)
+	} else {
+		q.journalFailure.Store(nil)
 	}
+	return err
 }
 
-// Enqueue appends an event into the backlog and notifies the broker.
-func (q *Queue) Enqueue(ev model.Event) bool {
-	if q.shuttingDown.Load() {
-		return false
+// Health returns the error of the most recent journal write or sync, or
+// nil when it succeeded or the queue is not durable.
+func (q *Queue) Health() error {
+	if p := q.journalFailure.Load(); p != nil {
+		return *p
 	}
-	q.enqueued.Add(1)
+	return nil
+}
+
+// flushOnce releases due scheduled events and drains backlog into the
+// output buffer.
+func (q *Queue) flushOnce() {
 	q.mu.Lock()
-	q.backlog = append(q.backlog, ev)
+	orig, released := q.releaseDueLocked()
+	if !q.paused.Load() {
+		q.drainLocked()
+	}
+	onRelease := q.onRelease
 	q.mu.Unlock()
+	if onRelease != nil {
+		for i, ev := range released {
+			onRelease(orig[i], ev)
+		}
+	}
+}
+
+// Pause stops the broker from handing backlog to workers; intake continues.
+func (q *Queue) Pause() { q.paused.Store(true) }
+
+// Resume restarts the broker after Pause.
+func (q *Queue) Resume() {
+	q.paused.Store(false)
 	select {
 	case q.notify <- struct{}{}:
 	default:
 	}
-	return true
+}
+
+// Paused reports whether the broker is paused.
+func (q *Queue) Paused() bool { return q.paused.Load() }
+
+// Enqueue appends an event into the backlog and notifies the broker. It
+// reports whether the event was admitted; Offer reports why it was not.
+func (q *Queue) Enqueue(ev model.Event) bool {
+	err := q.Offer(ev)
+	return err == nil || errors.Is(err, ErrNotDurable)
+}
+
+// EnqueueBatch appends events as one contiguous run, or none of them when
+// intake is closed or the journal rejects a write. Events refused by the
+// overload policy are only reported by OfferBatch.
+func (q *Queue) EnqueueBatch(evs []model.Event) bool {
+	_, err := q.OfferBatch(evs)
+	return err == nil || errors.Is(err, ErrNotDurable)
 }
 
 // Out exposes the output channel of events.
@@ -92,19 +203,44 @@ func (q *Queue) Out() <-chan model.Event { return q.out }
 func (q *Queue) BacklogSize() int {
 	q.mu.Lock()
 	defer q.mu.Unlock()
-	return len(q.backlog)
+	return q.sizeLocked()
 }
 
 // QueueDepth returns backlog plus buffered output items.
 func (q *Queue) QueueDepth() int { // backlog + out buffered items
 	q.mu.Lock()
-	bl := len(q.backlog)
+	bl := q.sizeLocked()
 	q.mu.Unlock()
 	return bl + len(q.out)
 }
 
-// MarkProcessed increases the processed counter.
-func (q *Queue) MarkProcessed() { q.processed.Add(1) }
+// MarkProcessed acknowledges the event with the given sequence and
+// increases the processed counter. In durable mode the acknowledgement lets
+// fully processed segments be garbage-collected.
+func (q *Queue) MarkProcessed(seq uint64) {
+	q.processed.Add(1)
+	q.ackJournal(seq)
+}
+
+// RecoveredMaxSequence returns the highest sequence found in the journal,
+// or 0 when the queue is not durable.
+func (q *Queue) RecoveredMaxSequence() uint64 {
+	if q.journal == nil {
+		return 0
+	}
+	q.journal.mu.Lock()
+	defer q.journal.mu.Unlock()
+	return q.journal.maxSeq
+}
+
+// Close releases journal files. Unacknowledged events stay on disk and are
+// replayed by the next NewDurable.
+func (q *Queue) Close() error {
+	if q.journal == nil {
+		return nil
+	}
+	return q.journal.close()
+}
 
 // Metrics returns counters and sizes for observability.
 func (q *Queue) Metrics() (enq, proc uint64, backlog, depth int) {
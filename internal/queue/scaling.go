@@ -0,0 +1,269 @@
+package queue
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/config"
+)
+
+// Scaling policy names accepted by SCALE_POLICY.
+const (
+	PolicyThreshold    = "threshold"
+	PolicyLatency      = "latency"
+	PolicyEWMA         = "ewma"
+	PolicyProportional = "proportional"
+)
+
+// Sample is what the scaler observes on each tick.
+type Sample struct {
+	// Now is the sample time; policies use it instead of the wall clock so
+	// they can be driven by a fake clock in tests.
+	Now time.Time
+	// Interval is the time since the previous sample.
+	Interval time.Duration
+	Backlog  int
+	Workers  int
+	// Arrived and Processed count events enqueued and processed during
+	// Interval.
+	Arrived   uint64
+	Processed uint64
+	// Latency is the mean time a worker spent on one event during Interval,
+	// or 0 when nothing was processed.
+	Latency  time.Duration
+	Min, Max int
+}
+
+// Throughput returns the processing rate during the sample in events/sec.
+func (s Sample) Throughput() float64 {
+	if s.Interval <= 0 {
+		return 0
+	}
+	return float64(s.Processed) / s.Interval.Seconds()
+}
+
+// ArrivalRate returns the intake rate during the sample in events/sec.
+func (s Sample) ArrivalRate() float64 {
+	if s.Interval <= 0 {
+		return 0
+	}
+	return float64(s.Arrived) / s.Interval.Seconds()
+}
+
+// Decision is a policy's desired worker count and why.
+type Decision struct {
+	Target int
+	Reason string
+}
+
+// ScalingPolicy decides the worker count from one tick's observations. The
+// manager clamps the target to [Min, Max]. Policies may keep state between
+// calls; Decide is only called from the scaler goroutine.
+type ScalingPolicy interface {
+	Decide(s Sample) Decision
+}
+
+// NewScalingPolicy builds the policy named by cfg.ScalePolicy.
+func NewScalingPolicy(cfg config.Config) (ScalingPolicy, error) {
+	switch cfg.ScalePolicy {
+	case "", PolicyThreshold:
+		return &ThresholdPolicy{UpBacklogPerWorker: cfg.ScaleUpBacklogPerWorker, DownIdleTicks: cfg.ScaleDownIdleTicks}, nil
+	case PolicyLatency:
+		return &LatencyPolicy{Target: cfg.ScaleLatencyTarget}, nil
+	case PolicyEWMA:
+		return &EWMAPolicy{Alpha: cfg.ScaleEWMAAlpha, WorkerRate: cfg.ScaleWorkerRate}, nil
+	case PolicyProportional:
+		return &ProportionalPolicy{
+			DrainTarget:  cfg.ScaleLatencyTarget,
+			MaxStep:      cfg.ScaleMaxStep,
+			DownCooldown: cfg.ScaleDownCooldown,
+			WorkerRate:   cfg.ScaleWorkerRate,
+		}, nil
+	}
+	return nil, fmt.Errorf("queue: unknown scale policy %q", cfg.ScalePolicy)
+}
+
+// hold keeps the current worker count.
+func hold(s Sample, reason string) Decision { return Decision{Target: s.Workers, Reason: reason} }
+
+// ThresholdPolicy adds one worker when the backlog exceeds
+// UpBacklogPerWorker per worker, and removes one after DownIdleTicks
+// consecutive ticks with an empty backlog.
+type ThresholdPolicy struct {
+	UpBacklogPerWorker int
+	DownIdleTicks      int
+
+	idleTicks int
+}
+
+// Decide implements ScalingPolicy.
+func (p *ThresholdPolicy) Decide(s Sample) Decision {
+	if s.Backlog > s.Workers*p.UpBacklogPerWorker && s.Workers < s.Max {
+		p.idleTicks = 0
+		return Decision{Target: s.Workers + 1, Reason: "backlog_above_threshold"}
+	}
+	if s.Backlog != 0 {
+		p.idleTicks = 0
+		return hold(s, "steady")
+	}
+	p.idleTicks++
+	if p.idleTicks >= p.DownIdleTicks && s.Workers > s.Min {
+		p.idleTicks = 0
+		return Decision{Target: s.Workers - 1, Reason: "idle"}
+	}
+	return hold(s, "idle_waiting")
+}
+
+// LatencyPolicy sizes the pool so the backlog drains within Target. The
+// expected wait is backlog / throughput; when it exceeds Target the pool
+// grows in proportion, and when it stays under half of Target with
+// workers idle the pool shrinks by one.
+type LatencyPolicy struct {
+	Target time.Duration
+}
+
+// Decide implements ScalingPolicy.
+func (p *LatencyPolicy) Decide(s Sample) Decision {
+	if s.Backlog == 0 {
+		if s.Workers > s.Min {
+			return Decision{Target: s.Workers - 1, Reason: "no_backlog"}
+		}
+		return hold(s, "no_backlog")
+	}
+	rate := s.Throughput()
+	if rate == 0 {
+		// Backlog but nothing finished this tick: workers are saturated or
+		// just started; add one and measure again.
+		return Decision{Target: s.Workers + 1, Reason: "backlog_without_throughput"}
+	}
+	wait := time.Duration(float64(s.Backlog) / rate * float64(time.Second))
+	switch {
+	case wait > p.Target:
+		need := int(math.Ceil(float64(s.Workers) * float64(wait) / float64(p.Target)))
+		return Decision{Target: need, Reason: fmt.Sprintf("expected_wait %s > target %s", wait.Round(time.Millisecond), p.Target)}
+	case wait < p.Target/2 && s.Workers > s.Min:
+		return Decision{Target: s.Workers - 1, Reason: fmt.Sprintf("expected_wait %s < target/2", wait.Round(time.Millisecond))}
+	}
+	return hold(s, "within_target")
+}
+
+// EWMAPolicy tracks an exponentially weighted moving average of the arrival
+// rate and provisions enough workers to match it, plus enough to drain the
+// current backlog within one second. Per-worker capacity is measured from
+// busy ticks, falling back to WorkerRate events/sec.
+type EWMAPolicy struct {
+	// Alpha weights the newest observation, in (0, 1].
+	Alpha float64
+	// WorkerRate is the assumed events/sec one worker handles before any
+	// throughput has been measured.
+	WorkerRate float64
+
+	rate       float64
+	perWorker  float64
+	lastSample time.Time
+}
+
+// Decide implements ScalingPolicy.
+func (p *EWMAPolicy) Decide(s Sample) Decision {
+	interval := s.Interval
+	if !p.lastSample.IsZero() {
+		interval = s.Now.Sub(p.lastSample)
+	}
+	p.lastSample = s.Now
+	if interval <= 0 {
+		return hold(s, "no_interval")
+	}
+	arrival := float64(s.Arrived) / interval.Seconds()
+	if p.rate == 0 {
+		p.rate = arrival
+	} else {
+		p.rate = p.Alpha*arrival + (1-p.Alpha)*p.rate
+	}
+	// Only a tick with a backlog shows what the workers can do.
+	if s.Backlog > 0 && s.Processed > 0 && s.Workers > 0 {
+		p.perWorker = float64(s.Processed) / interval.Seconds() / float64(s.Workers)
+	}
+	capacity := p.perWorker
+	if capacity <= 0 {
+		capacity = p.WorkerRate
+	}
+	if capacity <= 0 {
+		return hold(s, "unknown_capacity")
+	}
+	need := int(math.Ceil((p.rate + float64(s.Backlog)) / capacity))
+	return Decision{Target: need, Reason: fmt.Sprintf("ewma_rate %.1f/s backlog %d capacity %.1f/s/worker", p.rate, s.Backlog, capacity)}
+}
+
+// ProportionalPolicy computes the workers needed to absorb the arrival rate
+// and drain the backlog within DrainTarget, from measured per-worker
+// throughput, and moves there in one step of at most MaxStep workers.
+// Scale-down waits DownCooldown after the last change so a burst that has
+// just been absorbed does not flap the pool.
+type ProportionalPolicy struct {
+	DrainTarget  time.Duration
+	MaxStep      int
+	DownCooldown time.Duration
+	// WorkerRate is the assumed events/sec per worker until throughput has
+	// been measured on a busy tick.
+	WorkerRate float64
+
+	perWorker  float64
+	lastChange time.Time
+}
+
+// Decide implements ScalingPolicy.
+func (p *ProportionalPolicy) Decide(s Sample) Decision {
+	if s.Backlog > 0 && s.Processed > 0 && s.Workers > 0 {
+		p.perWorker = s.Throughput() / float64(s.Workers)
+	}
+	capacity := p.perWorker
+	if capacity <= 0 {
+		capacity = p.WorkerRate
+	}
+	drain := p.DrainTarget.Seconds()
+	if capacity <= 0 || drain <= 0 {
+		return hold(s, "unknown_capacity")
+	}
+	demand := s.ArrivalRate() + float64(s.Backlog)/drain
+	need := int(math.Ceil(demand / capacity))
+	reason := fmt.Sprintf("need %d for %.1f/s at %.1f/s/worker", need, demand, capacity)
+	step := p.MaxStep
+	if step < 1 {
+		step = 1
+	}
+	switch {
+	case need > s.Workers:
+		if s.Workers >= s.Max {
+			return hold(s, reason+"; at max")
+		}
+		target := min(need, s.Workers+step, s.Max)
+		p.lastChange = s.Now
+		if target < need {
+			reason += fmt.Sprintf("; step capped at +%d", step)
+		}
+		return Decision{Target: target, Reason: reason}
+	case need < s.Workers:
+		if s.Workers <= s.Min {
+			return hold(s, reason+"; at min")
+		}
+		if wait := p.DownCooldown - s.Now.Sub(p.lastChange); !p.lastChange.IsZero() && wait > 0 {
+			return hold(s, reason+fmt.Sprintf("; cooldown %s", wait.Round(time.Millisecond)))
+		}
+		target := max(need, s.Workers-step, s.Min)
+		p.lastChange = s.Now
+		return Decision{Target: target, Reason: reason}
+	}
+	return hold(s, reason)
+}
+
+// clampWorkers bounds n to [lo, hi].
+func clampWorkers(n, lo, hi int) int {
+	if n < lo {
+		n = lo
+	}
+	if n > hi {
+		n = hi
+	}
+	return n
+}
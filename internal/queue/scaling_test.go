@@ -0,0 +1,137 @@
+package queue
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/config"
+)
+
+// fakeClock hands out sample times that advance by a fixed step.
+type fakeClock struct {
+	t    time.Time
+	step time.Duration
+}
+
+func (c *fakeClock) sample(s Sample) Sample {
+	c.t = c.t.Add(c.step)
+	s.Now = c.t
+	s.Interval = c.step
+	if s.Min == 0 && s.Max == 0 {
+		s.Min, s.Max = 1, 50
+	}
+	return s
+}
+
+func TestThresholdPolicyMatchesLegacyRule(t *testing.T) {
+	clk := &fakeClock{step: 500 * time.Millisecond}
+	p := &ThresholdPolicy{UpBacklogPerWorker: 10, DownIdleTicks: 2}
+	if d := p.Decide(clk.sample(Sample{Backlog: 31, Workers: 3})); d.Target != 4 {
+		t.Fatalf("expected scale up to 4, got %+v", d)
+	}
+	if d := p.Decide(clk.sample(Sample{Backlog: 30, Workers: 3})); d.Target != 3 {
+		t.Fatalf("expected hold at threshold, got %+v", d)
+	}
+	if d := p.Decide(clk.sample(Sample{Backlog: 0, Workers: 3})); d.Target != 3 {
+		t.Fatalf("expected hold on first idle tick, got %+v", d)
+	}
+	if d := p.Decide(clk.sample(Sample{Backlog: 0, Workers: 3})); d.Target != 2 {
+		t.Fatalf("expected scale down after 2 idle ticks, got %+v", d)
+	}
+	if d := p.Decide(clk.sample(Sample{Backlog: 500, Workers: 50})); d.Target != 50 {
+		t.Fatalf("expected no scale up at max, got %+v", d)
+	}
+}
+
+func TestLatencyPolicy(t *testing.T) {
+	clk := &fakeClock{step: time.Second}
+	p := &LatencyPolicy{Target: time.Second}
+	// 4 workers drain 100/s; a 400 backlog waits 4s -> 16 workers.
+	if d := p.Decide(clk.sample(Sample{Backlog: 400, Workers: 4, Processed: 100})); d.Target != 16 {
+		t.Fatalf("expected 16 workers, got %+v", d)
+	}
+	if d := p.Decide(clk.sample(Sample{Backlog: 80, Workers: 4, Processed: 100})); d.Target != 4 {
+		t.Fatalf("expected hold within target, got %+v", d)
+	}
+	if d := p.Decide(clk.sample(Sample{Backlog: 10, Workers: 4, Processed: 100})); d.Target != 3 {
+		t.Fatalf("expected scale down well under target, got %+v", d)
+	}
+	if d := p.Decide(clk.sample(Sample{Backlog: 10, Workers: 4})); d.Target != 5 {
+		t.Fatalf("expected +1 with backlog and no throughput, got %+v", d)
+	}
+}
+
+func TestEWMAPolicySmoothsArrivals(t *testing.T) {
+	clk := &fakeClock{step: time.Second}
+	p := &EWMAPolicy{Alpha: 0.5, WorkerRate: 10}
+	// First sample seeds the average: 100/s at 10/s/worker -> 10 workers.
+	if d := p.Decide(clk.sample(Sample{Arrived: 100, Workers: 3})); d.Target != 10 {
+		t.Fatalf("expected 10, got %+v", d)
+	}
+	// A quiet tick halves the average rather than dropping to zero.
+	if d := p.Decide(clk.sample(Sample{Arrived: 0, Workers: 10})); d.Target != 5 {
+		t.Fatalf("expected 5, got %+v", d)
+	}
+	// Measured capacity replaces the fallback once workers were busy:
+	// 10 workers did 400/s -> 40/s each; rate (50+100)/2=75 + backlog 45 -> 3.
+	if d := p.Decide(clk.sample(Sample{Arrived: 100, Processed: 400, Backlog: 45, Workers: 10})); d.Target != 3 {
+		t.Fatalf("expected 3, got %+v", d)
+	}
+	// Elapsed time comes from the sample clock, not the wall clock.
+	clk.step = 2 * time.Second
+	if d := p.Decide(clk.sample(Sample{Arrived: 150, Workers: 3})); d.Target != 2 {
+		t.Fatalf("expected 2 (75/s over 2s), got %+v", d)
+	}
+}
+
+func TestNewScalingPolicy(t *testing.T) {
+	cfg := config.Config{}
+	for name, want := range map[string]string{
+		"":                 "*queue.ThresholdPolicy",
+		PolicyThreshold:    "*queue.ThresholdPolicy",
+		PolicyLatency:      "*queue.LatencyPolicy",
+		PolicyEWMA:         "*queue.EWMAPolicy",
+		PolicyProportional: "*queue.ProportionalPolicy",
+	} {
+		cfg.ScalePolicy = name
+		p, err := NewScalingPolicy(cfg)
+		if err != nil {
+			t.Fatalf("%q: %v", name, err)
+		}
+		if got := fmt.Sprintf("%T", p); got != want {
+			t.Fatalf("%q: expected %s, got %s", name, want, got)
+		}
+	}
+	cfg.ScalePolicy = "nope"
+	if _, err := NewScalingPolicy(cfg); err == nil {
+		t.Fatalf("expected error for unknown policy")
+	}
+}
+
+func TestProportionalPolicyStepAndCooldown(t *testing.T) {
+	clk := &fakeClock{step: 500 * time.Millisecond}
+	p := &ProportionalPolicy{DrainTarget: time.Second, MaxStep: 100, DownCooldown: 2 * time.Second, WorkerRate: 100}
+	// Burst: 3 workers did 150 in 0.5s (100/s each); 4700 backlog must
+	// drain in 1s -> 47 workers, reached in a single step.
+	if d := p.Decide(clk.sample(Sample{Backlog: 4700, Workers: 3, Processed: 150})); d.Target != 47 {
+		t.Fatalf("expected one step to 47, got %+v", d)
+	}
+	// Backlog gone: hold during the cooldown that follows a change.
+	if d := p.Decide(clk.sample(Sample{Workers: 47})); d.Target != 47 {
+		t.Fatalf("expected hold during cooldown, got %+v", d)
+	}
+	clk.t = clk.t.Add(2 * time.Second)
+	if d := p.Decide(clk.sample(Sample{Workers: 47})); d.Target != 1 {
+		t.Fatalf("expected scale down after cooldown, got %+v", d)
+	}
+
+	capped := &ProportionalPolicy{DrainTarget: time.Second, MaxStep: 5, DownCooldown: time.Second, WorkerRate: 100}
+	if d := capped.Decide(clk.sample(Sample{Backlog: 4700, Workers: 3})); d.Target != 8 {
+		t.Fatalf("expected step capped at +5, got %+v", d)
+	}
+	clk.t = clk.t.Add(time.Second)
+	if d := capped.Decide(clk.sample(Sample{Workers: 20})); d.Target != 15 {
+		t.Fatalf("expected step-down capped at -5, got %+v", d)
+	}
+}
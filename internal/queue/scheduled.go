@@ -0,0 +1,180 @@
+package queue
+
+import (
+	"container/heap"
+	"sort"
+	"time"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/model"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/obs"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/store"
+)
+
+// Clock tells the current time. The queue reads it to release scheduled
+// events; tests inject a fake one with SetClock.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the wall clock.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// ScheduledEvent is an event held until its effective time.
+type ScheduledEvent struct {
+	Sequence    uint64    `json:"sequence"`
+	ProductID   string    `json:"product_id"`
+	Price       *float64  `json:"price,omitempty"`
+	Stock       *int64    `json:"stock,omitempty"`
+	Priority    string    `json:"priority,omitempty"`
+	EffectiveAt time.Time `json:"effective_at"`
+}
+
+func newScheduledEvent(ev model.Event) ScheduledEvent {
+	return ScheduledEvent{
+		Sequence:    ev.Sequence,
+		ProductID:   ev.ProductID,
+		Price:       ev.Price,
+		Stock:       ev.Stock,
+		Priority:    ev.Priority,
+		EffectiveAt: ev.EffectiveAt.UTC(),
+	}
+}
+
+// delayHeap orders held events by effective time, then sequence.
+type delayHeap []model.Event
+
+func (h delayHeap) Len() int { return len(h) }
+func (h delayHeap) Less(i, j int) bool {
+	if !h[i].EffectiveAt.Equal(*h[j].EffectiveAt) {
+		return h[i].EffectiveAt.Before(*h[j].EffectiveAt)
+	}
+	return h[i].Sequence < h[j].Sequence
+}
+func (h delayHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *delayHeap) Push(x any)   { *h = append(*h, x.(model.Event)) }
+func (h *delayHeap) Pop() any {
+	old := *h
+	ev := old[len(old)-1]
+	old[len(old)-1] = model.Event{}
+	*h = old[:len(old)-1]
+	return ev
+}
+
+// SetClock replaces the clock used to release scheduled events. Call it
+// before Start.
+func (q *Queue) SetClock(c Clock) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.clock = c
+}
+
+// Now returns the queue clock's current time.
+func (q *Queue) Now() time.Time {
+	q.mu.Lock()
+	c := q.clock
+	q.mu.Unlock()
+	return c.Now()
+}
+
+// SetRelease makes released events take a fresh sequence from seq, so
+// sequence gating does not skip them as older than updates applied while
+// they were held. onRelease is called, outside the queue lock, with each
+// released event's original sequence and the event as queued. Call it
+// before Start.
+func (q *Queue) SetRelease(seq *Sequencer, onRelease func(orig uint64, ev model.Event)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.seq, q.onRelease = seq, onRelease
+}
+
+// Scheduled returns the held events ordered by effective time.
+func (q *Queue) Scheduled() []ScheduledEvent {
+	q.mu.Lock()
+	held := append(delayHeap(nil), q.delayed...)
+	q.mu.Unlock()
+	sort.Sort(held)
+	out := make([]ScheduledEvent, len(held))
+	for i, ev := range held {
+		out[i] = newScheduledEvent(ev)
+	}
+	return out
+}
+
+// ScheduledStats returns the number of held events and how many were
+// released and cancelled so far.
+func (q *Queue) ScheduledStats() (held int, released, cancelled uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.delayed), q.released, q.cancelled
+}
+
+// CancelScheduled removes the held event with sequence seq. In durable mode
+// the event is acknowledged so it is not replayed. It reports false when
+// no such event is held.
+func (q *Queue) CancelScheduled(seq uint64) (ScheduledEvent, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, ev := range q.delayed {
+		if ev.Sequence != seq {
+			continue
+		}
+		heap.Remove(&q.delayed, i)
+		q.cancelled++
+		q.ackJournal(seq)
+		return newScheduledEvent(ev), true
+	}
+	return ScheduledEvent{}, false
+}
+
+// releaseDueLocked moves held events whose effective time has come into the
+// backlog and returns them with their original sequences. Released events
+// bypass the capacity bound: they were acknowledged when scheduled.
+func (q *Queue) releaseDueLocked() (orig []uint64, evs []model.Event) {
+	now := q.clock.Now()
+	for len(q.delayed) > 0 && !q.delayed[0].EffectiveAt.After(now) {
+		ev := q.delayed[0]
+		seq := ev.Sequence
+		ev.EffectiveAt = nil
+		// The latency clock of a held event starts when it is released.
+		ev.ReceivedAt = time.Time{}
+		if q.seq != nil {
+			ev.Sequence = q.seq.Next()
+			// Journal the event under its new sequence, and sync it, before
+			// dropping the held record, so a crash in between replays it.
+			// Releases are rare enough to sync under q.mu.
+			err := q.journalLocked([]model.Event{ev})
+			if err == nil && q.journal != nil {
+				err = q.recordJournal(q.journal.commit())
+			}
+			if err != nil {
+				obs.Logger.Error("scheduled_release_failed", "sequence", seq, "error", err)
+				break
+			}
+			q.ackJournal(seq)
+		}
+		heap.Pop(&q.delayed)
+		if pp := q.products[ev.ProductID]; q.coalesce && pp != nil && q.foldable(store.ClientVersion(ev), pp.version) {
+			q.mergeLocked(ev)
+			q.merged++
+		} else {
+			q.pushLocked(ev)
+		}
+		q.released++
+		q.enqueued.Add(1)
+		orig = append(orig, seq)
+		evs = append(evs, ev)
+	}
+	return orig, evs
+}
+
+// ackJournal acknowledges seq in the journal without counting it processed.
+func (q *Queue) ackJournal(seq uint64) {
+	if q.journal == nil {
+		return
+	}
+	if err := q.recordJournal(q.journal.ack(seq)); err != nil {
+		obs.Logger.Error("queue_journal_ack_failed", "sequence", seq, "error", err)
+	}
+}
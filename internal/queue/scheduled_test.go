@@ -0,0 +1,150 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/config"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/model"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/obs"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/store"
+)
+
+// manualClock is a Clock that only moves when advanced.
+type manualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newManualClock() *manualClock {
+	return &manualClock{now: time.Date(2025, 11, 28, 23, 0, 0, 0, time.UTC)}
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *manualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func scheduledEvent(id string, seq uint64, price float64, at time.Time) model.Event {
+	ev := priceEvent(id, seq, price)
+	ev.EffectiveAt = &at
+	return ev
+}
+
+func TestScheduledReleasedWhenDue(t *testing.T) {
+	clk := newManualClock()
+	q := New(8)
+	q.SetClock(clk)
+	q.Enqueue(scheduledEvent("late", 1, 1, clk.Now().Add(2*time.Hour)))
+	q.Enqueue(scheduledEvent("early", 2, 1, clk.Now().Add(time.Hour)))
+	q.Enqueue(priceEvent("now", 3, 1))
+
+	q.flushOnce()
+	if len(q.out) != 1 || (<-q.out).Sequence != 3 {
+		t.Fatalf("expected only the unscheduled event out")
+	}
+	if held := q.Scheduled(); len(held) != 2 || held[0].Sequence != 2 || held[1].Sequence != 1 {
+		t.Fatalf("expected held events in effective order, got %+v", held)
+	}
+	if enq, _, _, _ := q.Metrics(); enq != 1 {
+		t.Fatalf("held events must not count as enqueued, got %d", enq)
+	}
+
+	clk.Advance(time.Hour)
+	q.flushOnce()
+	if len(q.out) != 1 || (<-q.out).Sequence != 2 {
+		t.Fatalf("expected the early event released at its effective time")
+	}
+	if _, ok := q.CancelScheduled(1); !ok {
+		t.Fatalf("expected the late event to be cancellable")
+	}
+	clk.Advance(2 * time.Hour)
+	q.flushOnce()
+	if len(q.out) != 0 {
+		t.Fatalf("cancelled event was released")
+	}
+	if held, released, cancelled := q.ScheduledStats(); held != 0 || released != 1 || cancelled != 1 {
+		t.Fatalf("unexpected stats: held=%d released=%d cancelled=%d", held, released, cancelled)
+	}
+}
+
+func TestManagerReleasesScheduledWithFreshSequence(t *testing.T) {
+	obs.InitLogger()
+	clk := newManualClock()
+	cfg := config.Load()
+	cfg.InitialWorkerCount, cfg.WorkerMin, cfg.WorkerMax = 1, 1, 1
+	st := store.New()
+	q := New(8)
+	q.SetClock(clk)
+	mgr := NewManager(cfg, q, st)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mgr.Start(ctx)
+	defer mgr.Stop()
+
+	sale := scheduledEvent("sku", mgr.NextSequence(), 5, clk.Now().Add(time.Hour))
+	_ = mgr.Offer(sale)
+	// A later update applied while the sale is held must not supersede it.
+	stock := int64(9)
+	_ = mgr.Offer(model.Event{ProductID: "sku", Stock: &stock, Sequence: mgr.NextSequence()})
+	if s, _, _ := mgr.EventStatus(sale.Sequence); s.Status != StatusScheduled {
+		t.Fatalf("expected scheduled, got %+v", s)
+	}
+
+	clk.Advance(time.Hour)
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if p, ok := st.Get("sku"); ok && p.Price == 5 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if p, _ := st.Get("sku"); p.Price != 5 || p.Stock != 9 {
+		t.Fatalf("expected scheduled price applied, got %+v", p)
+	}
+	s, _, _ := mgr.EventStatus(sale.Sequence)
+	if s.Status != StatusReleased || s.ReleasedAs <= sale.Sequence+1 {
+		t.Fatalf("expected released under a fresh sequence, got %+v", s)
+	}
+}
+
+func TestScheduledSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	clk := newManualClock()
+	q := openTestDurable(t, dir)
+	q.SetClock(clk)
+	q.Enqueue(scheduledEvent("keep", 1, 1, clk.Now().Add(time.Hour)))
+	q.Enqueue(scheduledEvent("cancel", 2, 1, clk.Now().Add(time.Hour)))
+	q.CancelScheduled(2)
+	if err := q.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	q2 := openTestDurable(t, dir)
+	defer func() { _ = q2.Close() }()
+	q2.SetClock(clk)
+	var seq Sequencer
+	seq.Advance(q2.RecoveredMaxSequence())
+	q2.SetRelease(&seq, nil)
+	held := q2.Scheduled()
+	if len(held) != 1 || held[0].Sequence != 1 || !held[0].EffectiveAt.Equal(clk.Now().Add(time.Hour)) {
+		t.Fatalf("expected the uncancelled event held after restart, got %+v", held)
+	}
+	if q2.BacklogSize() != 0 {
+		t.Fatalf("held event replayed into the backlog")
+	}
+	clk.Advance(time.Hour)
+	q2.flushOnce()
+	if ev := <-q2.out; ev.ProductID != "keep" || ev.Sequence != 3 || ev.EffectiveAt != nil {
+		t.Fatalf("unexpected released event: %+v", ev)
+	}
+}
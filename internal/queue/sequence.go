@@ -7,3 +7,22 @@ type Sequencer struct{ n atomic.Uint64 }
 
 // Next returns the next sequence number.
 func (s *Sequencer) Next() uint64 { return s.n.Add(1) }
+
+// NextN reserves n consecutive sequence numbers and returns the first.
+func (s *Sequencer) NextN(n int) uint64 {
+	if n <= 0 {
+		return s.n.Load()
+	}
+	return s.n.Add(uint64(n)) - uint64(n) + 1
+}
+
+// Advance moves the sequencer forward so Next returns values above n.
+// It never moves the sequencer backwards.
+func (s *Sequencer) Advance(n uint64) {
+	for {
+		cur := s.n.Load()
+		if cur >= n || s.n.CompareAndSwap(cur, n) {
+			return
+		}
+	}
+}
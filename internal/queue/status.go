@@ -0,0 +1,182 @@
+package queue
+
+import (
+	"sync"
+	"time"
+)
+
+// Event processing states reported per sequence.
+const (
+	StatusScheduled  = "scheduled"
+	StatusQueued     = "queued"
+	StatusProcessing = "processing"
+	StatusApplied    = "applied"
+	StatusSuperseded = "superseded"
+	StatusDropped    = "dropped"
+	// StatusReleased ends a scheduled event that was queued under the
+	// sequence in ReleasedAs; StatusCancelled one that was cancelled.
+	StatusReleased  = "released"
+	StatusCancelled = "cancelled"
+)
+
+// statusRank orders states so updates only move forward; a late "queued"
+// from the intake path never overwrites a worker's "processing" or result.
+var statusRank = map[string]int{
+	StatusScheduled:  0,
+	StatusQueued:     1,
+	StatusProcessing: 2,
+	StatusApplied:    3,
+	StatusSuperseded: 3,
+	StatusDropped:    3,
+	StatusReleased:   3,
+	StatusCancelled:  3,
+}
+
+// EventStatus is the tracked outcome of one sequence.
+type EventStatus struct {
+	Sequence  uint64    `json:"sequence"`
+	ProductID string    `json:"product_id"`
+	Status    string    `json:"status"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// MergedInto is the sequence this event was coalesced into, if any.
+	MergedInto uint64 `json:"merged_into,omitempty"`
+	// ReleasedAs is the sequence a scheduled event was queued under.
+	ReleasedAs uint64 `json:"released_as,omitempty"`
+	// Reason says why a superseded event was skipped by the store, e.g.
+	// "stale_version".
+	Reason string `json:"reason,omitempty"`
+}
+
+// StatusTracker keeps per-sequence outcomes for a bounded window of the
+// most recently tracked sequences. When the window is full, the oldest
+// tracked sequence is evicted.
+type StatusTracker struct {
+	mu      sync.Mutex
+	m       map[uint64]*EventStatus
+	ring    []uint64
+	next    int
+	evicted uint64 // highest sequence evicted so far
+}
+
+// NewStatusTracker returns a tracker retaining up to limit sequences, or nil
+// when limit <= 0 (tracking disabled). A nil tracker is safe to use.
+func NewStatusTracker(limit int) *StatusTracker {
+	if limit <= 0 {
+		return nil
+	}
+	return &StatusTracker{m: make(map[uint64]*EventStatus, limit), ring: make([]uint64, 0, limit)}
+}
+
+// Set records status for seq unless it would move the state backwards.
+func (t *StatusTracker) Set(seq uint64, productID, status string) {
+	t.SetMerged(seq, productID, status, 0)
+}
+
+// SetMerged is Set for an event coalesced into the event with sequence
+// into; into is 0 for an event that was not merged.
+func (t *StatusTracker) SetMerged(seq uint64, productID, status string, into uint64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if cur, ok := t.m[seq]; ok {
+		if statusRank[status] < statusRank[cur.Status] {
+			return
+		}
+		cur.Status = status
+		cur.UpdatedAt = time.Now().UTC()
+		if into != 0 {
+			cur.MergedInto = into
+		}
+		return
+	}
+	t.insertLocked(&EventStatus{Sequence: seq, ProductID: productID, Status: status, UpdatedAt: time.Now().UTC(), MergedInto: into})
+}
+
+// SetReleased marks the scheduled event seq released under sequence as.
+func (t *StatusTracker) SetReleased(seq uint64, productID string, as uint64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if cur, ok := t.m[seq]; ok {
+		if statusRank[cur.Status] >= statusRank[StatusReleased] {
+			return
+		}
+		cur.Status, cur.ReleasedAs = StatusReleased, as
+		cur.UpdatedAt = time.Now().UTC()
+		return
+	}
+	t.insertLocked(&EventStatus{Sequence: seq, ProductID: productID, Status: StatusReleased, UpdatedAt: time.Now().UTC(), ReleasedAs: as})
+}
+
+// SetReason records why seq finished as it did.
+func (t *StatusTracker) SetReason(seq uint64, reason string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if cur, ok := t.m[seq]; ok {
+		cur.Reason = reason
+	}
+}
+
+// Requeue marks seq queued again regardless of its current state; used
+// when a dead-lettered event is replayed.
+func (t *StatusTracker) Requeue(seq uint64, productID string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if cur, ok := t.m[seq]; ok {
+		cur.Status, cur.Reason = StatusQueued, ""
+		cur.UpdatedAt = time.Now().UTC()
+		return
+	}
+	t.insertLocked(&EventStatus{Sequence: seq, ProductID: productID, Status: StatusQueued, UpdatedAt: time.Now().UTC()})
+}
+
+func (t *StatusTracker) insertLocked(st *EventStatus) {
+	if len(t.ring) < cap(t.ring) {
+		t.ring = append(t.ring, st.Sequence)
+	} else {
+		old := t.ring[t.next]
+		delete(t.m, old)
+		if old > t.evicted {
+			t.evicted = old
+		}
+		t.ring[t.next] = st.Sequence
+		t.next = (t.next + 1) % len(t.ring)
+	}
+	t.m[st.Sequence] = st
+}
+
+// Get returns the tracked status for seq.
+func (t *StatusTracker) Get(seq uint64) (EventStatus, bool) {
+	if t == nil {
+		return EventStatus{}, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st, ok := t.m[seq]
+	if !ok {
+		return EventStatus{}, false
+	}
+	return *st, true
+}
+
+// Expired reports whether seq is untracked because it aged out of the
+// retention window, as opposed to never having been seen.
+func (t *StatusTracker) Expired(seq uint64) bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.m[seq]
+	return !ok && seq <= t.evicted
+}
@@ -0,0 +1,75 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/config"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/model"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/obs"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/store"
+)
+
+func TestStatusTrackerForwardOnly(t *testing.T) {
+	tr := NewStatusTracker(4)
+	tr.Set(1, "p", StatusProcessing)
+	tr.Set(1, "p", StatusQueued)
+	if st, _ := tr.Get(1); st.Status != StatusProcessing {
+		t.Fatalf("expected processing to win over late queued, got %s", st.Status)
+	}
+	tr.Set(1, "p", StatusApplied)
+	if st, _ := tr.Get(1); st.Status != StatusApplied || st.ProductID != "p" {
+		t.Fatalf("unexpected status %+v", st)
+	}
+}
+
+func TestStatusTrackerRetention(t *testing.T) {
+	tr := NewStatusTracker(3)
+	for seq := uint64(1); seq <= 5; seq++ {
+		tr.Set(seq, "p", StatusQueued)
+	}
+	if _, ok := tr.Get(2); ok {
+		t.Fatalf("expected sequence 2 evicted")
+	}
+	if !tr.Expired(2) || tr.Expired(9) {
+		t.Fatalf("expected 2 expired and 9 unknown")
+	}
+	if _, ok := tr.Get(5); !ok {
+		t.Fatalf("expected sequence 5 retained")
+	}
+	var disabled *StatusTracker
+	disabled.Set(1, "p", StatusQueued)
+	if _, ok := disabled.Get(1); ok {
+		t.Fatalf("expected nil tracker to track nothing")
+	}
+}
+
+func TestManagerTracksOutcomes(t *testing.T) {
+	obs.InitLogger()
+	cfg := config.Load()
+	cfg.InitialWorkerCount = 1
+	cfg.EventStatusRetention = 16
+	mgr := NewManager(cfg, New(8), store.New())
+	price := 1.0
+	_ = mgr.Enqueue(model.Event{ProductID: "o", Price: &price, Sequence: 5})
+	_ = mgr.Enqueue(model.Event{ProductID: "o", Price: &price, Sequence: 3})
+	if st, ok, _ := mgr.EventStatus(5); !ok || st.Status != StatusQueued {
+		t.Fatalf("expected queued before start, got %+v", st)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mgr.Start(ctx)
+	defer mgr.Stop()
+	ctxDrain, cancelDrain := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancelDrain()
+	if !mgr.DrainUntil(ctxDrain) {
+		t.Fatalf("drain timeout")
+	}
+	if st, _, _ := mgr.EventStatus(5); st.Status != StatusApplied {
+		t.Fatalf("expected 5 applied, got %+v", st)
+	}
+	if st, _, _ := mgr.EventStatus(3); st.Status != StatusSuperseded {
+		t.Fatalf("expected 3 superseded, got %+v", st)
+	}
+}
@@ -0,0 +1,68 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/config"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/model"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/obs"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/store"
+)
+
+// panicStore panics when applying events for product "boom".
+type panicStore struct {
+	*store.Store
+}
+
+func (s panicStore) Upsert(ev model.Event) (store.Result, error) {
+	if ev.ProductID == "boom" {
+		panic("adapter exploded")
+	}
+	return s.Store.Upsert(ev)
+}
+
+func TestWorkerPanicIsolated(t *testing.T) {
+	for _, mode := range []string{DispatchShared, DispatchPartitioned} {
+		t.Run(mode, func(t *testing.T) {
+			obs.InitLogger()
+			cfg := config.Load()
+			cfg.DispatchMode = mode
+			cfg.InitialWorkerCount = 1
+			cfg.WorkerMin, cfg.WorkerMax = 1, 1
+			st := panicStore{Store: store.New()}
+			mgr := NewManager(cfg, New(8), st)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			mgr.Start(ctx)
+			defer mgr.Stop()
+
+			price := 2.0
+			boom := model.Event{ProductID: "boom", Price: &price, Sequence: mgr.NextSequence()}
+			mgr.Enqueue(boom)
+			mgr.Enqueue(model.Event{ProductID: "fine", Price: &price, Sequence: mgr.NextSequence()})
+			ctxDrain, cancelDrain := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancelDrain()
+			if !mgr.DrainUntil(ctxDrain) {
+				t.Fatalf("drain timeout")
+			}
+			if _, ok := st.Get("fine"); !ok {
+				t.Fatalf("event after the panic was not applied")
+			}
+			crashes, restarts, poisoned := mgr.CrashMetrics()
+			if crashes != 1 || restarts != 1 || poisoned != 1 {
+				t.Fatalf("expected 1 crash/restart/poison, got %d/%d/%d", crashes, restarts, poisoned)
+			}
+			if p := mgr.PoisonEvents(); p[0].Sequence != boom.Sequence || p[0].Error != "panic: adapter exploded" {
+				t.Fatalf("unexpected poison event: %+v", p[0])
+			}
+			if s, _, _ := mgr.EventStatus(boom.Sequence); s.Status != StatusDropped {
+				t.Fatalf("expected dropped, got %q", s.Status)
+			}
+			if wc := mgr.WorkerCount(); wc != 1 {
+				t.Fatalf("expected pool size kept at 1, got %d", wc)
+			}
+		})
+	}
+}
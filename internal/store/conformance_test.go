@@ -0,0 +1,12 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/store"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/store/storetest"
+)
+
+func TestMemoryConformance(t *testing.T) {
+	storetest.Run(t, func(*testing.T) store.ProductStore { return store.New() })
+}
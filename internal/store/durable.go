@@ -0,0 +1,293 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/model"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/obs"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/wal"
+)
+
+const (
+	walFileName      = "products.wal"
+	snapshotFileName = "products.snapshot.json"
+)
+
+// DurableOptions configures the file-backed store.
+type DurableOptions struct {
+	// Dir holds the write-ahead log and the snapshot file.
+	Dir string
+	// Sync selects when WAL appends are fsynced.
+	Sync wal.SyncPolicy
+	// SyncInterval is the fsync period used with wal.SyncInterval.
+	SyncInterval time.Duration
+	// SnapshotInterval is the period between snapshots; 0 disables them
+	// except on Close.
+	SnapshotInterval time.Duration
+	// Ordering gates updates; empty means OrderSequence.
+	Ordering Ordering
+}
+
+// walRecord is the on-disk form of an applied event.
+type walRecord struct {
+	ProductID string   `json:"product_id"`
+	Price     *float64 `json:"price,omitempty"`
+	Stock     *int64   `json:"stock,omitempty"`
+	Sequence  uint64   `json:"sequence"`
+	// Version is the event's client version, so replay gates it the same
+	// way.
+	Version uint64 `json:"version,omitempty"`
+}
+
+func (r walRecord) event() model.Event {
+	ev := model.Event{ProductID: r.ProductID, Price: r.Price, Stock: r.Stock, Sequence: r.Sequence}
+	if r.Version != 0 {
+		v := r.Version
+		ev.Version = &v
+	}
+	return ev
+}
+
+// snapshotEntry is the on-disk form of one product state.
+type snapshotEntry struct {
+	model.Product
+	LastSequence uint64 `json:"last_sequence"`
+	LastVersion  uint64 `json:"last_version,omitempty"`
+}
+
+type snapshotFile struct {
+	Products []snapshotEntry `json:"products"`
+}
+
+// Durable is a ProductStore that keeps state in memory and persists every
+// applied event to a write-ahead log, with periodic snapshots that compact
+// the log. On open, state is rebuilt from the snapshot plus the WAL tail.
+type Durable struct {
+	// mu serializes writers so WAL order matches apply order and snapshots
+	// see a state consistent with the log they truncate.
+	mu     sync.Mutex
+	mem    *Store
+	log    *wal.Log
+	opts   DurableOptions
+	maxSeq uint64
+	// failure is the error of the latest WAL write, sync or snapshot, or
+	// nil when it succeeded; Health reports it.
+	failure atomic.Pointer[error]
+}
+
+var _ ProductStore = (*Durable)(nil)
+
+// OpenDurable opens (or initializes) a durable store in opts.Dir.
+func OpenDurable(opts DurableOptions) (*Durable, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("store: durable dir is required")
+	}
+	if err := os.MkdirAll(opts.Dir, 0o750); err != nil {
+		return nil, err
+	}
+	order, err := ParseOrdering(string(opts.Ordering))
+	if err != nil {
+		return nil, err
+	}
+	d := &Durable{mem: NewOrdered(order), opts: opts}
+	if err := d.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	replayed := 0
+	log, err := wal.Open(filepath.Join(opts.Dir, walFileName), opts.Sync, func(payload []byte) error {
+		var rec walRecord
+		if err := json.Unmarshal(payload, &rec); err != nil {
+			return fmt.Errorf("store: decode wal record: %w", err)
+		}
+		d.applyLocked(rec.event())
+		replayed++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	d.log = log
+	obs.Logger.Info("store_recovered", "dir", opts.Dir, "wal_records", replayed, "max_sequence", d.maxSeq)
+	return d, nil
+}
+
+func (d *Durable) loadSnapshot() error {
+	data, err := os.ReadFile(filepath.Join(d.opts.Dir, snapshotFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var snap snapshotFile
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("store: decode snapshot: %w", err)
+	}
+	for _, e := range snap.Products {
+		d.mem.m[e.ProductID] = productState{p: e.Product, lastSequence: e.LastSequence, lastVersion: e.LastVersion}
+		if e.LastSequence > d.maxSeq {
+			d.maxSeq = e.LastSequence
+		}
+	}
+	return nil
+}
+
+// applyLocked applies ev to memory and tracks the highest sequence seen.
+func (d *Durable) applyLocked(ev model.Event) Result {
+	res, _ := d.mem.Upsert(ev)
+	if res.Applied && ev.Sequence > d.maxSeq {
+		d.maxSeq = ev.Sequence
+	}
+	return res
+}
+
+// Get retrieves a product by ID.
+func (d *Durable) Get(id string) (model.Product, bool) { return d.mem.Get(id) }
+
+// LastSequence returns the sequence of the last event applied to id.
+func (d *Durable) LastSequence(id string) (uint64, bool) { return d.mem.LastSequence(id) }
+
+// Changed returns a channel closed the next time id advances, and a func
+// releasing the wait.
+func (d *Durable) Changed(id string) (<-chan struct{}, func()) { return d.mem.Changed(id) }
+
+// Upsert logs the event to the WAL and then applies it. Events skipped by
+// ordering are not logged.
+func (d *Durable) Upsert(ev model.Event) (Result, error) {
+	if ev.ProductID == "" {
+		return Result{}, nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if res, skip := d.mem.skip(ev); skip {
+		return res, nil
+	}
+	payload, err := json.Marshal(walRecord{ProductID: ev.ProductID, Price: ev.Price, Stock: ev.Stock, Sequence: ev.Sequence, Version: ClientVersion(ev)})
+	if err != nil {
+		return Result{}, err
+	}
+	if err := d.record(d.log.Append(payload)); err != nil {
+		return Result{}, fmt.Errorf("store: wal append: %w", err)
+	}
+	return d.applyLocked(ev), nil
+}
+
+// MaxSequence returns the highest sequence applied, used to seed the
+// sequencer after a restart so new events are not treated as stale.
+func (d *Durable) MaxSequence() uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.maxSeq
+}
+
+// Snapshot writes the current state atomically and compacts the WAL.
+func (d *Durable) Snapshot() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	snap := snapshotFile{Products: d.mem.entries()}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(d.opts.Dir, snapshotFileName), data); err != nil {
+		return err
+	}
+	return d.log.Reset()
+}
+
+// Run flushes the WAL and takes snapshots on the configured intervals
+// until ctx is done.
+func (d *Durable) Run(ctx context.Context) {
+	var syncC, snapC <-chan time.Time
+	if d.opts.Sync == wal.SyncInterval && d.opts.SyncInterval > 0 {
+		t := time.NewTicker(d.opts.SyncInterval)
+		defer t.Stop()
+		syncC = t.C
+	}
+	if d.opts.SnapshotInterval > 0 {
+		t := time.NewTicker(d.opts.SnapshotInterval)
+		defer t.Stop()
+		snapC = t.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-syncC:
+			if err := d.record(d.log.Flush()); err != nil {
+				obs.Logger.Error("store_wal_sync_failed", "error", err)
+			}
+		case <-snapC:
+			if err := d.record(d.Snapshot()); err != nil {
+				obs.Logger.Error("store_snapshot_failed", "error", err)
+			} else {
+				obs.Logger.Info("store_snapshot_written", "dir", d.opts.Dir)
+			}
+		}
+	}
+}
+
+// record stores err as the current persistence health and returns it.
+func (d *Durable) record(err error) error {
+	if err != nil {
+		d.failure.Store(&err)
+	} else {
+		d.failure.Store(nil)
+	}
+	return err
+}
+
+// Health returns the error of the most recent WAL write, sync or snapshot,
+// or nil when it succeeded. A later success clears an earlier failure.
+func (d *Durable) Health() error {
+	if p := d.failure.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
+
+// Close takes a final snapshot and closes the WAL.
+func (d *Durable) Close() error {
+	err := d.Snapshot()
+	if cerr := d.log.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// writeFileAtomic writes data to a temp file, fsyncs it and renames it
+// over path so readers never observe a partial snapshot.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		_ = dir.Sync()
+		_ = dir.Close()
+	}
+	return nil
+}
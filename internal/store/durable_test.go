@@ -0,0 +1,167 @@
+package store_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/model"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/obs"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/store"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/store/storetest"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/wal"
+)
+
+func openDurable(t *testing.T, dir string) *store.Durable {
+	t.Helper()
+	obs.InitLogger()
+	d, err := store.OpenDurable(store.DurableOptions{Dir: dir, Sync: wal.SyncAlways})
+	if err != nil {
+		t.Fatalf("open durable: %v", err)
+	}
+	return d
+}
+
+func mustUpsert(t *testing.T, s store.ProductStore, ev model.Event) {
+	t.Helper()
+	if _, err := s.Upsert(ev); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+}
+
+func TestDurableConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.ProductStore {
+		d := openDurable(t, t.TempDir())
+		t.Cleanup(func() { _ = d.Close() })
+		return d
+	})
+}
+
+func TestDurableRecoversFromWAL(t *testing.T) {
+	dir := t.TempDir()
+	d := openDurable(t, dir)
+	price := 3.5
+	stock := int64(4)
+	mustUpsert(t, d, model.Event{ProductID: "a", Price: &price, Sequence: 1})
+	mustUpsert(t, d, model.Event{ProductID: "a", Stock: &stock, Sequence: 2})
+	// Simulate a crash: no Close, so no snapshot is written.
+	d2 := openDurable(t, dir)
+	defer func() { _ = d2.Close() }()
+	got, ok := d2.Get("a")
+	if !ok || got.Price != 3.5 || got.Stock != 4 {
+		t.Fatalf("unexpected recovered state: %+v (found=%v)", got, ok)
+	}
+	if d2.MaxSequence() != 2 {
+		t.Fatalf("expected max sequence 2, got %d", d2.MaxSequence())
+	}
+}
+
+func TestDurableSnapshotCompactsWAL(t *testing.T) {
+	dir := t.TempDir()
+	d := openDurable(t, dir)
+	price := 1.0
+	mustUpsert(t, d, model.Event{ProductID: "s", Price: &price, Sequence: 5})
+	if err := d.Snapshot(); err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	fi, err := os.Stat(filepath.Join(dir, "products.wal"))
+	if err != nil {
+		t.Fatalf("stat wal: %v", err)
+	}
+	if fi.Size() != 0 {
+		t.Fatalf("expected compacted wal, size=%d", fi.Size())
+	}
+	price2 := 2.0
+	mustUpsert(t, d, model.Event{ProductID: "s", Price: &price2, Sequence: 6})
+	d2 := openDurable(t, dir)
+	defer func() { _ = d2.Close() }()
+	if got, _ := d2.Get("s"); got.Price != 2.0 {
+		t.Fatalf("expected snapshot + wal tail, got %+v", got)
+	}
+	// Stale events stay stale across restarts.
+	old := 9.0
+	mustUpsert(t, d2, model.Event{ProductID: "s", Price: &old, Sequence: 5})
+	if got, _ := d2.Get("s"); got.Price != 2.0 {
+		t.Fatalf("expected stale event skipped after recovery, got %+v", got)
+	}
+}
+
+func TestDurableCrashMidRecord(t *testing.T) {
+	dir := t.TempDir()
+	d := openDurable(t, dir)
+	p1, p2 := 1.0, 2.0
+	mustUpsert(t, d, model.Event{ProductID: "c", Price: &p1, Sequence: 1})
+	walPath := filepath.Join(dir, "products.wal")
+	fi, _ := os.Stat(walPath)
+	intact := fi.Size()
+	mustUpsert(t, d, model.Event{ProductID: "c", Price: &p2, Sequence: 2})
+	fi, _ = os.Stat(walPath)
+	// Chop the second record mid-payload.
+	if err := os.Truncate(walPath, intact+(fi.Size()-intact)/2); err != nil {
+		t.Fatalf("truncate: %v", err)
+	}
+	d2 := openDurable(t, dir)
+	got, _ := d2.Get("c")
+	if got.Price != 1.0 {
+		t.Fatalf("expected state up to last intact record, got %+v", got)
+	}
+	// The log stays appendable after recovery.
+	mustUpsert(t, d2, model.Event{ProductID: "c", Price: &p2, Sequence: 3})
+	d3 := openDurable(t, dir)
+	defer func() { _ = d3.Close() }()
+	if got, _ := d3.Get("c"); got.Price != 2.0 {
+		t.Fatalf("expected appended record after recovery, got %+v", got)
+	}
+}
+
+func TestDurableHealthReportsWALFailure(t *testing.T) {
+	d := openDurable(t, t.TempDir())
+	price := 1.0
+	mustUpsert(t, d, model.Event{ProductID: "h", Price: &price, Sequence: 1})
+	if err := d.Health(); err != nil {
+		t.Fatalf("healthy store reported %v", err)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if _, err := d.Upsert(model.Event{ProductID: "h", Price: &price, Sequence: 2}); err == nil {
+		t.Fatalf("upsert after close succeeded")
+	}
+	if d.Health() == nil {
+		t.Fatalf("failed WAL append not reported by Health")
+	}
+}
+
+func TestDurableReplaysClientVersions(t *testing.T) {
+	dir := t.TempDir()
+	obs.InitLogger()
+	open := func() *store.Durable {
+		d, err := store.OpenDurable(store.DurableOptions{Dir: dir, Sync: wal.SyncAlways, Ordering: store.OrderVersion})
+		if err != nil {
+			t.Fatalf("open durable: %v", err)
+		}
+		return d
+	}
+	d := open()
+	v5, price := uint64(5), 7.0
+	mustUpsert(t, d, model.Event{ProductID: "a", Price: &price, Version: &v5, Sequence: 1})
+	// Simulate a crash; the replayed WAL record must keep version 5.
+	d2 := open()
+	v4, older := uint64(4), 1.0
+	res, err := d2.Upsert(model.Event{ProductID: "a", Price: &older, Version: &v4, Sequence: 2})
+	if err != nil || res.Applied || res.Reason != store.ReasonStaleVersion {
+		t.Fatalf("expected stale_version skip after replay, got %+v %v", res, err)
+	}
+	// The snapshot carries the version too.
+	if err := d2.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	d3 := open()
+	defer func() { _ = d3.Close() }()
+	if res, _ := d3.Upsert(model.Event{ProductID: "a", Price: &older, Version: &v4, Sequence: 3}); res.Applied {
+		t.Fatalf("expected stale_version skip after snapshot, got %+v", res)
+	}
+	if _, err := store.OpenDurable(store.DurableOptions{Dir: t.TempDir(), Ordering: "lamport"}); err == nil {
+		t.Fatalf("expected unknown ordering to fail")
+	}
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"sync"
+)
+
+// Notifier wakes readers waiting for a product to advance. The zero value
+// is ready to use. Implementations of ProductStore embed or wrap one and
+// call Notify after every applied event.
+type Notifier struct {
+	mu    sync.Mutex
+	waits map[string]*waiters
+}
+
+// waiters is the channel shared by the readers waiting on one product and
+// how many of them have not yet released it.
+type waiters struct {
+	ch   chan struct{}
+	refs int
+}
+
+// Changed returns a channel that is closed the next time id advances, and
+// a release func the caller must call once it stops waiting. The entry for
+// id is dropped when its last waiter releases it, so waits on products
+// that never advance do not accumulate.
+func (n *Notifier) Changed(id string) (<-chan struct{}, func()) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.waits == nil {
+		n.waits = make(map[string]*waiters)
+	}
+	w, ok := n.waits[id]
+	if !ok {
+		w = &waiters{ch: make(chan struct{})}
+		n.waits[id] = w
+	}
+	w.refs++
+	released := false
+	return w.ch, func() {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		if released {
+			return
+		}
+		released = true
+		w.refs--
+		// Notify already removed the entry if it fired.
+		if w.refs == 0 && n.waits[id] == w {
+			delete(n.waits, id)
+		}
+	}
+}
+
+// Notify wakes every reader waiting on id.
+func (n *Notifier) Notify(id string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if w, ok := n.waits[id]; ok {
+		close(w.ch)
+		delete(n.waits, id)
+	}
+}
+
+// pending returns how many products have readers waiting on them.
+func (n *Notifier) pending() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.waits)
+}
+
+// WaitForSequence blocks until product id has applied a sequence >= minSeq,
+// or ctx is done. It returns ctx.Err() on timeout or cancellation.
+func WaitForSequence(ctx context.Context, s ProductStore, id string, minSeq uint64) error {
+	for {
+		// Subscribe before checking so an advance in between is not missed.
+		ch, release := s.Changed(id)
+		if last, ok := s.LastSequence(id); ok && last >= minSeq {
+			release()
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			release()
+			return ctx.Err()
+		case <-ch:
+			release()
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/model"
+)
+
+// Ordering selects how Upsert decides whether an event supersedes the
+// state of its product.
+type Ordering string
+
+const (
+	// OrderSequence orders events by the server sequence assigned at
+	// intake, i.e. by arrival at this instance. It is the default.
+	OrderSequence Ordering = "sequence"
+	// OrderVersion orders events by their client version (version or
+	// source_timestamp); an event repeating the applied version is skipped.
+	OrderVersion Ordering = "version"
+	// OrderHybrid orders events by client version and breaks ties with the
+	// server sequence. Events without a client version sort first.
+	OrderHybrid Ordering = "hybrid"
+)
+
+// Reasons reported in Result.Reason for a skipped event.
+const (
+	// ReasonStaleSequence: the product already applied a newer sequence.
+	ReasonStaleSequence = "stale_sequence"
+	// ReasonStaleVersion: the product already applied a newer client
+	// version.
+	ReasonStaleVersion = "stale_version"
+	// ReasonDuplicateVersion: the product already applied this client
+	// version (version ordering only).
+	ReasonDuplicateVersion = "duplicate_version"
+)
+
+// ParseOrdering parses "sequence", "version" or "hybrid".
+func ParseOrdering(s string) (Ordering, error) {
+	switch o := Ordering(strings.ToLower(strings.TrimSpace(s))); o {
+	case "", OrderSequence:
+		return OrderSequence, nil
+	case OrderVersion, OrderHybrid:
+		return o, nil
+	default:
+		return OrderSequence, fmt.Errorf("store: unknown ordering %q", s)
+	}
+}
+
+// ClientVersion returns the client-supplied version of ev: Version when
+// set, else SourceTimestamp in Unix nanoseconds, else 0.
+func ClientVersion(ev model.Event) uint64 {
+	switch {
+	case ev.Version != nil:
+		return *ev.Version
+	case ev.SourceTimestamp != nil && ev.SourceTimestamp.UnixNano() > 0:
+		return uint64(ev.SourceTimestamp.UnixNano()) //nolint:gosec // checked positive
+	default:
+		return 0
+	}
+}
+
+// Position is where an event sits in the update order of its product.
+type Position struct {
+	Version  uint64
+	Sequence uint64
+}
+
+// PositionOf returns the position of ev.
+func PositionOf(ev model.Event) Position {
+	return Position{Version: ClientVersion(ev), Sequence: ev.Sequence}
+}
+
+// Supersedes reports whether an event at next may replace state last
+// written at last under o and, when it may not, the skip reason.
+func (o Ordering) Supersedes(next, last Position) (bool, string) {
+	switch o {
+	case OrderVersion:
+		switch {
+		case next.Version > last.Version:
+			return true, ""
+		case next.Version == last.Version:
+			return false, ReasonDuplicateVersion
+		}
+		return false, ReasonStaleVersion
+	case OrderHybrid:
+		switch {
+		case next.Version > last.Version:
+			return true, ""
+		case next.Version < last.Version:
+			return false, ReasonStaleVersion
+		}
+	}
+	if Supersedes(next.Sequence, last.Sequence) {
+		return true, ""
+	}
+	return false, ReasonStaleSequence
+}
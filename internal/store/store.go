@@ -1,4 +1,4 @@
-// Package store provides an in-memory product state store for the simulator.
+// Package store provides product state storage for the simulator.
 package store
 
 import (
@@ -7,21 +7,83 @@ import (
 	"github.com/fairyhunter13/product-update-service-simulator/internal/model"
 )
 
-// productState holds a product and its last sequence number.
+// ProductStore is the storage contract used by workers and HTTP handlers.
+//
+// Implementations must apply the sequence-gating rule (see Supersedes): an
+// event only mutates state when its sequence is newer than the last one
+// applied to that product, and only the fields present in the event change.
+// A store may be configured with another Ordering, which then decides what
+// "newer" means.
+type ProductStore interface {
+	// Get retrieves a product by ID.
+	Get(id string) (model.Product, bool)
+	// LastSequence returns the sequence of the last event applied to id.
+	LastSequence(id string) (uint64, bool)
+	// Upsert applies an event and reports whether it changed the product.
+	Upsert(ev model.Event) (Result, error)
+	// Changed returns a channel closed the next time id advances, and a
+	// func the caller calls once it stops waiting on it.
+	Changed(id string) (<-chan struct{}, func())
+}
+
+// Result describes the outcome of applying an event.
+type Result struct {
+	// Applied is false when the event was skipped by sequence gating.
+	Applied bool
+	// Reason says why a skipped event was not applied (Reason* constants).
+	Reason string
+	// Product is the product state after the call.
+	Product model.Product
+	// Previous is the state the event replaced; nil when it created the
+	// product or was skipped.
+	Previous *model.Product
+}
+
+// Supersedes reports whether an event with sequence seq may replace state
+// last written at sequence last. Equal sequences are idempotent no-ops.
+func Supersedes(seq, last uint64) bool { return seq > last }
+
+// Merge returns p with the fields present in ev applied (partial update).
+func Merge(p model.Product, ev model.Event) model.Product {
+	p.ProductID = ev.ProductID
+	if ev.Price != nil {
+		p.Price = *ev.Price
+	}
+	if ev.Stock != nil {
+		p.Stock = *ev.Stock
+	}
+	return p
+}
+
+// productState holds a product and the position of its last applied event.
 type productState struct {
 	p            model.Product
 	lastSequence uint64
+	lastVersion  uint64
+}
+
+func (st productState) position() Position {
+	return Position{Version: st.lastVersion, Sequence: st.lastSequence}
 }
 
-// Store holds product states with concurrency protection.
+// Store is the in-memory ProductStore, a map guarded by a RWMutex.
 type Store struct {
-	mu sync.RWMutex
-	m  map[string]productState
+	mu    sync.RWMutex
+	m     map[string]productState
+	n     Notifier
+	order Ordering
 }
 
-// New creates a new in-memory Store.
+var _ ProductStore = (*Store)(nil)
+
+// New creates a new in-memory Store ordered by server sequence.
 func New() *Store {
-	return &Store{m: make(map[string]productState)}
+	return NewOrdered(OrderSequence)
+}
+
+// NewOrdered creates a new in-memory Store that gates updates by order.
+func NewOrdered(order Ordering) *Store {
+	return &Store{m: make(map[string]productState), order: order}
 }
 
 // Get retrieves a product by ID.
@@ -35,38 +97,71 @@ func (s *Store) Get(id string) (model.Product, bool) {
 	return st.p, true
 }
 
-// Upsert applies an event to the product state with simple sequence checks.
-func (s *Store) Upsert(ev model.Event) {
+// Upsert applies an event to the product state if it supersedes the last
+// applied event under the store's ordering.
+func (s *Store) Upsert(ev model.Event) (Result, error) {
 	if ev.ProductID == "" {
-		return
+		return Result{}, nil
 	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	st, ok := s.m[ev.ProductID]
 	if ok {
-		if ev.Sequence < st.lastSequence {
-			return
+		if newer, reason := s.order.Supersedes(PositionOf(ev), st.position()); !newer {
+			return Result{Product: st.p, Reason: reason}, nil
 		}
-		if ev.Sequence == st.lastSequence {
-			return
-		}
-		if ev.Price != nil {
-			st.p.Price = *ev.Price
-		}
-		if ev.Stock != nil {
-			st.p.Stock = *ev.Stock
-		}
-		st.lastSequence = ev.Sequence
-		s.m[ev.ProductID] = st
-		return
 	}
-	// new entry
-	p := model.Product{ProductID: ev.ProductID}
-	if ev.Price != nil {
-		p.Price = *ev.Price
+	var prev *model.Product
+	if ok {
+		p := st.p
+		prev = &p
 	}
-	if ev.Stock != nil {
-		p.Stock = *ev.Stock
+	st = productState{p: Merge(st.p, ev), lastSequence: ev.Sequence, lastVersion: ClientVersion(ev)}
+	s.m[ev.ProductID] = st
+	s.n.Notify(ev.ProductID)
+	return Result{Applied: true, Product: st.p, Previous: prev}, nil
+}
+
+// LastSequence returns the sequence of the last event applied to id.
+func (s *Store) LastSequence(id string) (uint64, bool) {
+	_, seq, ok := s.state(id)
+	return seq, ok
+}
+
+// Changed returns a channel closed the next time id advances, and a func
+// releasing the wait.
+func (s *Store) Changed(id string) (<-chan struct{}, func()) { return s.n.Changed(id) }
+
+// state returns the product and its last sequence.
+func (s *Store) state(id string) (model.Product, uint64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	st, ok := s.m[id]
+	return st.p, st.lastSequence, ok
+}
+
+// skip returns the skip result for ev when it does not supersede the
+// stored state of its product.
+func (s *Store) skip(ev model.Event) (Result, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	st, ok := s.m[ev.ProductID]
+	if !ok {
+		return Result{}, false
+	}
+	if newer, reason := s.order.Supersedes(PositionOf(ev), st.position()); !newer {
+		return Result{Product: st.p, Reason: reason}, true
+	}
+	return Result{}, false
+}
+
+// entries returns a copy of every product state for snapshotting.
+func (s *Store) entries() []snapshotEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]snapshotEntry, 0, len(s.m))
+	for _, st := range s.m {
+		out = append(out, snapshotEntry{Product: st.p, LastSequence: st.lastSequence, LastVersion: st.lastVersion})
 	}
-	s.m[ev.ProductID] = productState{p: p, lastSequence: ev.Sequence}
+	return out
 }
@@ -1,8 +1,10 @@
 package store
 
 import (
+	"context"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/fairyhunter13/product-update-service-simulator/internal/model"
 )
@@ -56,3 +58,87 @@ func TestStoreConcurrentUpserts(t *testing.T) {
 		t.Fatalf("expected 100, got %d", got.Stock)
 	}
 }
+
+func TestStoreOrderingModes(t *testing.T) {
+	ver := func(v uint64) *uint64 { return &v }
+	price := func(p float64) *float64 { return &p }
+	// Version 2 arrives with sequence 1, version 1 later with sequence 2,
+	// then a repeat of version 2 with sequence 3.
+	evs := []model.Event{
+		{ProductID: "p", Price: price(2), Version: ver(2), Sequence: 1},
+		{ProductID: "p", Price: price(1), Version: ver(1), Sequence: 2},
+		{ProductID: "p", Price: price(3), Version: ver(2), Sequence: 3},
+	}
+	cases := []struct {
+		order   Ordering
+		reasons []string
+		price   float64
+	}{
+		{OrderSequence, []string{"", "", ""}, 3},
+		{OrderVersion, []string{"", ReasonStaleVersion, ReasonDuplicateVersion}, 2},
+		{OrderHybrid, []string{"", ReasonStaleVersion, ""}, 3},
+	}
+	for _, tc := range cases {
+		t.Run(string(tc.order), func(t *testing.T) {
+			s := NewOrdered(tc.order)
+			for i, ev := range evs {
+				res, _ := s.Upsert(ev)
+				if res.Applied != (tc.reasons[i] == "") || res.Reason != tc.reasons[i] {
+					t.Fatalf("event %d: applied=%v reason=%q, want reason %q", i, res.Applied, res.Reason, tc.reasons[i])
+				}
+			}
+			if got, _ := s.Get("p"); got.Price != tc.price {
+				t.Fatalf("expected price %v, got %v", tc.price, got.Price)
+			}
+		})
+	}
+}
+
+func TestStoreSkipsStaleSequenceWithReason(t *testing.T) {
+	s := New()
+	p := 1.0
+	s.Upsert(model.Event{ProductID: "p", Price: &p, Sequence: 2})
+	if res, _ := s.Upsert(model.Event{ProductID: "p", Price: &p, Sequence: 1}); res.Applied || res.Reason != ReasonStaleSequence {
+		t.Fatalf("expected stale_sequence skip, got %+v", res)
+	}
+}
+
+func TestClientVersionFromSourceTimestamp(t *testing.T) {
+	ts := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	if got := ClientVersion(model.Event{SourceTimestamp: &ts}); got != uint64(ts.UnixNano()) {
+		t.Fatalf("unexpected version %d", got)
+	}
+	if got := ClientVersion(model.Event{}); got != 0 {
+		t.Fatalf("expected 0 without a version, got %d", got)
+	}
+	if _, err := ParseOrdering("lamport"); err == nil {
+		t.Fatalf("expected unknown ordering to fail")
+	}
+}
+
+func TestNotifierDropsReleasedWaits(t *testing.T) {
+	s := New()
+	for _, id := range []string{"a", "b", "a"} {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		if err := WaitForSequence(ctx, s, id, 1); err == nil {
+			t.Fatalf("expected timeout waiting on %s", id)
+		}
+		cancel()
+	}
+	ch, release := s.Changed("c")
+	_, releaseOther := s.Changed("c")
+	release()
+	if got := s.n.pending(); got != 1 {
+		t.Fatalf("expected the shared wait kept while one waiter remains, got %d", got)
+	}
+	releaseOther()
+	release()
+	if got := s.n.pending(); got != 0 {
+		t.Fatalf("expected no pending waits, got %d", got)
+	}
+	select {
+	case <-ch:
+		t.Fatalf("released wait must not be closed")
+	default:
+	}
+}
@@ -0,0 +1,162 @@
+// Package storetest provides a conformance suite for store.ProductStore
+// implementations.
+package storetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/model"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/store"
+)
+
+// Factory returns a fresh, empty store for a single subtest.
+type Factory func(t *testing.T) store.ProductStore
+
+// Run executes the conformance suite against stores produced by newStore.
+func Run(t *testing.T, newStore Factory) {
+	t.Helper()
+	t.Run("GetMissing", func(t *testing.T) { testGetMissing(t, newStore(t)) })
+	t.Run("PartialUpdates", func(t *testing.T) { testPartialUpdates(t, newStore(t)) })
+	t.Run("LastWriteWins", func(t *testing.T) { testLastWriteWins(t, newStore(t)) })
+	t.Run("EqualSequenceNoop", func(t *testing.T) { testEqualSequenceNoop(t, newStore(t)) })
+	t.Run("EmptyProductID", func(t *testing.T) { testEmptyProductID(t, newStore(t)) })
+	t.Run("LastSequence", func(t *testing.T) { testLastSequence(t, newStore(t)) })
+	t.Run("ChangedNotifies", func(t *testing.T) { testChangedNotifies(t, newStore(t)) })
+}
+
+func upsert(t *testing.T, s store.ProductStore, ev model.Event) store.Result {
+	t.Helper()
+	res, err := s.Upsert(ev)
+	if err != nil {
+		t.Fatalf("upsert %+v: %v", ev, err)
+	}
+	return res
+}
+
+func get(t *testing.T, s store.ProductStore, id string) model.Product {
+	t.Helper()
+	p, ok := s.Get(id)
+	if !ok {
+		t.Fatalf("product %q not found", id)
+	}
+	return p
+}
+
+func testGetMissing(t *testing.T, s store.ProductStore) {
+	if _, ok := s.Get("missing"); ok {
+		t.Fatalf("expected missing product")
+	}
+}
+
+func testPartialUpdates(t *testing.T, s store.ProductStore) {
+	price := 10.5
+	stock := int64(7)
+	if res := upsert(t, s, model.Event{ProductID: "p1", Price: &price, Sequence: 1}); !res.Applied || res.Previous != nil {
+		t.Fatalf("expected first event applied with no previous state, got %+v", res)
+	}
+	res := upsert(t, s, model.Event{ProductID: "p1", Stock: &stock, Sequence: 2})
+	if !res.Applied {
+		t.Fatalf("expected second event applied")
+	}
+	if prev := (model.Product{ProductID: "p1", Price: 10.5}); res.Previous == nil || *res.Previous != prev {
+		t.Fatalf("previous: got %+v, want %+v", res.Previous, prev)
+	}
+	want := model.Product{ProductID: "p1", Price: 10.5, Stock: 7}
+	if res.Product != want {
+		t.Fatalf("result product: got %+v, want %+v", res.Product, want)
+	}
+	if got := get(t, s, "p1"); got != want {
+		t.Fatalf("stored product: got %+v, want %+v", got, want)
+	}
+}
+
+func testLastWriteWins(t *testing.T, s store.ProductStore) {
+	newer := 1.0
+	older := 99.0
+	upsert(t, s, model.Event{ProductID: "p2", Price: &newer, Sequence: 2})
+	if res := upsert(t, s, model.Event{ProductID: "p2", Price: &older, Sequence: 1}); res.Applied || res.Reason != store.ReasonStaleSequence {
+		t.Fatalf("expected stale event skipped as %s, got %+v", store.ReasonStaleSequence, res)
+	}
+	if got := get(t, s, "p2"); got.Price != 1.0 {
+		t.Fatalf("expected 1.0, got %v", got.Price)
+	}
+}
+
+func testEqualSequenceNoop(t *testing.T, s store.ProductStore) {
+	first := 5.0
+	dup := 6.0
+	upsert(t, s, model.Event{ProductID: "p3", Price: &first, Sequence: 3})
+	res := upsert(t, s, model.Event{ProductID: "p3", Price: &dup, Sequence: 3})
+	if res.Applied {
+		t.Fatalf("expected equal sequence to be a no-op")
+	}
+	if res.Product.Price != 5.0 {
+		t.Fatalf("expected result to report current state, got %+v", res.Product)
+	}
+	if got := get(t, s, "p3"); got.Price != 5.0 {
+		t.Fatalf("expected 5.0, got %v", got.Price)
+	}
+}
+
+func testEmptyProductID(t *testing.T, s store.ProductStore) {
+	price := 1.0
+	if res := upsert(t, s, model.Event{Price: &price, Sequence: 1}); res.Applied {
+		t.Fatalf("expected empty product_id ignored")
+	}
+	if _, ok := s.Get(""); ok {
+		t.Fatalf("expected no product stored for empty id")
+	}
+}
+
+func testLastSequence(t *testing.T, s store.ProductStore) {
+	if _, ok := s.LastSequence("p4"); ok {
+		t.Fatalf("expected no sequence for missing product")
+	}
+	price := 1.0
+	upsert(t, s, model.Event{ProductID: "p4", Price: &price, Sequence: 7})
+	upsert(t, s, model.Event{ProductID: "p4", Price: &price, Sequence: 4})
+	if seq, ok := s.LastSequence("p4"); !ok || seq != 7 {
+		t.Fatalf("expected last sequence 7, got %d (found=%v)", seq, ok)
+	}
+}
+
+func testChangedNotifies(t *testing.T, s store.ProductStore) {
+	price := 1.0
+	ch, release := s.Changed("p5")
+	defer release()
+	upsert(t, s, model.Event{ProductID: "p5", Price: &price, Sequence: 2})
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatalf("expected Changed channel closed after applied event")
+	}
+	stale, releaseStale := s.Changed("p5")
+	defer releaseStale()
+	upsert(t, s, model.Event{ProductID: "p5", Price: &price, Sequence: 1})
+	select {
+	case <-stale:
+		t.Fatalf("stale event must not notify")
+	default:
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	upserted := make(chan error, 1)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_, err := s.Upsert(model.Event{ProductID: "p5", Price: &price, Sequence: 9})
+		upserted <- err
+	}()
+	if err := store.WaitForSequence(ctx, s, "p5", 9); err != nil {
+		t.Fatalf("wait for sequence: %v", err)
+	}
+	if err := <-upserted; err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	short, cancelShort := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelShort()
+	if err := store.WaitForSequence(short, s, "p5", 100); err == nil {
+		t.Fatalf("expected timeout waiting for unreachable sequence")
+	}
+}
@@ -0,0 +1,316 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// otlpSpan and the types below are the OTLP/JSON encoding of a span
+// (opentelemetry-proto, trace/v1). IDs are hex; 64-bit integers are decimal
+// strings.
+type otlpSpan struct {
+	TraceID           string      `json:"traceId"`
+	SpanID            string      `json:"spanId"`
+	ParentSpanID      string      `json:"parentSpanId,omitempty"`
+	Name              string      `json:"name"`
+	Kind              int         `json:"kind"`
+	StartTimeUnixNano string      `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string      `json:"endTimeUnixNano"`
+	Attributes        []otlpAttr  `json:"attributes,omitempty"`
+	Status            *otlpStatus `json:"status,omitempty"`
+}
+
+type otlpAttr struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttr `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+func toOTLPValue(v any) otlpValue {
+	switch x := v.(type) {
+	case string:
+		return otlpValue{StringValue: &x}
+	case int64:
+		s := strconv.FormatInt(x, 10)
+		return otlpValue{IntValue: &s}
+	case int:
+		s := strconv.Itoa(x)
+		return otlpValue{IntValue: &s}
+	case float64:
+		return otlpValue{DoubleValue: &x}
+	case bool:
+		return otlpValue{BoolValue: &x}
+	default:
+		s := fmt.Sprint(x)
+		return otlpValue{StringValue: &s}
+	}
+}
+
+func toOTLPAttrs(attrs []Attr) []otlpAttr {
+	out := make([]otlpAttr, len(attrs))
+	for i, a := range attrs {
+		out[i] = otlpAttr{Key: a.Key, Value: toOTLPValue(a.Value)}
+	}
+	return out
+}
+
+func toOTLPSpan(s SpanData) otlpSpan {
+	o := otlpSpan{
+		TraceID:           s.Context.TraceID.String(),
+		SpanID:            s.Context.SpanID.String(),
+		Name:              s.Name,
+		Kind:              s.Kind,
+		StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+		Attributes:        toOTLPAttrs(s.Attrs),
+	}
+	if s.ParentID.IsValid() {
+		o.ParentSpanID = s.ParentID.String()
+	}
+	if s.Err != "" {
+		o.Status = &otlpStatus{Code: 2, Message: s.Err}
+	}
+	return o
+}
+
+// OTLPOptions configures an OTLPExporter.
+type OTLPOptions struct {
+	// Endpoint is the collector base URL; spans are POSTed to
+	// Endpoint + "/v1/traces".
+	Endpoint    string
+	ServiceName string
+	// BatchSize and Interval bound how long spans wait before a POST.
+	BatchSize int
+	Interval  time.Duration
+	// QueueSize bounds spans waiting for export; further spans are dropped.
+	QueueSize int
+	Client    *http.Client
+}
+
+// OTLPExporter batches spans and sends them to an OpenTelemetry collector
+// over OTLP/HTTP with JSON encoding.
+type OTLPExporter struct {
+	opts  OTLPOptions
+	url   string
+	spans chan SpanData
+	done  chan struct{}
+	// mu guards closed so ExportSpan never sends on the closed spans
+	// channel.
+	mu      sync.Mutex
+	closed  bool
+	dropped atomic.Uint64
+	failed  atomic.Uint64
+	onError func(error)
+}
+
+// NewOTLPExporter starts an exporter posting to opts.Endpoint. onError,
+// if set, is called with each failed export.
+func NewOTLPExporter(opts OTLPOptions, onError func(error)) *OTLPExporter {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 512
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 4096
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	e := &OTLPExporter{
+		opts:    opts,
+		url:     strings.TrimRight(opts.Endpoint, "/") + "/v1/traces",
+		spans:   make(chan SpanData, opts.QueueSize),
+		done:    make(chan struct{}),
+		onError: onError,
+	}
+	go e.run()
+	return e
+}
+
+// ExportSpan queues s for the next batch, dropping it when the queue is
+// full or the exporter has shut down.
+func (e *OTLPExporter) ExportSpan(s SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		e.dropped.Add(1)
+		return
+	}
+	select {
+	case e.spans <- s:
+	default:
+		e.dropped.Add(1)
+	}
+}
+
+// Stats returns spans dropped for lack of queue room or because they
+// ended after Shutdown, and batches that failed to send.
+func (e *OTLPExporter) Stats() (dropped, failedBatches uint64) {
+	return e.dropped.Load(), e.failed.Load()
+}
+
+// Shutdown sends the spans still queued and stops the exporter. Spans
+// ended afterwards are dropped.
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	if !e.closed {
+		e.closed = true
+		close(e.spans)
+	}
+	e.mu.Unlock()
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *OTLPExporter) run() {
+	defer close(e.done)
+	t := time.NewTicker(e.opts.Interval)
+	defer t.Stop()
+	batch := make([]SpanData, 0, e.opts.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.send(batch); err != nil {
+			e.failed.Add(1)
+			if e.onError != nil {
+				e.onError(err)
+			}
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case s, ok := <-e.spans:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, s)
+			if len(batch) >= e.opts.BatchSize {
+				flush()
+			}
+		case <-t.C:
+			flush()
+		}
+	}
+}
+
+func (e *OTLPExporter) send(batch []SpanData) error {
+	spans := make([]otlpSpan, len(batch))
+	for i, s := range batch {
+		spans[i] = toOTLPSpan(s)
+	}
+	body, err := json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: toOTLPAttrs([]Attr{String("service.name", e.opts.ServiceName)})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: e.opts.ServiceName}, Spans: spans}},
+	}}})
+	if err != nil {
+		return err
+	}
+	resp, err := e.opts.Client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("tracing: otlp export: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("tracing: otlp export: collector answered %s", resp.Status)
+	}
+	return nil
+}
+
+// WriterExporter writes each span as one OTLP/JSON line; use it with
+// os.Stdout to inspect traces locally.
+type WriterExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterExporter returns an exporter writing to w.
+func NewWriterExporter(w io.Writer) *WriterExporter { return &WriterExporter{w: w} }
+
+// ExportSpan writes s.
+func (e *WriterExporter) ExportSpan(s SpanData) {
+	b, err := json.Marshal(toOTLPSpan(s))
+	if err != nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, _ = e.w.Write(append(b, '\n'))
+}
+
+// Shutdown is a no-op.
+func (e *WriterExporter) Shutdown(context.Context) error { return nil }
+
+// MemoryExporter keeps finished spans in memory, for tests.
+type MemoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+// ExportSpan records s.
+func (e *MemoryExporter) ExportSpan(s SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, s)
+}
+
+// Spans returns the recorded spans in end order.
+func (e *MemoryExporter) Spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]SpanData(nil), e.spans...)
+}
+
+// Shutdown is a no-op.
+func (e *MemoryExporter) Shutdown(context.Context) error { return nil }
@@ -0,0 +1,297 @@
+// Package tracing provides minimal OpenTelemetry-style tracing: W3C trace
+// context propagation, spans, and exporters for OTLP/HTTP JSON, stdout and
+// memory.
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+// IsValid reports whether id is not all zeros.
+func (id TraceID) IsValid() bool { return id != TraceID{} }
+
+// String returns id as lowercase hex.
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+// IsValid reports whether id is not all zeros.
+func (id SpanID) IsValid() bool { return id != SpanID{} }
+
+// String returns id as lowercase hex.
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+// SpanContext is the propagated identity of a span.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid reports whether sc has both a trace and a span ID.
+func (sc SpanContext) IsValid() bool { return sc.TraceID.IsValid() && sc.SpanID.IsValid() }
+
+// Traceparent formats sc as a W3C traceparent header value, or "" when sc
+// is not valid.
+func (sc SpanContext) Traceparent() string {
+	if !sc.IsValid() {
+		return ""
+	}
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent parses a W3C traceparent header value. Unknown future
+// versions are accepted as long as the version 00 fields parse.
+func ParseTraceparent(s string) (SpanContext, bool) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, false
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, false
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	if !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	return sc, true
+}
+
+// Span kinds, numbered as in OTLP.
+const (
+	KindInternal = 1
+	KindServer   = 2
+	KindProducer = 4
+	KindConsumer = 5
+)
+
+// Attr is a span attribute. Value is a string, int64, float64 or bool.
+type Attr struct {
+	Key   string
+	Value any
+}
+
+// String returns a string attribute.
+func String(k, v string) Attr { return Attr{Key: k, Value: v} }
+
+// Int returns an integer attribute.
+func Int(k string, v int64) Attr { return Attr{Key: k, Value: v} }
+
+// Uint returns an integer attribute for an unsigned value such as a
+// sequence.
+func Uint(k string, v uint64) Attr { return Attr{Key: k, Value: int64(v)} } //nolint:gosec // sequences fit in int64
+
+// Bool returns a boolean attribute.
+func Bool(k string, v bool) Attr { return Attr{Key: k, Value: v} }
+
+// SpanData is a finished span handed to an Exporter.
+type SpanData struct {
+	Name     string
+	Kind     int
+	Context  SpanContext
+	ParentID SpanID
+	Start    time.Time
+	End      time.Time
+	Attrs    []Attr
+	// Err is the recorded error message; empty when the span succeeded.
+	Err string
+}
+
+// Exporter receives finished, sampled spans. ExportSpan must not block.
+type Exporter interface {
+	ExportSpan(s SpanData)
+	Shutdown(ctx context.Context) error
+}
+
+// Tracer starts spans and hands them to its exporter when they end. A nil
+// *Tracer is safe to use and records nothing.
+type Tracer struct {
+	exp Exporter
+}
+
+// NewTracer returns a tracer exporting to exp. With a nil exp spans still
+// get IDs, so trace context is propagated and logged, but nothing is
+// exported.
+func NewTracer(exp Exporter) *Tracer {
+	return &Tracer{exp: exp}
+}
+
+// Shutdown flushes and stops the exporter.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil || t.exp == nil {
+		return nil
+	}
+	return t.exp.Shutdown(ctx)
+}
+
+// Start begins a span that is a child of the span in ctx, or of a new trace
+// when ctx has none, and returns a context carrying it.
+func (t *Tracer) Start(ctx context.Context, name string, attrs ...Attr) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	var parent SpanContext
+	if p := SpanFromContext(ctx); p != nil {
+		parent = p.data.Context
+	}
+	s := t.StartFrom(parent, name, time.Now(), attrs...)
+	return ContextWithSpan(ctx, s), s
+}
+
+// StartFrom begins a span with an explicit parent and start time; used
+// where the parent arrives as a traceparent rather than in a context. An
+// invalid parent starts a new, sampled trace.
+func (t *Tracer) StartFrom(parent SpanContext, name string, start time.Time, attrs ...Attr) *Span {
+	if t == nil {
+		return nil
+	}
+	sc := SpanContext{TraceID: parent.TraceID, Sampled: parent.Sampled}
+	if !parent.IsValid() {
+		sc = SpanContext{TraceID: newTraceID(), Sampled: true}
+	}
+	sc.SpanID = newSpanID()
+	return &Span{tracer: t, data: SpanData{
+		Name:     name,
+		Kind:     KindInternal,
+		Context:  sc,
+		ParentID: parent.SpanID,
+		Start:    start,
+		Attrs:    attrs,
+	}}
+}
+
+// Span is an in-progress operation. A nil *Span is safe to use.
+type Span struct {
+	tracer *Tracer
+	mu     sync.Mutex
+	data   SpanData
+	ended  bool
+}
+
+// Context returns the span's identity for propagation.
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.data.Context
+}
+
+// SetName renames the span.
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Name = name
+}
+
+// SetKind sets the span kind (KindServer, ...).
+func (s *Span) SetKind(kind int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Kind = kind
+}
+
+// SetAttrs adds attributes to the span.
+func (s *Span) SetAttrs(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Attrs = append(s.data.Attrs, attrs...)
+}
+
+// RecordError marks the span failed with err.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Err = err.Error()
+}
+
+// End finishes the span and exports it when sampled. Only the first call
+// has an effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	d := s.data
+	s.mu.Unlock()
+	if d.Context.Sampled && s.tracer.exp != nil {
+		s.tracer.exp.ExportSpan(d)
+	}
+}
+
+type ctxKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying s.
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, ctxKey{}, s)
+}
+
+// SpanFromContext returns the span in ctx, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(ctxKey{}).(*Span)
+	return s
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		putUint64(id[:8], rand.Uint64())
+		putUint64(id[8:], rand.Uint64())
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		putUint64(id[:], rand.Uint64())
+	}
+	return id
+}
+
+func putUint64(b []byte, v uint64) {
+	for i := range 8 {
+		b[i] = byte(v >> (56 - 8*i))
+	}
+}
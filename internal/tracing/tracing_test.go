@@ -0,0 +1,148 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	const tp = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := ParseTraceparent(tp)
+	if !ok || !sc.Sampled || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" {
+		t.Fatalf("parse %q = %+v, %v", tp, sc, ok)
+	}
+	if got := sc.Traceparent(); got != tp {
+		t.Fatalf("round trip = %q, want %q", got, tp)
+	}
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		if _, ok := ParseTraceparent(bad); ok {
+			t.Fatalf("accepted invalid traceparent %q", bad)
+		}
+	}
+	if _, ok := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"); !ok {
+		t.Fatalf("rejected future-version traceparent")
+	}
+}
+
+func TestTracerParentChildAndSampling(t *testing.T) {
+	exp := &MemoryExporter{}
+	tr := NewTracer(exp)
+	ctx, root := tr.Start(context.Background(), "root")
+	_, child := tr.Start(ctx, "child", String("k", "v"))
+	child.RecordError(context.Canceled)
+	child.End()
+	root.End()
+	root.End()
+
+	spans := exp.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(spans))
+	}
+	c, r := spans[0], spans[1]
+	if c.Name != "child" || r.Name != "root" {
+		t.Fatalf("unexpected span order %q, %q", c.Name, r.Name)
+	}
+	if c.Context.TraceID != r.Context.TraceID || c.ParentID != r.Context.SpanID || r.ParentID.IsValid() {
+		t.Fatalf("child %+v is not linked to root %+v", c, r)
+	}
+	if c.Err != context.Canceled.Error() {
+		t.Fatalf("child error = %q", c.Err)
+	}
+
+	unsampled, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	s := tr.StartFrom(unsampled, "dropped", time.Now())
+	s.End()
+	if len(exp.Spans()) != 2 {
+		t.Fatalf("exported a span of an unsampled trace")
+	}
+	if s.Context().TraceID != unsampled.TraceID {
+		t.Fatalf("unsampled span did not continue the trace")
+	}
+
+	var nilTracer *Tracer
+	_, ns := nilTracer.Start(context.Background(), "noop")
+	ns.SetAttrs(Bool("x", true))
+	ns.End()
+}
+
+func TestOTLPExporterPostsJSON(t *testing.T) {
+	bodies := make(chan []byte, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request %s %q", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		var buf bytes.Buffer
+		_, _ = buf.ReadFrom(r.Body)
+		bodies <- buf.Bytes()
+	}))
+	defer srv.Close()
+
+	exp := NewOTLPExporter(OTLPOptions{Endpoint: srv.URL + "/", ServiceName: "svc", Interval: time.Hour}, func(err error) { t.Errorf("export: %v", err) })
+	tr := NewTracer(exp)
+	_, s := tr.Start(context.Background(), "op", Int("n", 7))
+	s.SetKind(KindServer)
+	s.End()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := tr.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	var req otlpRequest
+	if err := json.Unmarshal(<-bodies, &req); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	rs := req.ResourceSpans[0]
+	if v := rs.Resource.Attributes[0]; v.Key != "service.name" || *v.Value.StringValue != "svc" {
+		t.Fatalf("unexpected resource %+v", rs.Resource)
+	}
+	got := rs.ScopeSpans[0].Spans[0]
+	if got.Name != "op" || got.Kind != KindServer || got.TraceID != s.Context().TraceID.String() || *got.Attributes[0].Value.IntValue != "7" {
+		t.Fatalf("unexpected span %+v", got)
+	}
+}
+
+func TestWriterExporter(t *testing.T) {
+	var buf bytes.Buffer
+	tr := NewTracer(NewWriterExporter(&buf))
+	_, s := tr.Start(context.Background(), "op")
+	s.End()
+	if !strings.Contains(buf.String(), `"name":"op"`) || !strings.HasSuffix(buf.String(), "\n") {
+		t.Fatalf("unexpected output %q", buf.String())
+	}
+}
+
+func TestOTLPExporterDropsSpansAfterShutdown(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+
+	exp := NewOTLPExporter(OTLPOptions{Endpoint: srv.URL, ServiceName: "svc", Interval: time.Hour}, nil)
+	tr := NewTracer(exp)
+	_, s := tr.Start(context.Background(), "late")
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := tr.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	s.End()
+	if err := tr.Shutdown(ctx); err != nil {
+		t.Fatalf("second shutdown: %v", err)
+	}
+	if dropped, _ := exp.Stats(); dropped != 1 {
+		t.Fatalf("dropped = %d, want 1", dropped)
+	}
+}
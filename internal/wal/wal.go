@@ -0,0 +1,235 @@
+// Package wal implements an append-only log of checksummed records.
+//
+// Each record is framed as a 4-byte little-endian payload length, a 4-byte
+// CRC-32C of the payload, and the payload itself. A torn or corrupt tail,
+// as left behind by a crash mid-write, is detected on open and truncated.
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+const headerSize = 8
+
+// maxRecordSize bounds a single payload so a corrupt length cannot trigger
+// a huge allocation during replay.
+const maxRecordSize = 16 << 20
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrRecordTooLarge is returned when appending a payload over the size limit.
+var ErrRecordTooLarge = errors.New("wal: record too large")
+
+// SyncPolicy controls when appended records are fsynced to disk.
+type SyncPolicy int
+
+const (
+	// SyncInterval leaves fsync to the owner, which calls Flush periodically.
+	SyncInterval SyncPolicy = iota
+	// SyncAlways fsyncs after every append.
+	SyncAlways
+	// SyncNever never fsyncs explicitly and relies on the OS page cache.
+	SyncNever
+)
+
+// String returns the policy name as accepted by ParseSyncPolicy.
+func (p SyncPolicy) String() string {
+	switch p {
+	case SyncAlways:
+		return "always"
+	case SyncNever:
+		return "never"
+	default:
+		return "interval"
+	}
+}
+
+// ParseSyncPolicy parses "always", "interval" or "never".
+func ParseSyncPolicy(s string) (SyncPolicy, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "always":
+		return SyncAlways, nil
+	case "", "interval":
+		return SyncInterval, nil
+	case "never":
+		return SyncNever, nil
+	default:
+		return SyncInterval, fmt.Errorf("wal: unknown sync policy %q", s)
+	}
+}
+
+// Log is an append-only record file safe for concurrent use.
+type Log struct {
+	// syncMu serialises fsyncs, which run outside mu so appends are not
+	// held up by a slow disk.
+	syncMu sync.Mutex
+	mu     sync.Mutex
+	f      *os.File
+	policy SyncPolicy
+	size   int64
+	dirty  bool
+}
+
+// Open opens or creates the log at path, calling replay for every intact
+// record in order. Anything after the last intact record is truncated.
+func Open(path string, policy SyncPolicy, replay func(payload []byte) error) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	valid, err := scan(f, replay)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if err := f.Truncate(valid); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(valid, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &Log{f: f, policy: policy, size: valid}, nil
+}
+
+// scan reads records from the start of f and returns the offset just past
+// the last intact one. Errors from fn abort the scan.
+func scan(f *os.File, fn func([]byte) error) (int64, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	r := bufio.NewReader(f)
+	var off int64
+	var hdr [headerSize]byte
+	for {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return off, nil
+		}
+		n := binary.LittleEndian.Uint32(hdr[0:4])
+		sum := binary.LittleEndian.Uint32(hdr[4:8])
+		if n > maxRecordSize {
+			return off, nil
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return off, nil
+		}
+		if crc32.Checksum(payload, crcTable) != sum {
+			return off, nil
+		}
+		if fn != nil {
+			if err := fn(payload); err != nil {
+				return off, err
+			}
+		}
+		off += headerSize + int64(n)
+	}
+}
+
+// Append writes one record and fsyncs it when the policy is SyncAlways.
+func (l *Log) Append(payload []byte) error {
+	if len(payload) > maxRecordSize {
+		return ErrRecordTooLarge
+	}
+	buf := make([]byte, headerSize+len(payload))
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(payload))) //nolint:gosec // bounded by maxRecordSize
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.Checksum(payload, crcTable))
+	copy(buf[headerSize:], payload)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n, err := l.f.Write(buf)
+	if err != nil {
+		// Drop the partial write so the next append starts on a record boundary.
+		_ = l.f.Truncate(l.size)
+		_, _ = l.f.Seek(l.size, io.SeekStart)
+		return err
+	}
+	l.size += int64(n)
+	l.dirty = true
+	if l.policy == SyncAlways {
+		return l.syncLocked()
+	}
+	return nil
+}
+
+// Flush fsyncs pending appends unless the policy is SyncNever. Appends
+// may continue while the fsync runs; every append that completed before
+// Flush was called is on disk when it returns.
+func (l *Log) Flush() error {
+	l.syncMu.Lock()
+	defer l.syncMu.Unlock()
+	l.mu.Lock()
+	if l.policy == SyncNever || !l.dirty {
+		l.mu.Unlock()
+		return nil
+	}
+	l.dirty = false
+	l.mu.Unlock()
+	if err := l.f.Sync(); err != nil {
+		l.mu.Lock()
+		l.dirty = true
+		l.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (l *Log) syncLocked() error {
+	if !l.dirty {
+		return nil
+	}
+	if err := l.f.Sync(); err != nil {
+		return err
+	}
+	l.dirty = false
+	return nil
+}
+
+// Reset discards every record, e.g. after their effects were snapshotted.
+func (l *Log) Reset() error {
+	l.syncMu.Lock()
+	defer l.syncMu.Unlock()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := l.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	l.size = 0
+	l.dirty = false
+	return l.f.Sync()
+}
+
+// Size returns the current log size in bytes.
+func (l *Log) Size() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.size
+}
+
+// Close flushes and closes the underlying file.
+func (l *Log) Close() error {
+	l.syncMu.Lock()
+	defer l.syncMu.Unlock()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var err error
+	if l.policy != SyncNever {
+		err = l.syncLocked()
+	}
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
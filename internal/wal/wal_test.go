@@ -0,0 +1,147 @@
+package wal
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func readAll(t *testing.T, path string) []string {
+	t.Helper()
+	var got []string
+	l, err := Open(path, SyncAlways, func(p []byte) error {
+		got = append(got, string(p))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	return got
+}
+
+func TestAppendReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.wal")
+	l, err := Open(path, SyncAlways, nil)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	for _, s := range []string{"one", "two", "three"} {
+		if err := l.Append([]byte(s)); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	got := readAll(t, path)
+	if len(got) != 3 || got[0] != "one" || got[2] != "three" {
+		t.Fatalf("unexpected replay: %v", got)
+	}
+}
+
+func TestTornTailTruncated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "b.wal")
+	l, err := Open(path, SyncNever, nil)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	_ = l.Append([]byte("keep"))
+	_ = l.Append([]byte("torn-record"))
+	good := int64(headerSize + len("keep"))
+	_ = l.Close()
+	// Cut the second record in half, as a crash mid-write would.
+	if err := os.Truncate(path, good+headerSize+3); err != nil {
+		t.Fatalf("truncate: %v", err)
+	}
+	got := readAll(t, path)
+	if len(got) != 1 || got[0] != "keep" {
+		t.Fatalf("unexpected replay: %v", got)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if fi.Size() != good {
+		t.Fatalf("expected torn tail truncated to %d, got %d", good, fi.Size())
+	}
+}
+
+func TestCorruptRecordStopsReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "c.wal")
+	l, _ := Open(path, SyncNever, nil)
+	_ = l.Append([]byte("first"))
+	_ = l.Append([]byte("second"))
+	_ = l.Close()
+	data, _ := os.ReadFile(path)
+	data[len(data)-1] ^= 0xff
+	_ = os.WriteFile(path, data, 0o600)
+	got := readAll(t, path)
+	if len(got) != 1 || got[0] != "first" {
+		t.Fatalf("unexpected replay: %v", got)
+	}
+}
+
+func TestResetAndParsePolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "d.wal")
+	l, _ := Open(path, SyncInterval, nil)
+	_ = l.Append([]byte("x"))
+	if err := l.Flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if err := l.Reset(); err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+	if l.Size() != 0 {
+		t.Fatalf("expected empty log after reset")
+	}
+	_ = l.Close()
+	for in, want := range map[string]SyncPolicy{"always": SyncAlways, "": SyncInterval, "NEVER": SyncNever} {
+		got, err := ParseSyncPolicy(in)
+		if err != nil || got != want {
+			t.Fatalf("ParseSyncPolicy(%q) = %v, %v", in, got, err)
+		}
+	}
+	if _, err := ParseSyncPolicy("sometimes"); err == nil {
+		t.Fatalf("expected error for unknown policy")
+	}
+}
+
+func TestFlushConcurrentWithAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.wal")
+	l, err := Open(path, SyncInterval, nil)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				if err := l.Append([]byte("x")); err != nil {
+					t.Errorf("append: %v", err)
+					return
+				}
+				if err := l.Flush(); err != nil {
+					t.Errorf("flush: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if err := l.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	// A log closed clean has nothing left to sync.
+	if err := l.Flush(); err != nil {
+		t.Fatalf("flush after close: %v", err)
+	}
+	if got := readAll(t, path); len(got) != 200 {
+		t.Fatalf("expected 200 records, got %d", len(got))
+	}
+}
@@ -0,0 +1,423 @@
+// Package webhook delivers product changes to subscribed HTTP endpoints.
+//
+// A Dispatcher reads the change log and fans each change out to the
+// bounded queue of every matching subscription. Each subscription has one
+// delivery goroutine, so changes reach a receiver in log order. Failed
+// deliveries are retried with exponential backoff and end up in a bounded
+// dead-letter list once the attempts are exhausted.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/changes"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/obs"
+	"github.com/google/uuid"
+)
+
+// Headers set on every delivery.
+const (
+	HeaderSignature    = "X-Webhook-Signature"
+	HeaderSubscription = "X-Webhook-Subscription"
+	HeaderSequence     = "X-Webhook-Sequence"
+)
+
+// Reasons recorded on dead letters.
+const (
+	ReasonQueueFull         = "queue_full"
+	ReasonAttemptsExhausted = "attempts_exhausted"
+)
+
+// ErrInvalidSubscription is returned by Create for a malformed spec.
+var ErrInvalidSubscription = errors.New("webhook: invalid subscription")
+
+// Options configure delivery.
+type Options struct {
+	MaxAttempts    int
+	Backoff        time.Duration
+	MaxBackoff     time.Duration
+	QueueSize      int
+	Timeout        time.Duration
+	DeadLetterSize int
+	// Client overrides the HTTP client; Timeout is ignored when set.
+	Client *http.Client
+}
+
+// Spec is the caller-supplied part of a subscription.
+type Spec struct {
+	URL        string   `json:"url"`
+	ProductIDs []string `json:"product_ids,omitempty"`
+	Prefix     string   `json:"prefix,omitempty"`
+	Secret     string   `json:"secret"`
+}
+
+// Subscription is the public view of a registered webhook. The secret is
+// never exposed.
+type Subscription struct {
+	ID           string    `json:"id"`
+	URL          string    `json:"url"`
+	ProductIDs   []string  `json:"product_ids,omitempty"`
+	Prefix       string    `json:"prefix,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	Pending      int       `json:"pending"`
+	Delivered    uint64    `json:"delivered"`
+	Failed       uint64    `json:"failed_attempts"`
+	DeadLettered uint64    `json:"dead_lettered"`
+}
+
+// DeadLetter is a change that could not be delivered to a subscription.
+type DeadLetter struct {
+	SubscriptionID string         `json:"subscription_id"`
+	Change         changes.Change `json:"change"`
+	Reason         string         `json:"reason"`
+	Attempts       int            `json:"attempts"`
+	LastError      string         `json:"last_error,omitempty"`
+	FailedAt       time.Time      `json:"failed_at"`
+}
+
+// Metrics are dispatcher-wide delivery counters.
+type Metrics struct {
+	Subscriptions  int    `json:"webhook_subscriptions"`
+	Delivered      uint64 `json:"webhook_delivered"`
+	FailedAttempts uint64 `json:"webhook_failed_attempts"`
+	DeadLettered   uint64 `json:"webhook_dead_lettered"`
+	Missed         uint64 `json:"webhook_missed"`
+}
+
+// Sign returns the signature header value for body: "sha256=" followed by
+// the hex HMAC-SHA256 of body keyed with secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// subscription is a registered webhook with its queue and counters.
+type subscription struct {
+	Spec
+	id        string
+	createdAt time.Time
+	ids       map[string]bool
+	queue     chan changes.Change
+	cancel    context.CancelFunc
+
+	delivered    atomic.Uint64
+	failed       atomic.Uint64
+	deadLettered atomic.Uint64
+}
+
+func (s *subscription) match(c changes.Change) bool {
+	if s.ids != nil && !s.ids[c.ProductID] {
+		return false
+	}
+	return strings.HasPrefix(c.ProductID, s.Prefix)
+}
+
+func (s *subscription) view() Subscription {
+	return Subscription{
+		ID:           s.id,
+		URL:          s.URL,
+		ProductIDs:   s.ProductIDs,
+		Prefix:       s.Prefix,
+		CreatedAt:    s.createdAt,
+		Pending:      len(s.queue),
+		Delivered:    s.delivered.Load(),
+		Failed:       s.failed.Load(),
+		DeadLettered: s.deadLettered.Load(),
+	}
+}
+
+// Dispatcher owns the subscriptions and their delivery goroutines.
+type Dispatcher struct {
+	log    *changes.Log
+	opts   Options
+	client *http.Client
+
+	mu   sync.Mutex
+	ctx  context.Context
+	subs map[string]*subscription
+	dead []DeadLetter
+
+	delivered atomic.Uint64
+	failed    atomic.Uint64
+	deadCount atomic.Uint64
+	missed    atomic.Uint64
+}
+
+// New returns a Dispatcher reading from log. A nil log disables webhooks:
+// Create then fails and nothing is delivered.
+func New(log *changes.Log, opts Options) *Dispatcher {
+	if opts.MaxAttempts < 1 {
+		opts.MaxAttempts = 1
+	}
+	if opts.QueueSize < 1 {
+		opts.QueueSize = 1
+	}
+	client := opts.Client
+	if client == nil {
+		client = &http.Client{Timeout: opts.Timeout}
+	}
+	return &Dispatcher{log: log, opts: opts, client: client, subs: make(map[string]*subscription)}
+}
+
+// Enabled reports whether the dispatcher has a change log to read.
+func (d *Dispatcher) Enabled() bool { return d.log != nil }
+
+// Start begins fanning out changes appended from now on. Deliveries stop
+// when ctx is done.
+func (d *Dispatcher) Start(ctx context.Context) {
+	if d.log == nil {
+		return
+	}
+	d.mu.Lock()
+	d.ctx = ctx
+	for _, s := range d.subs {
+		d.startLocked(s)
+	}
+	d.mu.Unlock()
+	go d.fanOut(ctx, d.log.Head())
+}
+
+// Create validates spec and registers a subscription.
+func (d *Dispatcher) Create(spec Spec) (Subscription, error) {
+	if d.log == nil {
+		return Subscription{}, fmt.Errorf("%w: change log disabled", ErrInvalidSubscription)
+	}
+	u, err := url.Parse(spec.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Subscription{}, fmt.Errorf("%w: url must be an absolute http(s) URL", ErrInvalidSubscription)
+	}
+	if spec.Secret == "" {
+		return Subscription{}, fmt.Errorf("%w: secret is required", ErrInvalidSubscription)
+	}
+	s := &subscription{
+		Spec:      spec,
+		id:        uuid.NewString(),
+		createdAt: time.Now().UTC(),
+		queue:     make(chan changes.Change, d.opts.QueueSize),
+	}
+	for _, id := range spec.ProductIDs {
+		if s.ids == nil {
+			s.ids = make(map[string]bool)
+		}
+		s.ids[id] = true
+	}
+	d.mu.Lock()
+	d.subs[s.id] = s
+	if d.ctx != nil {
+		d.startLocked(s)
+	}
+	d.mu.Unlock()
+	obs.Logger.Info("webhook_subscribed", "subscription_id", s.id, "url", s.URL)
+	return s.view(), nil
+}
+
+// Get returns the subscription with id.
+func (d *Dispatcher) Get(id string) (Subscription, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s, ok := d.subs[id]
+	if !ok {
+		return Subscription{}, false
+	}
+	return s.view(), true
+}
+
+// List returns every subscription.
+func (d *Dispatcher) List() []Subscription {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make([]Subscription, 0, len(d.subs))
+	for _, s := range d.subs {
+		out = append(out, s.view())
+	}
+	return out
+}
+
+// Delete removes a subscription and stops its deliveries; queued changes
+// are discarded.
+func (d *Dispatcher) Delete(id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s, ok := d.subs[id]
+	if !ok {
+		return false
+	}
+	delete(d.subs, id)
+	if s.cancel != nil {
+		s.cancel()
+	}
+	obs.Logger.Info("webhook_unsubscribed", "subscription_id", id)
+	return true
+}
+
+// DeadLetters returns the retained dead letters, oldest first.
+func (d *Dispatcher) DeadLetters() []DeadLetter {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]DeadLetter(nil), d.dead...)
+}
+
+// Metrics returns dispatcher-wide counters.
+func (d *Dispatcher) Metrics() Metrics {
+	d.mu.Lock()
+	n := len(d.subs)
+	d.mu.Unlock()
+	return Metrics{
+		Subscriptions:  n,
+		Delivered:      d.delivered.Load(),
+		FailedAttempts: d.failed.Load(),
+		DeadLettered:   d.deadCount.Load(),
+		Missed:         d.missed.Load(),
+	}
+}
+
+func (d *Dispatcher) startLocked(s *subscription) {
+	ctx, cancel := context.WithCancel(d.ctx)
+	s.cancel = cancel
+	go d.deliverLoop(ctx, s)
+}
+
+// fanOut copies each new change into the queue of every matching
+// subscription. A full queue dead-letters the change for that subscription
+// rather than stalling the others.
+func (d *Dispatcher) fanOut(ctx context.Context, pos uint64) {
+	for {
+		wake := d.log.Wait()
+		batch, next, missed := d.log.Since(pos)
+		pos = next
+		if missed > 0 {
+			d.missed.Add(missed)
+			obs.Logger.Warn("webhook_changes_missed", "missed", missed)
+		}
+		for _, c := range batch {
+			d.mu.Lock()
+			for _, s := range d.subs {
+				if !s.match(c) {
+					continue
+				}
+				select {
+				case s.queue <- c:
+				default:
+					d.deadLetterLocked(s, c, ReasonQueueFull, 0, "")
+				}
+			}
+			d.mu.Unlock()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		}
+	}
+}
+
+func (d *Dispatcher) deliverLoop(ctx context.Context, s *subscription) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case c := <-s.queue:
+			d.deliver(ctx, s, c)
+		}
+	}
+}
+
+// deliver posts c to the subscription, retrying with exponential backoff
+// until it succeeds, attempts run out, or ctx is done.
+func (d *Dispatcher) deliver(ctx context.Context, s *subscription, c changes.Change) {
+	body, err := json.Marshal(c)
+	if err != nil {
+		return
+	}
+	backoff := d.opts.Backoff
+	for attempt := 1; ; attempt++ {
+		err := d.post(ctx, s, c, body)
+		if err == nil {
+			s.delivered.Add(1)
+			d.delivered.Add(1)
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		s.failed.Add(1)
+		d.failed.Add(1)
+		obs.Logger.Warn("webhook_delivery_failed", "subscription_id", s.id, "sequence", c.Sequence, "attempt", attempt, "error", err)
+		if attempt >= d.opts.MaxAttempts {
+			d.mu.Lock()
+			d.deadLetterLocked(s, c, ReasonAttemptsExhausted, attempt, err.Error())
+			d.mu.Unlock()
+			return
+		}
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		if backoff *= 2; d.opts.MaxBackoff > 0 && backoff > d.opts.MaxBackoff {
+			backoff = d.opts.MaxBackoff
+		}
+	}
+}
+
+func (d *Dispatcher) post(ctx context.Context, s *subscription, c changes.Change, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderSignature, Sign(s.Secret, body))
+	req.Header.Set(HeaderSubscription, s.id)
+	req.Header.Set(HeaderSequence, strconv.FormatUint(c.Sequence, 10))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	// Drain the body so the keep-alive connection is reused.
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("receiver returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// deadLetterLocked records a dead letter, evicting the oldest one when the
+// list is full.
+func (d *Dispatcher) deadLetterLocked(s *subscription, c changes.Change, reason string, attempts int, lastErr string) {
+	s.deadLettered.Add(1)
+	d.deadCount.Add(1)
+	if d.opts.DeadLetterSize <= 0 {
+		return
+	}
+	if len(d.dead) >= d.opts.DeadLetterSize {
+		d.dead = d.dead[1:]
+	}
+	d.dead = append(d.dead, DeadLetter{
+		SubscriptionID: s.id,
+		Change:         c,
+		Reason:         reason,
+		Attempts:       attempts,
+		LastError:      lastErr,
+		FailedAt:       time.Now().UTC(),
+	})
+	obs.Logger.Error("webhook_dead_lettered", "subscription_id", s.id, "sequence", c.Sequence, "reason", reason, "attempts", attempts)
+}
@@ -0,0 +1,131 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fairyhunter13/product-update-service-simulator/internal/changes"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/model"
+	"github.com/fairyhunter13/product-update-service-simulator/internal/obs"
+)
+
+func testOptions() Options {
+	return Options{
+		MaxAttempts:    3,
+		Backoff:        5 * time.Millisecond,
+		MaxBackoff:     20 * time.Millisecond,
+		QueueSize:      16,
+		Timeout:        time.Second,
+		DeadLetterSize: 10,
+	}
+}
+
+func change(seq uint64, id string) changes.Change {
+	return changes.Change{Sequence: seq, ProductID: id, Product: model.Product{ProductID: id, Price: float64(seq)}}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met before deadline")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDispatcher_SignedOrderedDelivery(t *testing.T) {
+	obs.InitLogger()
+	var mu sync.Mutex
+	var got []uint64
+	recv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(HeaderSignature) != Sign("s3cret", body) {
+			t.Errorf("bad signature %q", r.Header.Get(HeaderSignature))
+		}
+		var c changes.Change
+		_ = json.Unmarshal(body, &c)
+		mu.Lock()
+		got = append(got, c.Sequence)
+		mu.Unlock()
+	}))
+	defer recv.Close()
+
+	log := changes.NewLog(100)
+	d := New(log, testOptions())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d.Start(ctx)
+	sub, err := d.Create(Spec{URL: recv.URL, Prefix: "sku-", Secret: "s3cret"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	log.Append(change(1, "sku-1"))
+	log.Append(change(2, "other"))
+	log.Append(change(3, "sku-2"))
+
+	waitFor(t, func() bool { s, _ := d.Get(sub.ID); return s.Delivered == 2 })
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 2 || got[0] != 1 || got[1] != 3 {
+		t.Fatalf("expected sequences [1 3], got %v", got)
+	}
+}
+
+func TestDispatcher_RetryThenDeadLetter(t *testing.T) {
+	obs.InitLogger()
+	var calls atomic.Int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		// Fail the first attempt only.
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer flaky.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	log := changes.NewLog(100)
+	d := New(log, testOptions())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d.Start(ctx)
+	ok, _ := d.Create(Spec{URL: flaky.URL, Secret: "k"})
+	bad, _ := d.Create(Spec{URL: down.URL, Secret: "k"})
+	log.Append(change(7, "p"))
+
+	waitFor(t, func() bool { return d.Metrics().DeadLettered == 1 })
+	if s, _ := d.Get(ok.ID); s.Delivered != 1 || s.Failed != 1 {
+		t.Fatalf("flaky receiver: expected 1 delivered after 1 failure, got %+v", s)
+	}
+	dl := d.DeadLetters()
+	if len(dl) != 1 || dl[0].SubscriptionID != bad.ID || dl[0].Attempts != 3 || dl[0].Reason != ReasonAttemptsExhausted {
+		t.Fatalf("unexpected dead letters: %+v", dl)
+	}
+}
+
+func TestDispatcher_CreateValidation(t *testing.T) {
+	d := New(changes.NewLog(1), testOptions())
+	for _, spec := range []Spec{
+		{URL: "ftp://x", Secret: "k"},
+		{URL: "/relative", Secret: "k"},
+		{URL: "http://ok"},
+	} {
+		if _, err := d.Create(spec); err == nil {
+			t.Fatalf("expected error for %+v", spec)
+		}
+	}
+	if _, err := New(nil, testOptions()).Create(Spec{URL: "http://ok", Secret: "k"}); err == nil {
+		t.Fatalf("expected error when change log disabled")
+	}
+}